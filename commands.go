@@ -0,0 +1,202 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "guarddog/config"
+    "guarddog/policy"
+    "guarddog/seccomphelper"
+    "guarddog/util"
+)
+
+/*
+    A command like "guarddog syscalls", run receives arguments
+    after the command name and returns exit code
+ */
+type command struct {
+    name    string
+    run     func(args []string) int
+}
+
+var commands = []command{
+    {"run", runCommand},
+    {"syscalls", syscallsCommand},
+    {"policy", policyCommand},
+    {"check", checkCommand},
+    {"check-config", checkCommand},
+    {"serve", serveCommand},
+    {"judge", judgeCommand},
+}
+
+func findCommand(list []command, name string) *command {
+    for i := range list {
+        if list[i].name == name {
+            return &list[i]
+        }
+    }
+    return nil
+}
+
+type validatable interface {
+    Validate() error
+}
+
+/*
+    Parses and validates options of a command, returns false
+    and exit code if the program must exit
+ */
+func parseCommandOptions(usage string, options validatable, args []string) (bool, int) {
+    parser := config.NewCommandParser(usage, options)
+    if err := parser.ParseInto(options, args); err != nil {
+        return false, reportParseError(err)
+    }
+    logWarnings(newStderrLogger(), parser.Warnings())
+
+    if err := options.Validate(); err != nil {
+        fmt.Fprintf(os.Stderr, "%s: invalid options: %s\n", config.PROGRAM_NAME, err)
+        return false, 1
+    }
+
+    return true, 0
+}
+
+/* Prints an error from the parser if needed and returns exit code */
+func reportParseError(err error) int {
+    if err == flag.ErrHelp {
+        return 0
+    }
+
+    // Errors in arguments are already printed by flag package
+    if _, isArgumentsError := err.(*config.ArgumentsError); !isArgumentsError {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", config.PROGRAM_NAME, err)
+    }
+
+    return 1
+}
+
+func newStderrLogger() *util.Logger {
+    logger, err := util.NewLogger(2, false, config.PROGRAM_NAME + ": ")
+    if err != nil {
+        panic(fmt.Sprintf("cannot log to stderr: %s", err))
+    }
+    return logger
+}
+
+func logWarnings(logger *util.Logger, warnings []string) {
+    for _, warning := range warnings {
+        logger.Warning("%s", warning)
+    }
+}
+
+func printError(err error) int {
+    fmt.Fprintf(os.Stderr, "%s: %s\n", config.PROGRAM_NAME, err)
+    return 1
+}
+
+/* Implements "guarddog syscalls" command */
+func syscallsCommand(args []string) int {
+    options := new(config.SyscallsOptions)
+    if ok, code := parseCommandOptions("syscalls [options]", options, args); !ok {
+        return code
+    }
+
+    if options.Groups {
+        dumpGroups()
+    } else {
+        dumpSyscalls()
+    }
+
+    return 0
+}
+
+func dumpSyscalls() {
+    debugInfo := seccomphelper.GetLibraryInfo()
+    fmt.Printf(
+        "# arch %s, libseccomp version %s\n",
+        debugInfo.Arch,
+        debugInfo.LibseccompVersion)
+
+    list := seccomphelper.GetSyscallNames()
+    for syscallInfo := range list {
+        fmt.Printf("%4d %s\n", syscallInfo.Number, syscallInfo.Name)
+    }
+}
+
+/* Prints groups with members that exist on the native arch */
+func dumpGroups() {
+    for _, name := range policy.GroupNames() {
+        members, _ := policy.LookupGroup(name)
+        natives, _ := seccomphelper.NormalizeSyscallNames(members)
+        fmt.Printf("%s:", name)
+        for _, member := range natives {
+            fmt.Printf(" %s", member)
+        }
+        fmt.Printf("\n")
+    }
+}
+
+/*
+    Implements "guarddog check CONFIG..." command that validates
+    config files of the run command and policies referenced by them
+    and warns about likely mistakes. Exit code is 1 if there are errors
+    and 2 if there are only warnings and -strict is given.
+ */
+func checkCommand(args []string) int {
+    options := new(config.CheckOptions)
+    if ok, code := parseCommandOptions("check [options] CONFIG...", options, args); !ok {
+        return code
+    }
+
+    logger := newStderrLogger()
+    exitCode := 0
+    for _, fileName := range options.Files {
+        warnings, err := checkConfigFile(logger, fileName)
+        for _, warning := range warnings {
+            fmt.Println(warning)
+        }
+
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "%s: %s: %s\n", config.PROGRAM_NAME, fileName, err)
+            exitCode = 1
+            continue
+        }
+
+        if len(warnings) == 0 {
+            fmt.Printf("%s: ok\n", fileName)
+        } else if options.Strict && exitCode == 0 {
+            exitCode = 2
+        }
+    }
+
+    return exitCode
+}
+
+/* Validates a config file, returns warnings found before an error */
+func checkConfigFile(logger *util.Logger, fileName string) ([]configWarning, error) {
+    options := config.NewGuarddogOptions()
+    parser := config.NewConfigurationParser()
+    if err := parser.ParseConfigFile(options, fileName); err != nil {
+        return nil, err
+    }
+    logWarnings(logger, parser.Warnings())
+
+    linted := &lintedConfig{
+        fileName: fileName,
+        options: options,
+        allow: parser.OptionValues("allow"),
+        allowAny: parser.OptionValues("allow-any-syscalls"),
+    }
+    warnings := lintOptions(linted)
+
+    if err := options.Validate(); err != nil {
+        return warnings, err
+    }
+
+    p, rules, err := resolvePolicy(logger, &options.PolicyOptions)
+    if err != nil {
+        return warnings, err
+    }
+
+    return append(warnings, lintPolicy(linted, p, rules)...), nil
+}
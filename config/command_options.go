@@ -0,0 +1,232 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "guarddog/policy"
+    "runtime"
+    "strings"
+    "time"
+)
+
+/*
+    Options for commands other than run. Every struct is parsed
+    with NewCommandParser, see GuarddogOptions for supported tags.
+ */
+
+/* guarddog syscalls */
+type SyscallsOptions struct {
+    Groups      bool        `option:"print syscall groups and their members instead of syscall numbers"`
+}
+
+/* guarddog policy export */
+type PolicyExportOptions struct {
+    ConfigFileOptions
+    PolicyOptions
+    Format      string      `option:"output format: oci (OCI and Docker seccomp JSON) or systemd (unit file directives)"`
+}
+
+/* guarddog policy test SYSCALL [ARGS] */
+type PolicyTestOptions struct {
+    ConfigFileOptions
+    PolicyOptions
+    /* syscall name and argument values */
+    Call        []string    `tail:"yes"`
+}
+
+/* guarddog policy diff A B */
+type PolicyDiffOptions struct {
+    Arch        string      `option:"resolve syscalls for this arch, e.g. x86, amd64 or arm64, default is the native arch"`
+    Format      string      `option:"output format" enum:"text,json"`
+    Files       []string    `tail:"yes"`
+}
+
+/* guarddog policy from-strace LOG */
+type PolicyFromStraceOptions struct {
+    Format      string      `option:"output format: config (guarddog config file) or policy (YAML policy file)" enum:"config,policy"`
+    InferArgs   bool        `option:"generate rules checking socket domains and open modes, requires -format=policy"`
+    Files       []string    `tail:"yes"`
+}
+
+/* guarddog check CONFIG... */
+type CheckOptions struct {
+    Strict      bool        `option:"exit with code 2 if there are warnings"`
+    Files       []string    `tail:"yes"`
+}
+
+/* guarddog serve -socket=PATH */
+type ServeOptions struct {
+    ConfigFileOptions
+    SandboxOptions
+    Socket      string      `option:"path of a Unix socket to accept jobs on"`
+    MaxJobs     int64       `option:"maximum number of jobs running at the same time, other jobs wait in a queue, default is the number of CPUs" min:"1"`
+    ClientUid   []int64     `option:"allow clients with this UID to connect, the UID of the server is always allowed" multiple:"yes" min:"0"`
+    Verbose     bool        `option:"log connections and jobs"`
+}
+
+/* guarddog judge -input=FILE -expected=FILE -- command [args] */
+type JudgeOptions struct {
+    ConfigFileOptions
+    SandboxOptions
+    PolicyOptions
+    Input       string      `option:"file given to the program as stdin"`
+    Expected    string      `option:"file with the expected output"`
+    Output      string      `option:"keep the output of the program in this file, by default it is removed after checking"`
+    TimeLimit   time.Duration `option:"limit of user and system CPU time, e.g. 1s or 500ms"`
+    WallTimeLimit time.Duration `option:"kill the program after this time, default is twice time-limit"`
+    MemoryLimit ByteSize    `option:"limit of peak resident set size of the program, e.g. 256M"`
+    OutputLimit ByteSize    `option:"maximum size of the output" min:"1"`
+    Checker     string      `option:"how to compare the output: exact (byte by byte), tokens (ignoring whitespace) or float (tokens, numbers may differ by epsilon)" enum:"exact,tokens,float"`
+    Epsilon     float64     `option:"maximum absolute or relative difference of numbers for the float checker" min:"0"`
+    Command     []string    `tail:"yes"`
+}
+
+/* Values for PolicyDiffOptions.Format */
+const (
+    DIFF_FORMAT_TEXT = "text"
+    DIFF_FORMAT_JSON = "json"
+)
+
+/* Values for PolicyFromStraceOptions.Format */
+const (
+    STRACE_FORMAT_CONFIG = "config"
+    STRACE_FORMAT_POLICY = "policy"
+)
+
+func NewPolicyExportOptions() *PolicyExportOptions {
+    opt := new(PolicyExportOptions)
+    opt.PolicyOptions = *NewPolicyOptions()
+    return opt
+}
+
+func NewPolicyTestOptions() *PolicyTestOptions {
+    opt := new(PolicyTestOptions)
+    opt.PolicyOptions = *NewPolicyOptions()
+    return opt
+}
+
+func NewPolicyDiffOptions() *PolicyDiffOptions {
+    opt := new(PolicyDiffOptions)
+    opt.Format = DIFF_FORMAT_TEXT
+    return opt
+}
+
+func NewPolicyFromStraceOptions() *PolicyFromStraceOptions {
+    opt := new(PolicyFromStraceOptions)
+    opt.Format = STRACE_FORMAT_CONFIG
+    return opt
+}
+
+func NewServeOptions() *ServeOptions {
+    opt := new(ServeOptions)
+    opt.SandboxOptions = *NewSandboxOptions()
+    opt.MaxJobs = int64(runtime.NumCPU())
+    return opt
+}
+
+func NewJudgeOptions() *JudgeOptions {
+    opt := new(JudgeOptions)
+    opt.SandboxOptions = *NewSandboxOptions()
+    opt.PolicyOptions = *NewPolicyOptions()
+    opt.OutputLimit = 64 << 20
+    opt.Checker = "tokens"
+    opt.Epsilon = 1e-6
+    return opt
+}
+
+func (opt *SyscallsOptions) Validate() error {
+    return nil
+}
+
+func (opt *PolicyExportOptions) Validate() error {
+    errs := ValidateOptions(opt, NewPolicyExportOptions())
+
+    if !containsString(policy.ExportFormats, opt.Format) {
+        errs = append(errs, fmt.Errorf("format must be one of: %s", strings.Join(policy.ExportFormats, ", ")))
+    }
+
+    return validationResult(append(errs, opt.PolicyOptions.check()...))
+}
+
+func (opt *PolicyTestOptions) Validate() error {
+    errs := ValidateOptions(opt, NewPolicyTestOptions())
+
+    if len(opt.Call) == 0 {
+        errs = append(errs, errors.New("syscall name is not specified"))
+    }
+
+    if len(opt.Call) > policy.MAX_ARGS + 1 {
+        errs = append(errs, fmt.Errorf("a syscall can have at most %d arguments", policy.MAX_ARGS))
+    }
+
+    return validationResult(append(errs, opt.PolicyOptions.check()...))
+}
+
+func (opt *PolicyDiffOptions) Validate() error {
+    errs := ValidateOptions(opt, NewPolicyDiffOptions())
+
+    if len(opt.Files) != 2 {
+        errs = append(errs, errors.New("two files to compare must be given"))
+    }
+
+    return validationResult(errs)
+}
+
+func (opt *PolicyFromStraceOptions) Validate() error {
+    errs := ValidateOptions(opt, NewPolicyFromStraceOptions())
+
+    if opt.InferArgs && opt.Format != STRACE_FORMAT_POLICY {
+        errs = append(errs, fmt.Errorf("infer-args requires format %s", STRACE_FORMAT_POLICY))
+    }
+
+    if len(opt.Files) != 1 {
+        errs = append(errs, errors.New("a single strace log file must be given, use '-' for stdin"))
+    }
+
+    return validationResult(errs)
+}
+
+func (opt *ServeOptions) Validate() error {
+    errs := ValidateOptions(opt, NewServeOptions())
+
+    if opt.Socket == "" {
+        errs = append(errs, errors.New("socket is not specified"))
+    }
+
+    if opt.UsesUidPool() && opt.UidPool.Max - opt.UidPool.Min + 1 < opt.MaxJobs {
+        errs = append(errs, fmt.Errorf("uid-pool %s has less ids than max-jobs %d", opt.UidPool, opt.MaxJobs))
+    }
+
+    return validationResult(append(errs, opt.SandboxOptions.check()...))
+}
+
+func (opt *JudgeOptions) Validate() error {
+    errs := ValidateOptions(opt, NewJudgeOptions())
+
+    if opt.Input == "" || opt.Expected == "" {
+        errs = append(errs, errors.New("input and expected files must be given"))
+    }
+
+    if opt.TimeLimit <= 0 || opt.MemoryLimit <= 0 {
+        errs = append(errs, errors.New("time-limit and memory-limit must be set to positive values"))
+    }
+
+    if opt.WallTimeLimit < 0 {
+        errs = append(errs, errors.New("wall-time-limit cannot be negative"))
+    }
+
+    if len(opt.Command) == 0 {
+        errs = append(errs, errors.New("command is not specified"))
+    }
+
+    errs = append(errs, opt.SandboxOptions.check()...)
+    return validationResult(append(errs, opt.PolicyOptions.check()...))
+}
+
+func (opt *CheckOptions) Validate() error {
+    if len(opt.Files) == 0 {
+        return errors.New("no config files given")
+    }
+
+    return nil
+}
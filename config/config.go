@@ -4,24 +4,113 @@ import (
     "errors"
     "fmt"
     "flag"
+    "io"
     "os"
     "reflect"
     "strconv"
+    "strings"
 )
 
 const PROGRAM_NAME = "guarddog"
 
+/* 
+    System-wide config read before the file given with -config-file,
+    commands with -no-default-config option read it
+ */
+var DefaultConfigFile = "/etc/guarddog/guarddog.conf"
+
 type configuration struct {
     flagSet *flag.FlagSet
     optionList *OptionList
+    /* usage line without program name, e.g. "run [options] -- command [args]" */
+    usage string
+    preface string
+    /* 
+        Options of run command that can be present in config files 
+        of other commands and are skipped there 
+     */
+    runOptions *OptionList
+    /* values set while parsing by option name, with their origins */
+    values map[string][]OptionValue
+    /* warnings about deprecated options found while parsing */
+    warnings []string
+}
+
+/* 
+    Value of an option and where it comes from: ORIGIN_DEFAULT,
+    "file.conf:3", "env GUARDDOG_ALLOW" or ORIGIN_CLI
+ */
+type OptionValue struct {
+    Value       string
+    Origin      string
+}
+
+const (
+    ORIGIN_DEFAULT = "default"
+    ORIGIN_CLI = "CLI"
+)
+
+/* Prefix of environment variables, GUARDDOG_SET_UID sets -set-uid */
+const ENV_PREFIX = "GUARDDOG_"
+
+/* 
+    Error in CLI arguments, flag package has already printed 
+    it along with usage
+ */
+type ArgumentsError struct {
+    err error
+}
+
+func (e *ArgumentsError) Error() string {
+    return fmt.Sprintf("invalid CLI arguments: %s", e.err)
 }
 
+const runUsage = "[run] [options] -- command [args]"
+
+const runPreface = `
+Guarddog is an utility that executes a program while restricting a set of system calls it is allowed to make. Guarddog is also able to chroot(2) into a given directory and change user and group ids before running the program.
+
+Guarddog uses seccomp(2) with SECCOMP_SET_MODE_FILTER option to put a restriction so the kernel must support it. On attempt to make a call not specified in a list of allowed calls the kernel sends a SIGKILL signal that terminates the program.
+
+Guarddog doesn't search for an executable in PATH. You should specify an absolute path to a program.
+
+Other commands are:
+
+    syscalls                print syscalls and groups available on this system
+    policy export           print the policy in a format used by other sandboxes
+    policy test             check whether a policy allows a syscall
+    policy diff             compare two policies
+    policy from-strace      generate a policy from a strace log
+    check, check-config     validate config files and warn about likely mistakes
+    serve                   run jobs sent over a Unix socket
+    judge                   run a program on a test and print a verdict like OK or TLE
+
+Run "guarddog COMMAND -help" to see options of a command.
+`
+
+/* Returns a parser for options of the run command */
 func NewConfigurationParser() *configuration {
+    cfg := NewCommandParser(runUsage, &GuarddogOptions{})
+    cfg.preface = runPreface
+    cfg.runOptions = nil
+    return cfg
+}
+
+/* 
+    Returns a parser for a command with options described by given
+    pointer to a struct, see GuarddogOptions for supported tags. Config 
+    files may also contain options of the run command, they are skipped.
+ */
+func NewCommandParser(usage string, options interface{}) *configuration {
     cfg := new(configuration)
+    cfg.usage = usage
+    cfg.values = make(map[string][]OptionValue)
 
     cfg.optionList = NewOptionList()
-    structType := reflect.TypeOf((*GuarddogOptions)(nil)).Elem()
-    cfg.optionList.AddFromStruct(structType)
+    cfg.optionList.AddFromStruct(reflect.TypeOf(options).Elem())
+
+    cfg.runOptions = NewOptionList()
+    cfg.runOptions.AddFromStruct(reflect.TypeOf(GuarddogOptions{}))
 
     cfg.flagSet = createFlagSet(cfg.optionList)
     cfg.flagSet.Usage = func () {
@@ -36,41 +125,104 @@ func (cfg *configuration) testDisableUsage() {
 }
 
 func (cfg *configuration) PrintUsage() {
-    const preface=`
-Guarddog is an utility that executes a program while restricting a set of system calls it is allowed to make. Guarddog is also able to chroot(2) into a given directory and change user and group ids before running the program.
+    if cfg.preface != "" {
+        fmt.Fprintf(os.Stderr, "%s\n\n", cfg.preface)
+    }
+    fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], cfg.usage)
+    fmt.Fprintf(os.Stderr, "Options:\n")
+    cfg.printOptions(os.Stderr)
+}
 
-Guarddog uses seccomp(2) with SECCOMP_SET_MODE_FILTER option to put a restriction so the kernel must support it. On attempt to make a call not specified in a list of allowed calls the kernel sends a SIGKILL signal that terminates the program.
+/* Prints options like flag.PrintDefaults with names of value types */
+func (cfg *configuration) printOptions(w io.Writer) {
+    for _, name := range cfg.optionList.Names() {
+        option := cfg.optionList.Lookup(name)
 
-Guarddog doesn't search for an executable in PATH. You should specify an absolute path to a program.
-`
-    fmt.Fprintf(os.Stderr, "%s\n\n", preface)
-    fmt.Fprintf(os.Stderr, "Usage: %s [options] -- command [args]\n", os.Args[0])
-    fmt.Fprintf(os.Stderr, "Options:\n")
-    cfg.flagSet.PrintDefaults()
+        line := "  -" + name
+        if typeName := optionTypeName(option); typeName != "" {
+            line += " " + typeName
+        }
+        if option.IsMultiple {
+            line += " (repeatable)"
+        }
+
+        desc := option.Desc
+        if option.Deprecated != "" && len(option.Aliases) == 0 {
+            desc += " (deprecated, " + option.Deprecated + ")"
+        }
+
+        fmt.Fprintf(w, "%s\n    \t%s\n", line, strings.Replace(desc, "\n", "\n    \t", -1))
+    }
 }
 
 func (cfg *configuration) ParseNoValidate(args []string) (*GuarddogOptions, error) {
     opt := NewGuarddogOptions()
-    err := cfg.flagSet.Parse(args)
+    err := cfg.ParseInto(opt, args)
     if err != nil {
-        return nil, fmt.Errorf("invalid CLI arguments: %s", err)
+        return nil, err
+    }
+
+    return opt, nil
+}
+
+/* 
+    Fills a pointer to options struct from CLI args and a config file
+    given with -config-file, if the command has this option. Arguments
+    after options are saved into a field with `tail` tag.
+ */
+func (cfg *configuration) ParseInto(opt interface{}, args []string) error {
+    err := cfg.flagSet.Parse(args)
+    if err == flag.ErrHelp {
+        return err
+    } else if err != nil {
+        return &ArgumentsError{err}
+    }
+
+    section := ""
+    if containsFlag(cfg.flagSet, "config-section") {
+        section = cfg.flagSet.Lookup("config-section").Value.String()
+    }
+    sectionFound := false
+
+    /* System-wide defaults go first, so user config and CLI args override them */
+    if cfg.optionList.Contains("no-default-config") && !containsFlag(cfg.flagSet, "no-default-config") {
+        sectionFound, err = cfg.parseDefaultConfigFile(opt, section)
+        if err != nil {
+            return fmt.Errorf("error in config file '%s': %s", DefaultConfigFile, err)
+        }
     }
 
     /* If a config is given, read it */
     if containsFlag(cfg.flagSet, "config-file") {
         configName := cfg.flagSet.Lookup("config-file").Value.String()
 
-        err = cfg.ParseConfigFile(opt, configName)
+        found, err := cfg.ParseConfigFileSection(opt, configName, section)
         if err != nil {
-            return nil, 
-                fmt.Errorf("error in config file '%s': %s", configName, err)
+            return fmt.Errorf("error in config file '%s': %s", configDisplayName(configName), err)
         }
+        sectionFound = sectionFound || found
+    }
 
-        opt.ConfigFile = configName
+    /* A config generated by a parent process and passed as a pipe */
+    if containsFlag(cfg.flagSet, "config-fd") {
+        found, err := cfg.parseConfigFd(opt, cfg.flagSet.Lookup("config-fd").Value.String(), section)
+        if err != nil {
+            return err
+        }
+        sectionFound = sectionFound || found
     }
 
-    cfg.updateOptionsFromFlagSet(opt, cfg.flagSet)
-    return opt, nil
+    if section != "" && !sectionFound {
+        return fmt.Errorf("section '%s' is not found in config files", section)
+    }
+
+    /* Environment overrides config files, CLI args override both */
+    err = cfg.parseEnvironment(opt)
+    if err != nil {
+        return err
+    }
+
+    return cfg.updateOptionsFromFlagSet(opt, cfg.flagSet)
 }
 
 func (cfg *configuration) Parse(args []string) (*GuarddogOptions, error) {
@@ -90,38 +242,307 @@ func (cfg *configuration) Parse(args []string) (*GuarddogOptions, error) {
     return opt, nil
 }
 
-func (cfg* configuration) ParseConfigFile(opt *GuarddogOptions, fileName string) error {
+/* Reads DefaultConfigFile if it exists */
+func (cfg *configuration) parseDefaultConfigFile(opt interface{}, section string) (bool, error) {
+    if _, err := os.Stat(DefaultConfigFile); os.IsNotExist(err) {
+        return false, nil
+    }
+
+    return cfg.ParseConfigFileSection(opt, DefaultConfigFile, section)
+}
+
+/* Reads a config from a file descriptor given as a string and closes it */
+func (cfg *configuration) parseConfigFd(opt interface{}, fdString string, section string) (bool, error) {
+    fd, err := strconv.Atoi(fdString)
+    if err != nil || fd < 0 {
+        return false, fmt.Errorf("invalid config file descriptor '%s'", fdString)
+    }
+
+    // Closing stdio would take it away from the program
+    if fd < 3 {
+        return false, fmt.Errorf("config file descriptor must be at least 3, got %d", fd)
+    }
+
+    name := fmt.Sprintf("<fd %d>", fd)
+    file := os.NewFile(uintptr(fd), name)
+    defer file.Close()
+
+    found, err := cfg.ParseConfigReaderSection(opt, file, name, section)
+    if err != nil {
+        return false, fmt.Errorf("error in config file '%s': %s", name, err)
+    }
+
+    return found, nil
+}
+
+/* Key and value read from a config file */
+type configEntry struct {
+    fileName    string
+    lineNumber  int
+    section     string
+    key         string
+    values      []string
+}
+
+/* Reads global options from a config file, sections are skipped */
+func (cfg* configuration) ParseConfigFile(opt interface{}, fileName string) error {
+    _, err := cfg.ParseConfigFileSection(opt, fileName, "")
+    return err
+}
+
+/* 
+    Reads global options from a config file and then options from given
+    section and sections it inherits, returns false if there is no such
+    section. Options are checked while reading files, so errors contain
+    the chain of included files.
+ */
+func (cfg* configuration) ParseConfigFileSection(opt interface{}, fileName string, section string) (bool, error) {
 
     if fileName == "" {
-        return errors.New("config file name cannot be empty")
+        return false, errors.New("config file name cannot be empty")
+    }
+
+    return cfg.parseConfigSection(opt, section, func (visitor ConfigFileVisitor) error {
+        return ParseConfigWithIncludes(fileName, visitor)
+    })
+}
+
+/* 
+    Same as ParseConfigFileSection, but reads a config from a reader like
+    a pipe, name is used in errors, e.g. "<fd 3>"
+ */
+func (cfg* configuration) ParseConfigReaderSection(opt interface{}, reader io.Reader, name string, section string) (bool, error) {
+    return cfg.parseConfigSection(opt, section, func (visitor ConfigFileVisitor) error {
+        return ParseConfigReaderWithIncludes(reader, name, visitor)
+    })
+}
+
+/* Reads options with a function that parses a config with given visitor */
+func (cfg* configuration) parseConfigSection(opt interface{}, section string, parse func (ConfigFileVisitor) error) (bool, error) {
+    var entries []configEntry
+    err := parse(func (file string, fileSection string, key string, values []string, num int) error {
+        if key == CONFIG_INHERIT_KEY {
+            if fileSection == "" {
+                return fmt.Errorf("option %s can be used only in a section", key)
+            }
+            if len(values) > 1 {
+                return fmt.Errorf("option %s takes a single section name", key)
+            }
+        } else if err := cfg.checkConfigOption(key, values); err != nil {
+            return err
+        } else if !cfg.optionList.Contains(key) {
+            // Option of the run command
+            return nil
+        }
+
+        entries = append(entries, configEntry{file, num, fileSection, key, values})
+        return nil
+    })
+
+    if err != nil {
+        return false, err
     }
 
-    file, err := os.Open(fileName)
+    sections, err := sectionChain(entries, section)
     if err != nil {
-        return err
+        return false, err
     }
-    defer file.Close()
 
-    err = ParseConfig(file, func (key string, value string, num int) error {                
-        if ! cfg.optionList.Contains(key) {
-            return fmt.Errorf("invalid config option '%s'", key)
+    // Global keys are applied even if this file has no such section
+    found := sections != nil
+    if !found {
+        sections = []string{""}
+    }
+
+    for _, name := range sections {
+        for _, entry := range entries {
+            if entry.section != name || entry.key == CONFIG_INHERIT_KEY {
+                continue
+            }
+
+            origin := fmt.Sprintf("%s:%d", entry.fileName, entry.lineNumber)
+            option := cfg.optionList.Lookup(entry.key)
+            cfg.checkDeprecated(option, entry.key, origin)
+
+            for _, value := range entry.values {
+                if err := cfg.setOptionAs(opt, option, entry.key, value, origin); err != nil {
+                    return false, fmt.Errorf("%s: cannot parse option '%s': %s", origin, entry.key, err)
+                }
+            }
+        }
+    }
+
+    return found, nil
+}
+
+/* 
+    Reads options from GUARDDOG_<NAME> variables, values have the same
+    syntax as in config files
+ */
+func (cfg *configuration) parseEnvironment(opt interface{}) error {
+    var err error
+
+    cfg.optionList.VisitAll(func (optionName string, option *Option) {
+        // Old names go first, so the current name overrides them
+        for _, key := range append(append([]string{}, option.Aliases...), optionName) {
+            name := envVariableName(key)
+            value, isSet := os.LookupEnv(name)
+            if !isSet || err != nil {
+                continue
+            }
+
+            cfg.checkDeprecated(option, key, "env " + name)
+            values, parseErr := parseConfigValues(value)
+            if parseErr == nil {
+                parseErr = cfg.checkConfigOption(key, values)
+            }
+
+            for i := 0; parseErr == nil && i < len(values); i++ {
+                parseErr = cfg.setOptionAs(opt, option, key, values[i], "env " + name)
+            }
+
+            if parseErr != nil {
+                err = fmt.Errorf("error in environment variable %s: %s", name, parseErr)
+            }
         }
+    })
+
+    return err
+}
+
+/* Remembers a warning if an option is used under a deprecated name */
+func (cfg *configuration) checkDeprecated(option *Option, name string, origin string) {
+    if warning := option.deprecationWarning(name); warning != "" {
+        cfg.warnings = append(cfg.warnings, fmt.Sprintf("%s: %s", origin, warning))
+    }
+}
+
+/* Returns values of an option set while parsing, with their origins */
+func (cfg *configuration) OptionValues(name string) []OptionValue {
+    return cfg.values[name]
+}
+
+/* 
+    Returns warnings found while parsing, e.g. about deprecated options,
+    callers print them with util.Logger once it is created
+ */
+func (cfg *configuration) Warnings() []string {
+    return cfg.warnings
+}
+
+/* Returns a name of environment variable for an option, e.g. GUARDDOG_SET_UID */
+func envVariableName(optionName string) string {
+    return ENV_PREFIX + strings.ToUpper(strings.Replace(optionName, "-", "_", -1))
+}
+
+/* Updates an option from a string and remembers where the value comes from */
+func (cfg *configuration) setOption(opt interface{}, option *Option, value string, origin string) error {
+    err := updateOptionFromString(opt, option, value)
+    if err != nil {
+        return err
+    }
+
+    cfg.addValue(option, value, origin)
+    return nil
+}
+
+/* Same as setOption for a value given under a name of the option or its alias */
+func (cfg *configuration) setOptionAs(opt interface{}, option *Option, name string, value string, origin string) error {
+    values, err := option.valuesFor(name, value)
+    for i := 0; err == nil && i < len(values); i++ {
+        err = cfg.setOption(opt, option, values[i], origin)
+    }
+    return err
+}
 
-        option := cfg.optionList.Lookup(key)
+func (cfg *configuration) addValue(option *Option, value string, origin string) {
+    optionValue := OptionValue{Value: value, Origin: origin}
+    if option.IsMultiple {
+        cfg.values[option.OptionName] = append(cfg.values[option.OptionName], optionValue)
+    } else {
+        cfg.values[option.OptionName] = []OptionValue{optionValue}
+    }
+}
 
-        if option.IsCliOnly {
-            return fmt.Errorf("option %s can be used only in CLI args", key)
+/* Returns an error if a key cannot be used in config files of the command */
+func (cfg *configuration) checkConfigOption(key string, values []string) error {
+    if ! cfg.optionList.Contains(key) {
+        if cfg.runOptions != nil && cfg.runOptions.Contains(key) {
+            return nil
         }
+        return fmt.Errorf("invalid config option '%s'", key)
+    }
+
+    option := cfg.optionList.Lookup(key)
 
-        err := updateOptionFromString(opt, option, value)
+    if option.IsCliOnly {
+        return fmt.Errorf("option %s can be used only in CLI args", key)
+    }
+
+    if len(values) > 1 && !option.IsMultiple {
+        return fmt.Errorf("option %s takes a single value, quote it if it contains commas", key)
+    }
+
+    for _, value := range values {
+        converted, err := option.valuesFor(key, value)
+        for i := 0; err == nil && i < len(converted); i++ {
+            _, err = parseStringValue(option, converted[i])
+        }
         if err != nil {
             return fmt.Errorf("cannot parse option '%s': %s", key, err)
         }
+    }
+
+    return nil
+}
+
+/* 
+    Returns sections to apply in order: global options, inherited 
+    sections and the section itself. Returns nil if there is no
+    such section.
+ */
+func sectionChain(entries []configEntry, section string) ([]string, error) {
+    chain := []string{}
+    for name := section; name != ""; {
+        if containsString(chain, name) {
+            return nil, fmt.Errorf("sections inherit each other: %s -> %s",
+                strings.Join(chain, " -> "), name)
+        }
 
-        return nil
-    })
+        found := false
+        parent := ""
+        for _, entry := range entries {
+            if entry.section != name {
+                continue
+            }
+
+            found = true
+            if entry.key == CONFIG_INHERIT_KEY {
+                if parent != "" {
+                    return nil, fmt.Errorf("%s: line %d: section '%s' already inherits '%s'",
+                        entry.fileName, entry.lineNumber, name, parent)
+                }
+                parent = entry.values[0]
+            }
+        }
 
-    return err
+        if !found && name == section {
+            return nil, nil
+        } else if !found {
+            return nil, fmt.Errorf("section '%s' inherits unknown section '%s'",
+                chain[len(chain) - 1], name)
+        }
+
+        chain = append(chain, name)
+        name = parent
+    }
+
+    result := []string{""}
+    for i := len(chain) - 1; i >= 0; i-- {
+        result = append(result, chain[i])
+    }
+
+    return result, nil
 }
 
 func createFlagSet(options *OptionList) *flag.FlagSet {
@@ -132,103 +553,92 @@ func createFlagSet(options *OptionList) *flag.FlagSet {
     return flagSet
 }
 
+/* Adds a flag for an option and its aliases, they share values to keep their order */
 func addOption(flagSet *flag.FlagSet, option *Option) {
+    value := &optionFlag{option: option}
+    flagSet.Var(value, option.OptionName, option.Desc)
 
-    optionName := option.OptionName
-    desc := option.Desc
-    isMultiple := option.IsMultiple
-
-    switch option.Kind {
-
-    case reflect.Bool:
-        if (isMultiple) {
-            panic(fmt.Sprintf("multibool not implemented, option %s", optionName))
-        } else {
-            flagSet.Bool(optionName, false, desc)
-        }
-
-    case reflect.Float64:
-        if (isMultiple) {
-            panic(fmt.Sprintf("multifloat not implemented, option %s", optionName))
-        } else {
-            flagSet.Float64(optionName, 0, desc)
-        }
-
-    case reflect.Int64:
-        if (isMultiple) {
-            list := new(intListFlag)
-            flagSet.Var(list, optionName, desc)
-        } else {
-            flagSet.Int64(optionName, 0, desc)
-        }
-
-    case reflect.String:
-        if (isMultiple) {
-            list := new(stringListFlag)
-            flagSet.Var(list, optionName, desc)
+    for _, alias := range option.Aliases {
+        if _, isSwitch := option.SwitchValues[alias]; isSwitch {
+            flagSet.Var(&switchFlag{name: alias, target: value}, alias, option.Desc)
         } else {
-            flagSet.String(optionName, "", desc)
+            flagSet.Var(value, alias, option.Desc)
         }
-
-    default:
-        panic(fmt.Sprintf("Unknown kind of options %s", option.Kind))
     }
 }
 
-func (cfg *configuration) updateOptionsFromFlagSet(opt *GuarddogOptions, flagSet *flag.FlagSet) {
+func (cfg *configuration) updateOptionsFromFlagSet(opt interface{}, flagSet *flag.FlagSet) error {
 
     options := cfg.optionList
+    var err error
+    isApplied := make(map[*Option]bool)
 
     flagSet.Visit(func (f *flag.Flag) {
         
-        if ! options.Contains(f.Name) {
+        if ! options.Contains(f.Name) || err != nil {
             return
         }
 
         // Find and update  matching struct field
         option := options.Lookup(f.Name)
+        cfg.checkDeprecated(option, f.Name, ORIGIN_CLI)
 
-        if option.IsMultiple {
-            updateMultipleOptionField(opt, option, f.Value)
-        } else {
-            updateOptionField(opt, option, f.Value)
+        // An option and its aliases share values
+        if isApplied[option] {
+            return
+        }
+        isApplied[option] = true
+
+        // Switch aliases add their values to the flag of the option
+        for _, value := range flagSet.Lookup(option.OptionName).Value.(*optionFlag).values {
+            if err = cfg.setOption(opt, option, value, ORIGIN_CLI); err != nil {
+                err = fmt.Errorf("cannot parse option '%s': %s", f.Name, err)
+                return
+            }
         }
     })
 
-    // Save tail as command
-    opt.Command = flagSet.Args()
-}
+    if err != nil {
+        return err
+    }
 
-func updateOptionField(opt *GuarddogOptions, option *Option, v flag.Value) {
-    value := reflect.ValueOf(v.(flag.Getter).Get())
-    target := getFieldForOption(opt, option)
-    target.Set(value)
+    // Save tail, for example a command to run
+    tail := reflect.ValueOf(opt).Elem().FieldByName(cfg.optionList.TailField)
+    if tail.IsValid() {
+        tail.Set(reflect.ValueOf(flagSet.Args()))
+    } else if flagSet.NArg() > 0 {
+        return fmt.Errorf("unexpected argument '%s'", flagSet.Arg(0))
+    }
+
+    return nil
 }
 
-func getFieldForOption(opt *GuarddogOptions, option *Option) reflect.Value {
+func getFieldForOption(opt interface{}, option *Option) reflect.Value {
     structValue := reflect.ValueOf(opt).Elem()
     fieldValue := structValue.FieldByName(option.FieldName)
 
     return fieldValue
 }
 
-func updateMultipleOptionField(opt *GuarddogOptions, option *Option, v flag.Value) {
-    target := getFieldForOption(opt, option)
-    multiValue := v.(flag.Getter).Get()
-    listValue := reflect.ValueOf(multiValue)
-    newValue := reflect.AppendSlice(target, listValue)
-    target.Set(newValue)
-}
-
-func updateOptionFromString(opt *GuarddogOptions, option *Option, value string) error {
+/* 
+    Sets a field from a string, values of multiple options are appended
+    and NAME=value pairs are added to maps
+ */
+func updateOptionFromString(opt interface{}, option *Option, value string) error {
 
     target := getFieldForOption(opt, option)
-    parsedValue, err := parseStringValue(option.Kind, value)
+    parsedValue, err := parseStringValue(option, value)
     if err != nil {
         return err
     }
 
-    if option.IsMultiple {
+    if option.Type.Kind() == reflect.Map {
+        key, item, _ := parseKeyValue(value)
+        if target.IsNil() {
+            target.Set(reflect.MakeMap(option.Type))
+        }
+        target.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(item))
+    } else if option.IsMultiple {
         newTarget := reflect.Append(target, parsedValue)
         target.Set(newTarget)
     } else {
@@ -238,24 +648,6 @@ func updateOptionFromString(opt *GuarddogOptions, option *Option, value string)
     return nil
 }
 
-func parseStringValue(kind reflect.Kind, value string) (reflect.Value, error) {
-    switch kind {
-        case reflect.Int64:
-            i, err := strconv.ParseInt(value, 10, 64)
-            return reflect.ValueOf(i), err
-        case reflect.Float64:
-            f, err := strconv.ParseFloat(value, 64)
-            return reflect.ValueOf(f), err
-        case reflect.Bool: 
-            b, err := strconv.ParseBool(value)
-            return reflect.ValueOf(b), err
-        case reflect.String:
-            return reflect.ValueOf(value), nil
-    }
-
-    panic(fmt.Sprintf("Unknown kind: '%s'", kind))
-}
-
 func containsFlag(flagSet *flag.FlagSet, name string) bool {
     
     var contains bool
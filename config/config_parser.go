@@ -5,34 +5,177 @@ import (
     "errors"
     "io"
     "fmt"
+    "os"
+    "path/filepath"
     "strings"
 )
 
+/*
+    Config files contain lines like "key = value". Syntax of values:
+
+        allow = read, write, openat     several values separated by commas
+        chroot-path = "/srv/a, b"       quoted value, commas are not separators
+        preface = "line\n\"quoted\""    escapes \\ \" \n \t \r in double quotes
+        name = 'no \escapes'            single quotes keep text as is
+        verbose = true  # comment       comment after a space outside quotes
+        allow = read, \
+            write                       a line ending with \ is continued
+
+    Quotes are recognized only at the beginning of a value, so
+    a value like it's is read as is.
+ */
 type ConfigVisitor func(key string, value string, lineNumber int) error
 
+/*
+    Visitor for keys with all values from a comma separated list,
+    section is empty for keys before the first [section] header
+ */
+type ConfigSectionVisitor func(section string, key string, values []string, lineNumber int) error
+
+/* Same as ConfigSectionVisitor, but also receives a name of an included file */
+type ConfigFileVisitor func(fileName string, section string, key string, values []string, lineNumber int) error
+
+/* Name of -config-file that reads a config from stdin */
+const CONFIG_STDIN_NAME = "-"
+
+/* Key that reads options from another file: "include = path" */
+const CONFIG_INCLUDE_KEY = "include"
+
+/* Key that applies keys of another section first: "inherit = name" */
+const CONFIG_INHERIT_KEY = "inherit"
+
+/*
+    Parses a config file and files included from it. Relative paths
+    are resolved against the directory of the including file. Errors
+    in included files contain the whole chain of includes, e.g.
+    "line 3: in included file 'b.conf': line 1: ..."
+
+    Keys before the first header of an included file belong
+    to the section where "include" is written.
+ */
+func ParseConfigWithIncludes(fileName string, visitor ConfigFileVisitor) error {
+    if fileName == CONFIG_STDIN_NAME {
+        return ParseConfigReaderWithIncludes(os.Stdin, configDisplayName(fileName), visitor)
+    }
+
+    return parseConfigFile(fileName, "", visitor, nil)
+}
+
+/* 
+    Same as ParseConfigWithIncludes for a config that is not a file,
+    e.g. stdin. Name like "<stdin>" is passed to the visitor, relative
+    paths of included files are resolved against the current directory.
+ */
+func ParseConfigReaderWithIncludes(reader io.Reader, name string, visitor ConfigFileVisitor) error {
+    return parseConfigReader(reader, name, ".", "", visitor, nil)
+}
+
+/* Returns a name of a config file for messages, "<stdin>" for "-" */
+func configDisplayName(fileName string) string {
+    if fileName == CONFIG_STDIN_NAME {
+        return "<stdin>"
+    }
+    return fileName
+}
+
+func parseConfigFile(fileName string, section string, visitor ConfigFileVisitor, includedFrom []string) error {
+    absName, err := filepath.Abs(fileName)
+    if err != nil {
+        return err
+    }
+
+    for _, name := range includedFrom {
+        if name == absName {
+            return errors.New("config files include each other")
+        }
+    }
+
+    file, err := os.Open(fileName)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    return parseConfigReader(file, fileName, filepath.Dir(fileName), section, visitor, append(includedFrom, absName))
+}
+
+/* Parses a config, includes are resolved against dir */
+func parseConfigReader(reader io.Reader, fileName string, dir string, section string,
+        visitor ConfigFileVisitor, includedFrom []string) error {
+
+    return ParseConfigSections(reader, func (fileSection string, key string, values []string, lineNumber int) error {
+        if fileSection == "" {
+            fileSection = section
+        }
+
+        if key != CONFIG_INCLUDE_KEY {
+            return visitor(fileName, fileSection, key, values, lineNumber)
+        }
+
+        for _, includedName := range values {
+            if !filepath.IsAbs(includedName) {
+                includedName = filepath.Join(dir, includedName)
+            }
+
+            err := parseConfigFile(includedName, fileSection, visitor, includedFrom)
+            if err != nil {
+                return fmt.Errorf("in included file '%s': %s", includedName, err)
+            }
+        }
+
+        return nil
+    })
+}
+
+/* Parses a config without sections, visitor is called for every value of a list */
 func ParseConfig(reader io.Reader, visitor ConfigVisitor) error {
+    return ParseConfigSections(reader, func (section string, key string, values []string, lineNumber int) error {
+        if section != "" {
+            return fmt.Errorf("section [%s] is not allowed here", section)
+        }
+
+        for _, value := range values {
+            if err := visitor(key, value, lineNumber); err != nil {
+                return err
+            }
+        }
+
+        return nil
+    })
+}
+
+/*
+    Parses a config with INI-style [section] headers,
+    a section ends at the next header
+ */
+func ParseConfigSections(reader io.Reader, visitor ConfigSectionVisitor) error {
     bufReader := bufio.NewReader(reader)
     lineNumber := 1
+    section := ""
 
     for {
-        line, err := bufReader.ReadString('\n')
-        line = strings.TrimSpace(line)
+        // Line number of the first line if a line is continued
+        firstLineNumber := lineNumber
+        line, err := readConfigLine(bufReader, &lineNumber)
 
-        if !isConfigCommentOrEmpty(line) {
-            key, value, parseErr := parseConfigString(line)
+        if isConfigSectionHeader(line) {
+            section = strings.TrimSpace(line[1:strings.Index(line, "]")])
+            if section == "" {
+                return fmt.Errorf("syntax error: section name is empty at line %d", firstLineNumber)
+            }
+        } else if !isConfigCommentOrEmpty(line) {
+            key, values, parseErr := parseConfigString(line)
 
             if parseErr != nil {
-                return fmt.Errorf("syntax error: %s at line %d", parseErr, lineNumber)
+                return fmt.Errorf("syntax error: %s at line %d", parseErr, firstLineNumber)
             }
 
-            err := visitor(key, value, lineNumber)
+            err := visitor(section, key, values, firstLineNumber)
             if err != nil {
-                return fmt.Errorf("line %d: %s", lineNumber, err)
+                return fmt.Errorf("line %d: %s", firstLineNumber, err)
             }
         }
 
-        lineNumber++
-
         // err != nil means EOF or error
         if err == io.EOF {
             return nil
@@ -42,35 +185,166 @@ func ParseConfig(reader io.Reader, visitor ConfigVisitor) error {
     }
 }
 
+/*
+    Reads a trimmed line joined with following lines if it ends with
+    a backslash, increments lineNumber for every line read
+ */
+func readConfigLine(reader *bufio.Reader, lineNumber *int) (string, error) {
+    var parts []string
+
+    for {
+        line, err := reader.ReadString('\n')
+        line = strings.TrimSpace(line)
+        *lineNumber++
+
+        isContinued := strings.HasSuffix(line, `\`) && !isConfigCommentOrEmpty(line)
+        if !isContinued || err != nil {
+            return strings.Join(append(parts, line), " "), err
+        }
+
+        parts = append(parts, strings.TrimSpace(strings.TrimSuffix(line, `\`)))
+    }
+}
+
+func isConfigSectionHeader(line string) bool {
+    if !strings.HasPrefix(line, "[") {
+        return false
+    }
+
+    end := strings.Index(line, "]")
+    if end < 0 {
+        return false
+    }
+
+    rest := strings.TrimSpace(line[end + 1:])
+    return rest == "" || strings.HasPrefix(rest, "#")
+}
+
 func isConfigCommentOrEmpty(line string) bool {
     return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || line == ""
 }
 
-func parseConfigString(line string) (key string, value string, err error) {
+func parseConfigString(line string) (key string, values []string, err error) {
     parts := strings.SplitN(line, "=", 2)
     if len(parts) < 2 {
-        return "", "", errors.New("no equal sign")
+        return "", nil, errors.New("no equal sign")
     }
 
     key = strings.TrimSpace(parts[0])
-    value = strings.TrimSpace(parts[1])
 
     if key == "" {
-        return "", "", errors.New("key is empty")
+        return "", nil, errors.New("key is empty")
     }
 
-    value = removeQuotes(value)
+    values, err = parseConfigValues(parts[1])
+    if err != nil {
+        return "", nil, err
+    }
 
-    return key, value, nil
+    return key, values, nil
 }
 
-func removeQuotes(value string) string {
-    if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
-        value = value[1:len(value) - 1]
-    } else if strings.HasPrefix(value, `'`) && strings.HasSuffix(value, `'`) && len(value) > 1 {
-        value = value[1:len(value) - 1]
+/* Splits a value by commas outside quotes, removes quotes and comments */
+func parseConfigValues(s string) ([]string, error) {
+    var values []string
+    var value []byte
+    // Value was started by a non-space character or quotes
+    isStarted := false
+    // Value was closed by a quote, only a separator or a comment may follow
+    isQuoted := false
+    // Unquoted spaces that are kept only if they are inside a value
+    spaces := ""
+
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+
+        switch {
+        case c == ' ' || c == '\t':
+            spaces += string(c)
+            continue
+
+        case c == '#' && spaces != "":
+            i = len(s)
+            continue
+
+        case c == ',':
+            if !isStarted {
+                return nil, errors.New("empty value in a list")
+            }
+            values = append(values, string(value))
+            value = nil
+            isStarted = false
+            isQuoted = false
+            spaces = ""
+            continue
+
+        case isQuoted:
+            return nil, fmt.Errorf("unexpected '%c' after a quoted value", c)
+
+        case (c == '"' || c == '\'') && !isStarted:
+            quoted, length, err := parseQuotedConfigValue(s[i:])
+            if err != nil {
+                return nil, err
+            }
+            value = append(value, quoted...)
+            isQuoted = true
+            i += length - 1
+
+        default:
+            if isStarted {
+                value = append(value, spaces...)
+            }
+            value = append(value, c)
+        }
+
+        isStarted = true
+        spaces = ""
+    }
+
+    if !isStarted && len(values) > 0 {
+        return nil, errors.New("empty value in a list")
     }
 
-    return value
+    return append(values, string(value)), nil
 }
 
+/*
+    Parses a quoted string at the beginning of s,
+    returns its value and length with quotes
+ */
+func parseQuotedConfigValue(s string) (string, int, error) {
+    quote := s[0]
+    var value []byte
+
+    for i := 1; i < len(s); i++ {
+        c := s[i]
+        if c == quote {
+            return string(value), i + 1, nil
+        }
+
+        if c != '\\' || quote == '\'' {
+            value = append(value, c)
+            continue
+        }
+
+        i++
+        if i == len(s) {
+            break
+        }
+
+        switch s[i] {
+        case '\\', '"':
+            value = append(value, s[i])
+        case 'n':
+            value = append(value, '\n')
+        case 't':
+            value = append(value, '\t')
+        case 'r':
+            value = append(value, '\r')
+        default:
+            return "", 0, fmt.Errorf("unknown escape sequence '\\%c'", s[i])
+        }
+    }
+
+    return "", 0, fmt.Errorf("no closing quote %c", quote)
+}
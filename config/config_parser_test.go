@@ -39,6 +39,87 @@ func TestConfigWithErrors(t *testing.T) {
     testReturnsError(t, " = 1")
 }
 
+func TestConfigSections(t *testing.T) {
+    var keys []string
+    err := ParseConfigSections(strings.NewReader(`
+        a=1
+        [ build ]
+        b=2
+        [run]
+        c=3
+    `), func (section string, key string, values []string, lineNumber int) error {
+        keys = append(keys, fmt.Sprintf("%s:%s=%s", section, key, strings.Join(values, "|")))
+        return nil
+    })
+
+    if err != nil {
+        t.Fatalf("Parsing config returned error %s", err)
+    }
+
+    if strings.Join(keys, " ") != ":a=1 build:b=2 run:c=3" {
+        t.Errorf("Unexpected keys %v", keys)
+    }
+
+    // Empty section name
+    testReturnsError(t, "[ ]\na=1")
+
+    // Plain config cannot have sections
+    testReturnsError(t, "a=1\n[section]\nb=2")
+}
+
+func TestConfigValueSyntax(t *testing.T) {
+    testValues(t, `a = read, write,openat`, "read|write|openat")
+    testValues(t, `a = " x, y ", 'z'`, " x, y |z")
+    testValues(t, `a = "tab\t\"q\" \\"`, "tab\t\"q\" \\")
+    testValues(t, `a = 'c:\dir'`, `c:\dir`)
+    testValues(t, `a = it's`, "it's")
+    testValues(t, `a = x y  # comment, not a value`, "x y")
+    testValues(t, `a = #not-a-value`, "")
+    testValues(t, `a = x#y`, "x#y")
+    testValues(t, `a = "# quoted"  # comment`, "# quoted")
+    testValues(t, "a = read, \\\n  write, \\\n  openat\n", "read|write|openat")
+
+    testReturnsError(t, `a = "no end`)
+    testReturnsError(t, `a = "\q"`)
+    testReturnsError(t, `a = "x"y`)
+    testReturnsError(t, `a = x,,y`)
+    testReturnsError(t, `a = x,`)
+}
+
+func TestConfigContinuationLineNumbers(t *testing.T) {
+    lines := map[string]int{}
+    err := ParseConfig(strings.NewReader("a = 1, \\\n 2\n# comment \\\nb = 3\n"), func (key string, value string, n int) error {
+        lines[key + value] = n
+        return nil
+    })
+
+    if err != nil {
+        t.Fatalf("Parsing config returned error %s", err)
+    }
+
+    // A comment is not continued
+    if lines["a1"] != 1 || lines["a2"] != 1 || lines["b3"] != 4 {
+        t.Errorf("Unexpected line numbers %v", lines)
+    }
+}
+
+func testValues(t *testing.T, config string, expect string) {
+    var values []string
+    err := ParseConfig(strings.NewReader(config), func (key string, value string, n int) error {
+        values = append(values, value)
+        return nil
+    })
+
+    if err != nil {
+        t.Errorf("Parsing config %q returned error %s", config, err)
+        return
+    }
+
+    if strings.Join(values, "|") != expect {
+        t.Errorf("Expected to get %q from %q, got %q", expect, config, strings.Join(values, "|"))
+    }
+}
+
 func testReturnsError(t *testing.T, config string) {
     reader := strings.NewReader(config)
     collector, _ := createCollector()
@@ -2,11 +2,17 @@ package config
 
 import (
     "bufio"
+    "bytes"
     "fmt"
     "io/ioutil"
     "os"
+    "path/filepath"
+    "reflect"
     "sort"
+    "strings"
+    "syscall"
     "testing"
+    "time"
 )
 
 const TMP_DIR = "/tmp"
@@ -112,6 +118,51 @@ func TestCliOnlyOptions(t *testing.T) {
     }
 }
 
+func TestCommandParser(t *testing.T) {
+    name := createTmpFile(`
+        allow=read
+        verbose=true
+    `)
+
+    defer removeTmpFile(name)
+    args := []string {
+        "--config-file=" + name,
+        "--allow=write",
+        "write",
+        "1",
+    }
+
+    opt := NewPolicyTestOptions()
+    p := NewCommandParser("policy test", opt)
+    p.testDisableUsage()
+    err := p.ParseInto(opt, args)
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    // Options of embedded PolicyOptions are read, run options are skipped
+    assertListEqual(t, []string{"read", "write"}, opt.Allow)
+    assertListEqual(t, []string{"write", "1"}, opt.Call)
+}
+
+func TestCommandParserWithoutTail(t *testing.T) {
+    opt := new(SyscallsOptions)
+    p := NewCommandParser("syscalls", opt)
+    p.testDisableUsage()
+
+    if err := p.ParseInto(opt, []string{"--groups"}); err != nil || !opt.Groups {
+        t.Fatalf("expected Groups to be set, error: %v", err)
+    }
+
+    if err := p.ParseInto(opt, []string{"extra"}); err == nil {
+        t.Fatalf("expected to get error for unexpected argument")
+    }
+
+    if err := p.ParseInto(opt, []string{"--allow=read"}); err == nil {
+        t.Fatalf("expected to get error for an option of another command")
+    }
+}
+
 func assertListEqual(t *testing.T, a, b []string) {
     sort.Strings(a)
     sort.Strings(b)
@@ -157,4 +208,521 @@ func createParser() *configuration {
     p := NewConfigurationParser()
     p.testDisableUsage()
     return p
-}
\ No newline at end of file
+}
+func TestBuildPolicyWithProfile(t *testing.T) {
+    p := createParser()
+    opt, err := p.Parse([]string{"--profile=static-c", "--allow=@network", "--trap"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    policy, _, err := opt.BuildPolicy("amd64")
+    if err != nil {
+        t.Fatalf("failed to build policy: %s", err)
+    }
+
+    if policy.DefaultAction.String() != "trap" {
+        t.Fatalf("expected default action to be trap, got %s", policy.DefaultAction)
+    }
+
+    last := policy.Rules[len(policy.Rules) - 1]
+    if last.Syscall != "@network" {
+        t.Fatalf("expected -allow rules to come after profile rules, got %s", last)
+    }
+
+    if len(policy.Rlimits) == 0 {
+        t.Fatalf("expected profile to set rlimits")
+    }
+}
+
+func TestInvalidProfile(t *testing.T) {
+    p := createParser()
+    _, err := p.Parse([]string{"--profile=cobol"})
+    if err == nil {
+        t.Fatalf("expected to get error for unknown profile")
+    }
+}
+
+func TestBuildPolicyWithPolicyFile(t *testing.T) {
+    name := createTmpFile(`
+default-action: errno:EPERM
+allow: [read]
+rules:
+  - syscall: write
+    action: kill
+`)
+    defer removeTmpFile(name)
+
+    p := createParser()
+    opt, err := p.Parse([]string{"--policy=" + name, "--allow=write", "--trap"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    result, _, err := opt.BuildPolicy("amd64")
+    if err != nil {
+        t.Fatalf("failed to build policy: %s", err)
+    }
+
+    if result.DefaultAction.String() != "trap" {
+        t.Fatalf("expected -trap to override default action, got %s", result.DefaultAction)
+    }
+
+    last := result.Rules[len(result.Rules) - 1]
+    if last.Syscall != "write" || last.Action.String() != "allow" {
+        t.Fatalf("expected -allow rules to come last, got %s", last)
+    }
+}
+
+func TestConfigIncludes(t *testing.T) {
+    dir, err := ioutil.TempDir(TMP_DIR, "guarddog-test")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    writeTestFile(t, dir, "main.conf", "allow=read\ninclude=conf.d/net.conf\nallow=write\n")
+    writeTestFile(t, dir, "conf.d/net.conf", "allow=socket\ninclude=../common.conf\n")
+    writeTestFile(t, dir, "common.conf", "verbose=true\n")
+
+    opt, err := createParser().ParseNoValidate([]string{"--config-file=" + dir + "/main.conf"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    if !opt.Verbose {
+        t.Fatalf("expected Verbose to be set in included file")
+    }
+
+    // Order of values is kept
+    if fmt.Sprint(opt.Allow) != "[read socket write]" {
+        t.Fatalf("unexpected allowed syscalls %v", opt.Allow)
+    }
+
+    writeTestFile(t, dir, "loop.conf", "allow=read\ninclude=conf.d/loop.conf\n")
+    writeTestFile(t, dir, "conf.d/loop.conf", "\ninclude=../loop.conf\n")
+    _, err = createParser().ParseNoValidate([]string{"--config-file=" + dir + "/loop.conf"})
+    expect := "line 2: in included file '" + dir + "/conf.d/loop.conf': line 2: in included file '" +
+        dir + "/loop.conf': config files include each other"
+    if err == nil || !strings.Contains(err.Error(), expect) {
+        t.Fatalf("expected error with include chain, got %v", err)
+    }
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+    defaultConfig := createTmpFile("allow=read\nverbose=true\nset-uid=1\n")
+    defer removeTmpFile(defaultConfig)
+    userConfig := createTmpFile("allow=write\nset-uid=2\n")
+    defer removeTmpFile(userConfig)
+
+    savedDefault := DefaultConfigFile
+    DefaultConfigFile = defaultConfig
+    defer func () { DefaultConfigFile = savedDefault }()
+
+    args := []string{"--config-file=" + userConfig, "--allow=close", "--set-uid=3"}
+    opt, err := createParser().ParseNoValidate(args)
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    // System file, then user file, then CLI args
+    if fmt.Sprint(opt.Allow) != "[read write close]" || !opt.Verbose || opt.SetUid != 3 {
+        t.Fatalf("unexpected options: allow %v, verbose %v, set-uid %d", opt.Allow, opt.Verbose, opt.SetUid)
+    }
+
+    opt, err = createParser().ParseNoValidate(append(args, "--no-default-config"))
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    if fmt.Sprint(opt.Allow) != "[write close]" || opt.Verbose {
+        t.Fatalf("expected default config to be skipped, got allow %v", opt.Allow)
+    }
+
+    // Global keys of the system file are applied when only the user file has the section
+    sectionConfig := createTmpFile("[job]\nset-uid=4\n")
+    defer removeTmpFile(sectionConfig)
+    opt, err = createParser().ParseNoValidate([]string{"--config-file=" + sectionConfig, "--config-section=job"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    if fmt.Sprint(opt.Allow) != "[read]" || !opt.Verbose || opt.SetUid != 4 {
+        t.Fatalf("unexpected options: allow %v, verbose %v, set-uid %d", opt.Allow, opt.Verbose, opt.SetUid)
+    }
+
+    // Missing system file is not an error
+    DefaultConfigFile = defaultConfig + ".missing"
+    if _, err = createParser().ParseNoValidate(args); err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+}
+
+func writeTestFile(t *testing.T, dir string, name string, content string) {
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        t.Fatal(err)
+    }
+
+    if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestParsingConfigSections(t *testing.T) {
+    name := createTmpFile(`
+        allow=read
+        [base]
+        allow=write
+        set-uid=1
+        [job]
+        inherit=base
+        set-uid=2
+        [loop]
+        inherit=job2
+        [job2]
+        inherit=loop
+    `)
+    defer removeTmpFile(name)
+
+    args := []string{"--config-file=" + name, "--no-default-config"}
+    opt, err := createParser().ParseNoValidate(append(args, "--config-section=job"))
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    // Global keys, then inherited section, then the section itself
+    if fmt.Sprint(opt.Allow) != "[read write]" || opt.SetUid != 2 {
+        t.Fatalf("unexpected options: allow %v, set-uid %d", opt.Allow, opt.SetUid)
+    }
+
+    // Sections are skipped if none is selected
+    opt, err = createParser().ParseNoValidate(args)
+    if err != nil || fmt.Sprint(opt.Allow) != "[read]" {
+        t.Fatalf("expected only global keys, got %v, error %v", opt, err)
+    }
+
+    _, err = createParser().ParseNoValidate(append(args, "--config-section=missing"))
+    if err == nil || !strings.Contains(err.Error(), "section 'missing' is not found") {
+        t.Fatalf("expected error for missing section, got %v", err)
+    }
+
+    _, err = createParser().ParseNoValidate(append(args, "--config-section=loop"))
+    if err == nil || !strings.Contains(err.Error(), "sections inherit each other: loop -> job2 -> loop") {
+        t.Fatalf("expected error for inheritance loop, got %v", err)
+    }
+
+    global := createTmpFile("inherit=base\n")
+    defer removeTmpFile(global)
+    _, err = createParser().ParseNoValidate([]string{"--config-file=" + global, "--no-default-config"})
+    if err == nil {
+        t.Fatalf("expected error for inherit outside of a section")
+    }
+}
+
+func TestConfigLists(t *testing.T) {
+    name := createTmpFile(`
+        allow = read, write, \
+            openat  # files
+        chroot-path = "/srv/a, b"
+    `)
+    defer removeTmpFile(name)
+
+    opt, err := createParser().ParseNoValidate([]string{"--config-file=" + name, "--no-default-config"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    if fmt.Sprint(opt.Allow) != "[read write openat]" || opt.ChrootPath != "/srv/a, b" {
+        t.Fatalf("unexpected options: allow %v, chroot-path %q", opt.Allow, opt.ChrootPath)
+    }
+
+    single := createTmpFile("chroot-path = /srv/a, b\n")
+    defer removeTmpFile(single)
+    _, err = createParser().ParseNoValidate([]string{"--config-file=" + single, "--no-default-config"})
+    if err == nil || !strings.Contains(err.Error(), "takes a single value") {
+        t.Fatalf("expected error for a list in a single value option, got %v", err)
+    }
+}
+
+func TestEnvironmentOptions(t *testing.T) {
+    name := createTmpFile("allow=read\nset-uid=1\nverbose=false\n")
+    defer removeTmpFile(name)
+
+    os.Setenv("GUARDDOG_ALLOW", "write, close")
+    os.Setenv("GUARDDOG_SET_UID", "2")
+    os.Setenv("GUARDDOG_VERBOSE", "1")
+    defer os.Unsetenv("GUARDDOG_ALLOW")
+    defer os.Unsetenv("GUARDDOG_SET_UID")
+    defer os.Unsetenv("GUARDDOG_VERBOSE")
+
+    p := createParser()
+    opt, err := p.ParseNoValidate([]string{"--config-file=" + name, "--no-default-config", "--set-uid=3", "--allow=open"})
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    // Config file, then environment, then CLI args
+    if fmt.Sprint(opt.Allow) != "[read write close open]" || opt.SetUid != 3 || !opt.Verbose {
+        t.Fatalf("unexpected options: allow %v, set-uid %d, verbose %v", opt.Allow, opt.SetUid, opt.Verbose)
+    }
+
+    expect := fmt.Sprintf("[{read %s:1} {write env GUARDDOG_ALLOW} {close env GUARDDOG_ALLOW} {open CLI}]", name)
+    if fmt.Sprint(p.values["allow"]) != expect {
+        t.Fatalf("unexpected origins %v", p.values["allow"])
+    }
+
+    if fmt.Sprint(p.values["set-uid"]) != "[{3 CLI}]" || fmt.Sprint(p.values["verbose"]) != "[{1 env GUARDDOG_VERBOSE}]" {
+        t.Fatalf("unexpected origins %v, %v", p.values["set-uid"], p.values["verbose"])
+    }
+
+    os.Setenv("GUARDDOG_SET_UID", "x")
+    _, err = createParser().ParseNoValidate([]string{"--no-default-config"})
+    if err == nil || !strings.Contains(err.Error(), "GUARDDOG_SET_UID") {
+        t.Fatalf("expected error for invalid environment variable, got %v", err)
+    }
+}
+
+func TestPrintConfigRoundTrip(t *testing.T) {
+    name := createTmpFile("allow=read\nset-uid=1\n")
+    defer removeTmpFile(name)
+
+    args := []string{"--config-file=" + name, "--no-default-config", "--allow=write",
+        "--chroot-path= /srv/a, \"b\"\\ # c", "--print-config"}
+    p := createParser()
+    opt, err := p.ParseNoValidate(args)
+    if err != nil {
+        t.Fatalf("error while parsing: %s", err)
+    }
+
+    var buffer bytes.Buffer
+    if err := p.WriteEffectiveConfig(&buffer, opt, PRINT_CONFIG_FORMAT_CONFIG); err != nil {
+        t.Fatalf("failed to print config: %s", err)
+    }
+
+    output := buffer.String()
+    for _, line := range []string{
+            "allow = read  # " + name + ":1\n",
+            "allow = write  # CLI\n",
+            "set-uid = 1  # " + name + ":2\n",
+            "verbose = false  # default\n"} {
+        if !strings.Contains(output, line) {
+            t.Fatalf("expected line %q in output:\n%s", line, output)
+        }
+    }
+
+    printed := createTmpFile(output)
+    defer removeTmpFile(printed)
+    result, err := createParser().ParseNoValidate([]string{"--config-file=" + printed, "--no-default-config"})
+    if err != nil {
+        t.Fatalf("cannot parse printed config: %s\n%s", err, output)
+    }
+
+    if !reflect.DeepEqual(result.PolicyOptions, opt.PolicyOptions) || result.ChrootPath != opt.ChrootPath ||
+            result.SetUid != opt.SetUid {
+        t.Fatalf("printed config differs: %+v, expected %+v", result, opt)
+    }
+
+    buffer.Reset()
+    if err := p.WriteEffectiveConfig(&buffer, opt, PRINT_CONFIG_FORMAT_JSON); err != nil {
+        t.Fatalf("failed to print JSON: %s", err)
+    }
+
+    if !strings.Contains(buffer.String(), `"name": "set-uid",
+    "value": 1,`) {
+        t.Fatalf("unexpected JSON:\n%s", buffer.String())
+    }
+}
+
+type typedOptions struct {
+    Timeout     time.Duration       `option:"timeout"`
+    Memory      ByteSize            `option:"memory limit"`
+    Action      string              `option:"action" enum:"kill,trap"`
+    Env         map[string]string   `option:"environment" multiple:"yes"`
+    Uids        IntRange            `option:"uids"`
+    Flags       []bool              `option:"flags" multiple:"yes"`
+    Ratios      []float64           `option:"ratios" multiple:"yes"`
+}
+
+func (opt *typedOptions) Validate() error {
+    return nil
+}
+
+func TestOptionTypes(t *testing.T) {
+    name := createTmpFile("timeout = 1m30s\nmemory = 64M\naction = trap\nenv = A=1, B=x=y\nuids = 10-20\nflags = true, false\nratios = 0.5\n")
+    defer removeTmpFile(name)
+
+    p := NewCommandParser("test", &typedOptions{})
+    p.testDisableUsage()
+    fromConfig := &typedOptions{}
+    if err := p.ParseConfigFile(fromConfig, name); err != nil {
+        t.Fatalf("cannot parse config: %s", err)
+    }
+
+    p = NewCommandParser("test", &typedOptions{})
+    p.testDisableUsage()
+    fromArgs := &typedOptions{}
+    err := p.ParseInto(fromArgs, []string{"-timeout=1m30s", "-memory=64M", "-action=trap", "-env=A=1",
+        "-env=B=x=y", "-uids=10-20", "-flags", "-flags=false", "-ratios=0.5"})
+    if err != nil {
+        t.Fatalf("cannot parse args: %s", err)
+    }
+
+    expected := &typedOptions{
+        Timeout: 90 * time.Second,
+        Memory: 64 << 20,
+        Action: "trap",
+        Env: map[string]string{"A": "1", "B": "x=y"},
+        Uids: IntRange{10, 20},
+        Flags: []bool{true, false},
+        Ratios: []float64{0.5},
+    }
+
+    for _, result := range []*typedOptions{fromConfig, fromArgs} {
+        if !reflect.DeepEqual(result, expected) {
+            t.Errorf("got %+v, expected %+v", result, expected)
+        }
+    }
+
+    if expected.Memory.String() != "64M" || ByteSize(1536).String() != "1536" || expected.Uids.String() != "10-20" {
+        t.Errorf("unexpected text form of values: %s, %s", expected.Memory, expected.Uids)
+    }
+
+    for _, arg := range []string{"-action=errno", "-memory=1X", "-uids=5-1", "-env=noequals", "-timeout=5"} {
+        p = NewCommandParser("test", &typedOptions{})
+        p.testDisableUsage()
+        if err := p.ParseInto(&typedOptions{}, []string{arg}); err == nil {
+            t.Errorf("expected error for %s", arg)
+        }
+    }
+}
+
+type renamedOptions struct {
+    Names       []string    `option:"names" multiple:"yes" alias:"list,items" deprecated:"use -names instead"`
+    Quiet       bool        `option:"quiet" deprecated:"use -verbose=false instead"`
+    Verbose     bool        `option:"verbose"`
+}
+
+func (opt *renamedOptions) Validate() error {
+    return nil
+}
+
+func TestOptionAliases(t *testing.T) {
+    name := createTmpFile("list = a\nnames = b\nquiet = true\n")
+    defer removeTmpFile(name)
+
+    os.Setenv("GUARDDOG_ITEMS", "e")
+    defer os.Unsetenv("GUARDDOG_ITEMS")
+
+    p := NewCommandParser("test", &renamedOptions{})
+    p.testDisableUsage()
+    opt := &renamedOptions{}
+    if err := p.ParseConfigFile(opt, name); err != nil {
+        t.Fatalf("cannot parse config: %s", err)
+    }
+
+    if err := p.ParseInto(opt, []string{"-names=c", "-items=d"}); err != nil {
+        t.Fatalf("cannot parse args: %s", err)
+    }
+
+    if strings.Join(opt.Names, ",") != "a,b,e,c,d" || !opt.Quiet {
+        t.Errorf("unexpected options %+v", opt)
+    }
+
+    expected := []string{
+        name + ":1: option list is deprecated, use -names instead",
+        name + ":3: option quiet is deprecated, use -verbose=false instead",
+        "env GUARDDOG_ITEMS: option items is deprecated, use -names instead",
+        "CLI: option items is deprecated, use -names instead",
+    }
+    if !reflect.DeepEqual(p.Warnings(), expected) {
+        t.Errorf("unexpected warnings %q", p.Warnings())
+    }
+}
+
+func TestTrapIsAliasOfDefaultAction(t *testing.T) {
+    name := createTmpFile("trap = true\n")
+    defer removeTmpFile(name)
+
+    tests := []struct {
+        args        []string
+        expect      string
+        warnings    int
+    }{
+        {[]string{"-trap"}, "trap", 1},
+        {[]string{"-trap=false"}, "", 1},
+        {[]string{"-default-action=errno:EPERM"}, "errno:EPERM", 0},
+        {[]string{"-trap", "-default-action=kill"}, "kill", 1},
+        {[]string{"-config-file=" + name}, "trap", 1},
+        {[]string{"-config-file=" + name, "-default-action=allow"}, "allow", 1},
+    }
+
+    for _, test := range tests {
+        p := createParser()
+        args := append(append([]string{"-no-default-config"}, test.args...), "--", "/bin/true")
+        opt, err := p.ParseNoValidate(args)
+        if err != nil {
+            t.Errorf("cannot parse %v: %s", test.args, err)
+            continue
+        }
+
+        if opt.DefaultAction != test.expect || len(p.Warnings()) != test.warnings {
+            t.Errorf("expected %q for %v, got %q with warnings %q",
+                test.expect, test.args, opt.DefaultAction, p.Warnings())
+        }
+    }
+
+    p := createParser()
+    p.ParseNoValidate([]string{"-no-default-config", "-trap", "--", "/bin/true"})
+    if warnings := p.Warnings(); len(warnings) != 1 ||
+            warnings[0] != "CLI: option trap is deprecated, use -default-action=trap instead" {
+        t.Errorf("unexpected warnings %q", warnings)
+    }
+
+    _, err := createParser().Parse([]string{"-no-default-config", "-default-action=crash", "--", "/bin/true"})
+    if err == nil || !strings.Contains(err.Error(), "default-action") {
+        t.Errorf("expected an error for unknown action, got %v", err)
+    }
+}
+
+func TestConfigFromFd(t *testing.T) {
+    readConfigFromPipe := func (config string) (*GuarddogOptions, string, error) {
+        r, w, err := os.Pipe()
+        if err != nil {
+            t.Fatalf("cannot create pipe: %s", err)
+        }
+        w.WriteString(config)
+        w.Close()
+
+        // The parser closes the descriptor, so it gets a copy owned by nobody else
+        fd, err := syscall.Dup(int(r.Fd()))
+        r.Close()
+        if err != nil {
+            t.Fatalf("cannot duplicate pipe: %s", err)
+        }
+
+        args := []string{fmt.Sprintf("-config-fd=%d", fd), "-no-default-config", "--", "/bin/true"}
+        opt, err := createParser().ParseNoValidate(args)
+        return opt, fmt.Sprintf("<fd %d>", fd), err
+    }
+
+    opt, _, err := readConfigFromPipe("allow = read, write\nset-uid = 7\n")
+    if err != nil {
+        t.Fatalf("cannot read config from fd: %s", err)
+    }
+
+    if strings.Join(opt.Allow, ",") != "read,write" || opt.SetUid != 7 {
+        t.Errorf("unexpected options %+v", opt)
+    }
+
+    _, name, err := readConfigFromPipe("allow = read\nno-such-option = 1\n")
+    expected := fmt.Sprintf("error in config file '%s': line 2: invalid config option 'no-such-option'", name)
+    if err == nil || err.Error() != expected {
+        t.Errorf("expected error %q, got %v", expected, err)
+    }
+
+    _, err = createParser().ParseNoValidate([]string{"-config-fd=1", "-no-default-config", "--", "/bin/true"})
+    if err == nil || !strings.Contains(err.Error(), "must be at least 3") {
+        t.Errorf("expected error for stdout as config fd, got %v", err)
+    }
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+    "strings"
     "testing"
 )
 
@@ -8,3 +9,59 @@ func TestGO(t *testing.T) {
     o := NewGuarddogOptions()
     _ = o.Validate()
 }
+
+func TestValidationReportsAllErrors(t *testing.T) {
+    o := NewGuarddogOptions()
+    o.SetUid = -5
+    o.StatusFd = -1
+    o.ChrootPath = "/nonexistent/guarddog/chroot"
+    o.DefaultAction = "trap"
+    o.AllowAnySyscalls = true
+    o.UnknownSyscall = "crash"
+
+    err := o.Validate()
+    if err == nil {
+        t.Fatalf("expected validation errors")
+    }
+
+    errs, ok := err.(ValidationErrors)
+    if !ok || len(errs) != 5 {
+        t.Fatalf("expected 5 errors, got %v", err)
+    }
+
+    for _, message := range []string{
+            "chroot-path: invalid directory /nonexistent/guarddog/chroot: path does not exist",
+            "set-uid must be at least 0",
+            "status-fd must be at least 0",
+            "default-action conflicts with allow-any-syscalls",
+            "unknown-syscall must be one of: error, warn, ignore"} {
+        if !strings.Contains(err.Error(), message) {
+            t.Errorf("expected '%s' in '%s'", message, err)
+        }
+    }
+
+    // Defaults are not checked
+    o = NewGuarddogOptions()
+    o.ChrootPath = "/"
+    if err := o.Validate(); err != nil {
+        t.Errorf("unexpected error %s", err)
+    }
+}
+
+type requiringOptions struct {
+    Root        string      `option:"root"`
+    KeepRoot    bool        `option:"keep root" requires:"root"`
+    Limit       ByteSize    `option:"limit" min:"1K"`
+}
+
+func TestValidationRequires(t *testing.T) {
+    errs := ValidateOptions(&requiringOptions{KeepRoot: true, Limit: 512}, &requiringOptions{})
+    if validationResult(errs).Error() != "keep-root requires root; limit must be at least 1K" {
+        t.Errorf("unexpected errors %v", errs)
+    }
+
+    errs = ValidateOptions(&requiringOptions{Root: "/", KeepRoot: true, Limit: 1024}, &requiringOptions{})
+    if len(errs) != 0 {
+        t.Errorf("unexpected errors %v", errs)
+    }
+}
@@ -3,7 +3,9 @@ package config
 import (
     "errors"
     "fmt"
+    "guarddog/policy"
     "os"
+    "strings"
 )
 
 /* 
@@ -17,35 +19,73 @@ import (
 
     `option` tag sets description, options without it will not be parsed
     `multiple` tag allows multiple values
+    `tail` tag marks a []string field that receives arguments after options
+    `enum` tag lists allowed values of a string option, e.g. `enum:"text,json"`
+    `min`, `conflicts`, `requires` and `pathIsDir` tags are checked by ValidateOptions
+    `alias` tag lists old names, `old=value` is a boolean that sets the value,
+    e.g. `alias:"trap=trap"`, and `deprecated` tag gives a warning for them
+
+    Fields can be bool, int64, float64, string, time.Duration, ByteSize
+    or IntRange, slices of them with `multiple` tag or map[string]string
+    with `multiple` tag that is set with NAME=value, see option_types.go.
+
+    Options from embedded structs like PolicyOptions are added 
+    to the list as if they were declared in the struct.
 */
 const USE_DEFAULT_ID = -1
 
+/* Default value of -runtime-dir */
+const DEFAULT_RUNTIME_DIR = "/run/guarddog"
+
+/* Options that select config files, shared by commands that read them */
+type ConfigFileOptions struct {
+    ConfigFile  string      `cliOnly:"yes" option:"read options from this config file, '-' for stdin. File contains lines like 'some-option = some-value' and 'include = other.conf'"`
+    ConfigFd    int64       `cliOnly:"yes" option:"read options from a config passed as this file descriptor, e.g. a pipe, after -config-file" min:"3"`
+    ConfigSection string    `cliOnly:"yes" option:"apply options from this [section] of config files after global options"`
+    NoDefaultConfig bool    `cliOnly:"yes" option:"do not read /etc/guarddog/guarddog.conf"`
+}
+
+/* Restrictions besides the policy, shared by run and serve commands */
+type SandboxOptions struct {
+    ChrootPath  string      `option:"chroot to a directory before executing program" pathIsDir:"yes"`
+    SetUid      int64       `option:"switch to this UID" min:"0"`
+    SetGid      int64       `option:"switch to this GID" min:"0"`
+    AllowRoot   bool        `option:"allow program to run as root (by default it would refuse to do it)"`
+    UidPool     IntRange    `option:"switch to a uid and gid from this range that no other guarddog uses, e.g. 20000-20999, processes left with it are killed on exit" conflicts:"set-uid,set-gid"`
+    RuntimeDir  string      `option:"directory for lock files of uid-pool, must be the same for all guarddog processes sharing the pool"`
+}
+
 type GuarddogOptions struct {
-    ConfigFile  string      `cliOnly:"yes" option:"read options from this config file. File contains lines like 'some-option = some-value'"`
+    ConfigFileOptions
     DumpSyscalls bool       `cliOnly:"yes" option:"print available syscalls names and numbers for current system"`
+    ExportPolicyFormat string `cliOnly:"yes" option:"print the effective policy instead of running a program: oci (OCI and Docker seccomp JSON) or systemd (unit file directives)"`
+    PrintConfig bool        `cliOnly:"yes" option:"print effective options with their origins instead of running a program"`
+    PrintConfigFormat string `cliOnly:"yes" option:"format for -print-config, config output can be used as a config file" enum:"config,json"`
     Verbose     bool        `option:"print debugging information"`
 
-    ChrootPath  string      `option:"chroot to a directory before executing program"`
-    Allow       []string    `option:"names of system calls to allow, may be used several times" multiple:"yes"`
-    // AllowFromFile []string  `option:"names of files to read syscall list" multiple:"yes"`
-    AllowAnySyscalls bool   `option:"do not apply seccomp syscall filter"`
-    SetUid      int64       `option:"switch to this UID"`
-    SetGid      int64       `option:"switch to this GID"`
-    AllowRoot   bool        `option:"allow program to run as root (by default it would refuse to do it)"`
-    // Timeout     int64       `option:"timeout in seconds"`
+    SandboxOptions
+    PolicyOptions
 
-    StatusFd    int64       `option:"file descriptor for logging debug and error messsages, default is stderr (2)"`
-    Trap        bool        `option:"when making a syscall that is not allowed, send SIGSYS to a program instead of SIGKILL. Might be useful for debugging"`
+    StatusFd    int64       `option:"file descriptor for logging debug and error messsages, default is stderr (2)" min:"0"`
 
-    Command     []string    /* tail of option list */
+    Command     []string    `tail:"yes"`
 }
 
 func NewGuarddogOptions() *GuarddogOptions {
     opt := new(GuarddogOptions)
     opt.StatusFd = 2
+    opt.SandboxOptions = *NewSandboxOptions()
+    opt.PolicyOptions = *NewPolicyOptions()
+    opt.PrintConfigFormat = PRINT_CONFIG_FORMAT_CONFIG
+
+    return opt
+}
+
+func NewSandboxOptions() *SandboxOptions {
+    opt := new(SandboxOptions)
     opt.SetUid = USE_DEFAULT_ID
     opt.SetGid = USE_DEFAULT_ID
-
+    opt.RuntimeDir = DEFAULT_RUNTIME_DIR
     return opt
 }
 
@@ -56,39 +96,36 @@ func (opt *GuarddogOptions) Validate() error {
         return nil
     }
 
-    if opt.SetUid == 0 && !opt.AllowRoot {
-        return errors.New("to run program with uid = 0 you need to set --allow-root option")
-    }
+    errs := ValidateOptions(opt, NewGuarddogOptions())
 
-    /* ChrootPath must be valid directory if given */
-    if opt.ChrootPath != "" {
-        // isDir, reason := doesDirExist(opt.ChrootPath)
-        // if !isDir {
-        //     return errors.New(
-        //         fmt.Sprintf(
-        //             "invalid chroot directory %s: %s", 
-        //             opt.ChrootPath, 
-        //             reason))
-        // }
-    }   
-
-    // if opt.Timeout < 0 {
-    //     return errors.New("timeout cannot be negative")
-    // }
-
-    if opt.SetUid < 0 && opt.SetUid != USE_DEFAULT_ID {
-        return errors.New("set-uid must be positive")
+    errs = append(errs, opt.SandboxOptions.check()...)
+    errs = append(errs, opt.PolicyOptions.check()...)
+
+    if opt.ExportPolicyFormat != "" && !containsString(policy.ExportFormats, opt.ExportPolicyFormat) {
+        errs = append(errs, fmt.Errorf("export-policy-format must be one of: %s",
+            strings.Join(policy.ExportFormats, ", ")))
     }
 
-    if opt.SetGid < 0 && opt.SetGid != USE_DEFAULT_ID {
-        return errors.New("set-gid must be positive")
+    return validationResult(errs)
+}
+
+/* Checks that cannot be declared with tags, used by options embedding SandboxOptions */
+func (opt *SandboxOptions) check() []error {
+    var errs []error
+
+    if opt.SetUid == 0 && !opt.AllowRoot {
+        errs = append(errs, errors.New("to run program with uid = 0 you need to set --allow-root option"))
     }
 
-    if opt.Trap && opt.AllowAnySyscalls {
-        return errors.New("using -trap along with -allow-any-syscalls makes no sence")
+    if opt.UsesUidPool() && opt.UidPool.Min == 0 {
+        errs = append(errs, errors.New("uid-pool cannot include uid 0"))
     }
 
-    return nil 
+    return errs
+}
+
+func (opt *SandboxOptions) UsesUidPool() bool {
+    return opt.UidPool != IntRange{}
 }
 
 func (opt *GuarddogOptions) IsSyscallAllowed (name string) bool {
@@ -0,0 +1,72 @@
+package config
+
+import (
+    "reflect"
+    "strings"
+)
+
+/* 
+    Value of a CLI flag for any option type. Values are checked when
+    the flag is set and kept as strings, they are parsed into the options
+    struct by updateOptionFromString after config files like values
+    from the files, so CLI args and config files are read the same way.
+ */
+type optionFlag struct {
+    option      *Option
+    values      []string
+}
+
+func (f *optionFlag) String() string {
+    // flag package calls it on a zero value to check defaults
+    if f == nil {
+        return ""
+    }
+    return strings.Join(f.values, ",")
+}
+
+func (f *optionFlag) Set(source string) error {
+    if _, err := parseStringValue(f.option, source); err != nil {
+        return err
+    }
+
+    if f.option.IsMultiple {
+        f.values = append(f.values, source)
+    } else {
+        f.values = []string{source}
+    }
+    return nil
+}
+
+func (f *optionFlag) Get() interface{} {
+    return f.values
+}
+
+/* Allows -verbose without a value */
+func (f *optionFlag) IsBoolFlag() bool {
+    return f.option != nil && f.option.Type.Kind() == reflect.Bool
+}
+
+/*
+    Flag of a switch alias like -trap, it adds the value of the alias
+    to the flag of the option, so their values keep their order
+ */
+type switchFlag struct {
+    name        string
+    target      *optionFlag
+}
+
+func (f *switchFlag) String() string {
+    return ""
+}
+
+func (f *switchFlag) Set(source string) error {
+    values, err := f.target.option.valuesFor(f.name, source)
+    for i := 0; err == nil && i < len(values); i++ {
+        err = f.target.Set(values[i])
+    }
+    return err
+}
+
+func (f *switchFlag) IsBoolFlag() bool {
+    return true
+}
@@ -3,37 +3,80 @@ package config
 import (
     "fmt"
     "reflect"
+    "sort"
+    "strconv"
+    "strings"
     "unicode"
 )
 
 type Option struct {
     OptionName  string
     FieldName   string
-    Kind        reflect.Kind
+    /* type of a value, e.g. int64 for a []int64 field, or the map type */
+    Type        reflect.Type
     IsMultiple  bool
     Desc        string
     IsCliOnly     bool
+    /* allowed values from `enum` tag, nil if any value is allowed */
+    Enum        []string
+
+    /* Constraints checked by ValidateOptions */
+
+    /* smallest allowed value from `min` tag, empty if not limited */
+    Min         string
+    /* options that cannot be set along with this one, from `conflicts` tag */
+    Conflicts   []string
+    /* options that must be set along with this one, from `requires` tag */
+    Requires    []string
+    /* value must be a path to an existing directory, from `pathIsDir` tag */
+    PathIsDir   bool
+
+    /* old names from `alias` tag that set the same field */
+    Aliases     []string
+    /*
+        values of switch aliases written as "old=value" in `alias` tag,
+        e.g. "trap=trap": a boolean alias that sets the option to value
+     */
+    SwitchValues map[string]string
+    /* 
+        advice from `deprecated` tag, e.g. "use -x instead", given when
+        an alias is used or, if there are no aliases, the option itself
+     */
+    Deprecated  string
 }
 
 type optionMap map[string]*Option
 
 type OptionList struct {
     options     optionMap
+    /* options by names from `alias` tags */
+    aliases     optionMap
+    /* name of a field with `tail` tag that receives arguments after options */
+    TailField   string
 }
 
 func NewOptionList() *OptionList {
     list := new(OptionList)
     list.options = make(optionMap)
+    list.aliases = make(optionMap)
 
     return list
 }
 
+/* Returns an option by its name or alias */
 func (list *OptionList) Lookup(name string) *Option {
-    return list.options[name]
+    if option, exists := list.options[name]; exists {
+        return option
+    }
+    return list.aliases[name]
 }
 
 func (list *OptionList) Contains(name string) bool {
-    _, exists := list.options[name]
+    return list.Lookup(name) != nil
+}
+
+func (list *OptionList) IsAlias(name string) bool {
+    _, exists := list.aliases[name]
     return exists
 }
 
@@ -43,13 +86,27 @@ func (list *OptionList) VisitAll(visitor func(name string, opt *Option)) {
     }
 }
 
+/* Returns sorted option names without aliases */
+func (list *OptionList) Names() []string {
+    var names []string
+    for name := range list.options {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
 func (list *OptionList) Add(option *Option) {    
-    name := option.OptionName
-    if list.Contains(name) {
-        panic(fmt.Sprintf("List already contains option %s", name))
+    for _, name := range append([]string{option.OptionName}, option.Aliases...) {
+        if list.Contains(name) {
+            panic(fmt.Sprintf("List already contains option %s", name))
+        }
     }
 
-    list.options[name] = option
+    list.options[option.OptionName] = option
+    for _, alias := range option.Aliases {
+        list.aliases[alias] = option
+    }
 }
 
 func (list *OptionList) AddFromStruct(ref reflect.Type) {
@@ -57,27 +114,54 @@ func (list *OptionList) AddFromStruct(ref reflect.Type) {
     for i := 0; i < ref.NumField(); i++ {
         field := ref.Field(i)
         name := field.Name
+
+        // Options from embedded structs are added as if they were declared here
+        if field.Anonymous && field.Type.Kind() == reflect.Struct {
+            list.AddFromStruct(field.Type)
+            continue
+        }
+
+        if field.Tag.Get("tail") != "" {
+            if field.Type != reflect.TypeOf([]string{}) {
+                panic(fmt.Sprintf("Field %s must be []string to receive arguments", name))
+            }
+            list.TailField = name
+            continue
+        }
+
         optionName := dashifyName(name)
         desc := field.Tag.Get("option")
         isMultiple := field.Tag.Get("multiple") != ""
         isCliOnly := field.Tag.Get("cliOnly") != ""
-        kind := field.Type.Kind()        
+        valueType := field.Type
 
         if desc == "" {
             continue
         }
 
         if isMultiple {
-            if kind != reflect.Slice {
-                panic(fmt.Sprintf("Field %s must be a slice if declared as multiple", name))
+            if valueType.Kind() == reflect.Slice {
+                // get internal type, e.g. int64 instead of []int64
+                valueType = valueType.Elem()
+            } else if valueType.Kind() != reflect.Map {
+                panic(fmt.Sprintf("Field %s must be a slice or a map if declared as multiple", name))
             }
-
-            // get internal type, e.g. int instead of []int
-            kind = field.Type.Elem().Kind()
         } else {
-            if kind == reflect.Slice {
-                panic(fmt.Sprintf("Field %s is a slice and must be declared as multiple", name))
+            if valueType.Kind() == reflect.Slice || valueType.Kind() == reflect.Map {
+                panic(fmt.Sprintf("Field %s is a %s and must be declared as multiple", name, valueType.Kind()))
+            }
+        }
+
+        if !isSupportedOptionType(valueType) {
+            panic(fmt.Sprintf("Field %s has unsupported type %s", name, field.Type))
+        }
+
+        var enum []string
+        if values := field.Tag.Get("enum"); values != "" {
+            if valueType.Kind() != reflect.String {
+                panic(fmt.Sprintf("Field %s must be a string to have enum values", name))
             }
+            enum = strings.Split(values, ",")
         }
 
         option := Option{
@@ -85,14 +169,78 @@ func (list *OptionList) AddFromStruct(ref reflect.Type) {
             FieldName: name,
             Desc: desc,
             IsMultiple: isMultiple,
-            Kind: kind,
+            Type: valueType,
             IsCliOnly: isCliOnly,
+            Enum: enum,
+            Conflicts: splitTagList(field.Tag.Get("conflicts")),
+            Requires: splitTagList(field.Tag.Get("requires")),
+            PathIsDir: field.Tag.Get("pathIsDir") != "",
+            Min: field.Tag.Get("min"),
+            Deprecated: field.Tag.Get("deprecated"),
+        }
+
+        for _, alias := range splitTagList(field.Tag.Get("alias")) {
+            if pos := strings.Index(alias, "="); pos >= 0 {
+                if option.SwitchValues == nil {
+                    option.SwitchValues = make(map[string]string)
+                }
+                option.SwitchValues[alias[:pos]] = alias[pos + 1:]
+                alias = alias[:pos]
+            }
+            option.Aliases = append(option.Aliases, alias)
+        }
+
+        if option.Min != "" && !isValidMin(&option) {
+            panic(fmt.Sprintf("Field %s has invalid min value '%s'", name, option.Min))
+        }
+
+        if option.PathIsDir && valueType.Kind() != reflect.String {
+            panic(fmt.Sprintf("Field %s must be a string to be checked as a directory", name))
         }
 
         list.Add(&option)
     }
 }
 
+/* Returns a warning if the option is deprecated under this name, or an empty string */
+func (option *Option) deprecationWarning(name string) string {
+    if option.Deprecated == "" || (len(option.Aliases) > 0 && name == option.OptionName) {
+        return ""
+    }
+
+    return fmt.Sprintf("option %s is deprecated, %s", name, option.Deprecated)
+}
+
+/*
+    Converts a value given under a name of the option into values of
+    the option. A switch alias takes a boolean and sets the option to
+    its value if it is true.
+ */
+func (option *Option) valuesFor(name string, value string) ([]string, error) {
+    switchValue, isSwitch := option.SwitchValues[name]
+    if !isSwitch {
+        return []string{value}, nil
+    }
+
+    on, err := strconv.ParseBool(value)
+    if err != nil {
+        return nil, fmt.Errorf("invalid boolean value '%s'", value)
+    }
+
+    if !on {
+        return nil, nil
+    }
+    return []string{switchValue}, nil
+}
+
+/* Splits a comma separated list of option names, returns nil for an empty tag */
+func splitTagList(tag string) []string {
+    if tag == "" {
+        return nil
+    }
+    return strings.Split(tag, ",")
+}
+
 /* SomeOption -> some-option */
 func dashifyName(in string) string {
     runes := []rune(in)
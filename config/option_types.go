@@ -0,0 +1,212 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+)
+
+/*
+    Types of option values besides bool, int64, float64 and string:
+
+        Timeout     time.Duration       `option:"..."`    30s, 1m30s
+        MemoryLimit ByteSize            `option:"..."`    65536, 512K, 64M, 1G
+        Action      string              `option:"..." enum:"kill,trap"`
+        Env         map[string]string   `option:"..." multiple:"yes"`   NAME=value
+        UidPool     IntRange            `option:"..."`    20000-20999
+
+    Values are parsed by parseStringValue both from CLI args and config files.
+ */
+
+/* Size in bytes, written with an optional K, M, G or T suffix (powers of 1024) */
+type ByteSize int64
+
+/* Closed range of integers, written as MIN-MAX or a single number */
+type IntRange struct {
+    Min         int64
+    Max         int64
+}
+
+var (
+    durationType = reflect.TypeOf(time.Duration(0))
+    byteSizeType = reflect.TypeOf(ByteSize(0))
+    intRangeType = reflect.TypeOf(IntRange{})
+    stringMapType = reflect.TypeOf(map[string]string{})
+)
+
+var byteSizeSuffixes = []string{"K", "M", "G", "T"}
+
+func ParseByteSize(s string) (ByteSize, error) {
+    number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+    multiplier := int64(1)
+
+    for i, suffix := range byteSizeSuffixes {
+        if strings.HasSuffix(number, suffix) {
+            number = strings.TrimSuffix(number, suffix)
+            multiplier = int64(1) << uint(10 * (i + 1))
+            break
+        }
+    }
+
+    value, err := strconv.ParseInt(number, 10, 64)
+    if err != nil || value < 0 {
+        return 0, fmt.Errorf("invalid size '%s', expected a number with an optional K, M, G or T suffix", s)
+    }
+
+    if value > (1 << 63 - 1) / multiplier {
+        return 0, fmt.Errorf("size '%s' is too large", s)
+    }
+
+    return ByteSize(value * multiplier), nil
+}
+
+/* Returns the size with the largest suffix that keeps it exact, e.g. 64M */
+func (size ByteSize) String() string {
+    value := int64(size)
+    suffix := ""
+
+    for _, next := range byteSizeSuffixes {
+        if value == 0 || value % 1024 != 0 {
+            break
+        }
+        value /= 1024
+        suffix = next
+    }
+
+    return fmt.Sprintf("%d%s", value, suffix)
+}
+
+func ParseIntRange(s string) (IntRange, error) {
+    parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+    var bounds [2]int64
+
+    for i, part := range parts {
+        value, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+        if err != nil || value < 0 {
+            return IntRange{}, fmt.Errorf("invalid range '%s', expected MIN-MAX", s)
+        }
+        bounds[i] = value
+    }
+
+    if len(parts) == 1 {
+        bounds[1] = bounds[0]
+    }
+
+    if bounds[0] > bounds[1] {
+        return IntRange{}, fmt.Errorf("invalid range '%s', %d is greater than %d", s, bounds[0], bounds[1])
+    }
+
+    return IntRange{bounds[0], bounds[1]}, nil
+}
+
+func (r IntRange) String() string {
+    return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+func (r IntRange) Contains(value int64) bool {
+    return value >= r.Min && value <= r.Max
+}
+
+/* Splits NAME=value of a map option */
+func parseKeyValue(s string) (string, string, error) {
+    parts := strings.SplitN(s, "=", 2)
+    if len(parts) < 2 || parts[0] == "" {
+        return "", "", fmt.Errorf("invalid value '%s', expected NAME=value", s)
+    }
+
+    return parts[0], parts[1], nil
+}
+
+/* Returns true if values of this type can be parsed by parseStringValue */
+func isSupportedOptionType(t reflect.Type) bool {
+    switch t {
+    case durationType, byteSizeType, intRangeType, stringMapType:
+        return true
+    }
+
+    switch t.Kind() {
+    case reflect.Bool, reflect.Int64, reflect.Float64, reflect.String:
+        return t.PkgPath() == ""
+    }
+
+    return false
+}
+
+/*
+    Parses a single value of an option. For map options it checks
+    NAME=value and returns the string as is, the map is updated by
+    updateOptionFromString.
+ */
+func parseStringValue(option *Option, value string) (reflect.Value, error) {
+    if option.Enum != nil && !containsString(option.Enum, value) {
+        return reflect.Value{}, fmt.Errorf("invalid value '%s', expected one of: %s",
+            value, strings.Join(option.Enum, ", "))
+    }
+
+    if option.IsMultiple && value == "" {
+        return reflect.Value{}, errors.New("empty string value")
+    }
+
+    switch option.Type {
+    case durationType:
+        d, err := time.ParseDuration(value)
+        return reflect.ValueOf(d), err
+    case byteSizeType:
+        size, err := ParseByteSize(value)
+        return reflect.ValueOf(size), err
+    case intRangeType:
+        r, err := ParseIntRange(value)
+        return reflect.ValueOf(r), err
+    case stringMapType:
+        _, _, err := parseKeyValue(value)
+        return reflect.ValueOf(value), err
+    }
+
+    switch option.Type.Kind() {
+    case reflect.Int64:
+        i, err := strconv.ParseInt(value, 10, 64)
+        return reflect.ValueOf(i), err
+    case reflect.Float64:
+        f, err := strconv.ParseFloat(value, 64)
+        return reflect.ValueOf(f), err
+    case reflect.Bool:
+        b, err := strconv.ParseBool(value)
+        return reflect.ValueOf(b), err
+    case reflect.String:
+        return reflect.ValueOf(value), nil
+    }
+
+    panic(fmt.Sprintf("Unknown option type: '%s'", option.Type))
+}
+
+/* Name of a value shown in usage, e.g. "-set-uid int" */
+func optionTypeName(option *Option) string {
+    if option.Enum != nil {
+        return strings.Join(option.Enum, "|")
+    }
+
+    switch option.Type {
+    case durationType:
+        return "duration"
+    case byteSizeType:
+        return "size"
+    case intRangeType:
+        return "min-max"
+    case stringMapType:
+        return "name=value"
+    }
+
+    switch option.Type.Kind() {
+    case reflect.Int64:
+        return "int"
+    case reflect.Float64:
+        return "float"
+    case reflect.String:
+        return "string"
+    }
+
+    return ""
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+    "fmt"
+    "guarddog/policy"
+)
+
+/* Values for UnknownSyscall option */
+const (
+    UNKNOWN_SYSCALL_ERROR = "error"
+    UNKNOWN_SYSCALL_WARN = "warn"
+    UNKNOWN_SYSCALL_IGNORE = "ignore"
+)
+
+/* Options that define a syscall policy, used by run and policy commands */
+type PolicyOptions struct {
+    Allow       []string    `option:"names of system calls or groups like @memory to allow, may be used several times" multiple:"yes"`
+    Profile     string      `option:"allow syscalls needed by a language runtime: static-c, dynamic-c, python3, go or jvm"`
+    Policy      string      `option:"read syscall rules from a YAML or JSON policy file"`
+    ImportDockerProfile string `option:"read syscall rules from a Docker or OCI seccomp profile in JSON format"`
+    MinijailPolicy string   `option:"read syscall rules from a minijail .policy file"`
+    // AllowFromFile []string  `option:"names of files to read syscall list" multiple:"yes"`
+    AllowAnySyscalls bool   `option:"do not apply seccomp syscall filter"`
+    UnknownSyscall string   `option:"what to do with allowed syscalls that do not exist on this architecture and have no known equivalent" enum:"error,warn,ignore"`
+    DefaultAction string    `option:"action for syscalls that are not allowed: kill, trap to send SIGSYS instead of SIGKILL, which might be useful for debugging, or errno:NAME. Overrides default action of policy files" alias:"trap=trap" deprecated:"use -default-action=trap instead" conflicts:"allow-any-syscalls"`
+}
+
+func NewPolicyOptions() *PolicyOptions {
+    opt := new(PolicyOptions)
+    opt.UnknownSyscall = UNKNOWN_SYSCALL_ERROR
+    return opt
+}
+
+func (opt *PolicyOptions) Validate() error {
+    errs := ValidateOptions(opt, NewPolicyOptions())
+    return validationResult(append(errs, opt.check()...))
+}
+
+/* Checks that cannot be declared with tags, used by options embedding PolicyOptions */
+func (opt *PolicyOptions) check() []error {
+    var errs []error
+
+    if opt.Profile != "" {
+        if _, err := policy.LookupProfile(opt.Profile); err != nil {
+            errs = append(errs, err)
+        }
+    }
+
+    if opt.DefaultAction != "" {
+        if _, err := policy.ParseAction(opt.DefaultAction); err != nil {
+            errs = append(errs, fmt.Errorf("default-action: %s", err))
+        }
+    }
+
+    for _, name := range opt.Allow {
+        if policy.IsGroupName(name) {
+            if _, err := policy.LookupGroup(name); err != nil {
+                errs = append(errs, err)
+            }
+        }
+    }
+
+    return errs
+}
+
+/* 
+    Builds a policy from options for given arch. Rules from the
+    profile come first, then rules from the Docker profile, the minijail
+    policy, the policy file and -allow options, so later rules override earlier ones.
+    The -default-action option overrides default action from the files.
+
+    Returns warnings about rules that cannot be imported exactly.
+ */
+func (opt *PolicyOptions) BuildPolicy(arch string) (*policy.Policy, []string, error) {
+    p := policy.New(policy.Kill)
+    var warnings []string
+
+    if opt.Profile != "" {
+        profile, err := policy.LookupProfile(opt.Profile)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        p.Merge(profile.Policy(arch, p.DefaultAction))
+    }
+
+    if opt.ImportDockerProfile != "" {
+        dockerPolicy, dockerWarnings, err := policy.ImportDockerProfile(opt.ImportDockerProfile, arch)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        p.DefaultAction = dockerPolicy.DefaultAction
+        p.Merge(dockerPolicy)
+        warnings = append(warnings, dockerWarnings...)
+    }
+
+    if opt.MinijailPolicy != "" {
+        minijailPolicy, err := policy.LoadMinijailPolicy(opt.MinijailPolicy)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        p.Merge(minijailPolicy)
+    }
+
+    if opt.Policy != "" {
+        filePolicy, err := policy.LoadFile(opt.Policy, arch)
+        if err != nil {
+            return nil, nil, err
+        }
+
+        p.DefaultAction = filePolicy.DefaultAction
+        p.Merge(filePolicy)
+    }
+
+    if opt.DefaultAction != "" {
+        action, err := policy.ParseAction(opt.DefaultAction)
+        if err != nil {
+            return nil, nil, err
+        }
+        p.DefaultAction = action
+    }
+
+    p.Allow(opt.Allow...)
+    return p, warnings, nil
+}
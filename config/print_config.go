@@ -0,0 +1,174 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+/* Values for GuarddogOptions.PrintConfigFormat */
+const (
+    PRINT_CONFIG_FORMAT_CONFIG = "config"
+    PRINT_CONFIG_FORMAT_JSON = "json"
+)
+
+/* Effective value of an option, one for every value of multiple options */
+type effectiveValue struct {
+    Name        string          `json:"name"`
+    Value       interface{}     `json:"value"`
+    Origin      string          `json:"origin"`
+}
+
+/*
+    Writes effective options parsed into opt. The config format can be
+    read back by ParseConfig, every value is annotated with its origin:
+
+        allow = read  # /etc/guarddog/guarddog.conf:3
+        set-uid = 1000  # env GUARDDOG_SET_UID
+        verbose = false  # default
+
+    The JSON format is a list of objects with name, value and origin.
+    Options that can be used only in CLI args are skipped.
+ */
+func (cfg *configuration) WriteEffectiveConfig(w io.Writer, opt interface{}, format string) error {
+    values := cfg.effectiveValues(opt)
+
+    switch format {
+    case PRINT_CONFIG_FORMAT_JSON:
+        output, err := json.MarshalIndent(values, "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintf(w, "%s\n", output)
+        return err
+
+    case PRINT_CONFIG_FORMAT_CONFIG:
+        lines := []string{"# Effective options of " + PROGRAM_NAME}
+        for _, name := range cfg.optionList.Names() {
+            option := cfg.optionList.Lookup(name)
+            if option.IsCliOnly {
+                continue
+            }
+
+            found := false
+            for _, value := range values {
+                if value.Name == name {
+                    found = true
+                    lines = append(lines, fmt.Sprintf("%s = %s  # %s",
+                        name, formatConfigValue(fmt.Sprint(value.Value)), value.Origin))
+                }
+            }
+
+            if !found {
+                lines = append(lines, fmt.Sprintf("# %s: no values (%s)", name, ORIGIN_DEFAULT))
+            }
+        }
+
+        _, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+        return err
+    }
+
+    return fmt.Errorf("unknown format '%s', expected %s or %s", format,
+        PRINT_CONFIG_FORMAT_CONFIG, PRINT_CONFIG_FORMAT_JSON)
+}
+
+/*
+    Returns values of options sorted by name. Values are taken from
+    the struct, origins are taken from values recorded while parsing.
+ */
+func (cfg *configuration) effectiveValues(opt interface{}) []effectiveValue {
+    result := []effectiveValue{}
+
+    for _, name := range cfg.optionList.Names() {
+        option := cfg.optionList.Lookup(name)
+        if option.IsCliOnly {
+            continue
+        }
+
+        field := getFieldForOption(opt, option)
+        parsed := cfg.values[name]
+
+        if !option.IsMultiple {
+            origin := ORIGIN_DEFAULT
+            if len(parsed) > 0 {
+                origin = parsed[0].Origin
+            }
+            result = append(result, effectiveValue{name, printableValue(field), origin})
+            continue
+        }
+
+        if option.Type.Kind() == reflect.Map {
+            for _, key := range sortedMapKeys(field) {
+                item := fmt.Sprintf("%s=%s", key, field.MapIndex(reflect.ValueOf(key)))
+                result = append(result, effectiveValue{name, item, mapItemOrigin(parsed, key)})
+            }
+            continue
+        }
+
+        for i := 0; i < field.Len(); i++ {
+            origin := ORIGIN_DEFAULT
+            if field.Len() == len(parsed) {
+                origin = parsed[i].Origin
+            }
+            result = append(result, effectiveValue{name, printableValue(field.Index(i)), origin})
+        }
+    }
+
+    return result
+}
+
+/* Returns a value as is or as a string if it has a text form like 30s or 64M */
+func printableValue(value reflect.Value) interface{} {
+    if stringer, ok := value.Interface().(fmt.Stringer); ok {
+        return stringer.String()
+    }
+    return value.Interface()
+}
+
+func sortedMapKeys(m reflect.Value) []string {
+    var keys []string
+    for _, key := range m.MapKeys() {
+        keys = append(keys, key.String())
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+/* Origin of the last NAME=value that set the key */
+func mapItemOrigin(parsed []OptionValue, key string) string {
+    origin := ORIGIN_DEFAULT
+    for _, value := range parsed {
+        if strings.HasPrefix(value.Value, key + "=") {
+            origin = value.Origin
+        }
+    }
+    return origin
+}
+
+/* Quotes a value if ParseConfig would read it differently */
+func formatConfigValue(value string) string {
+    if value != "" && value == strings.TrimSpace(value) && !strings.ContainsAny(value, ",#\"'\\\n\r\t") {
+        return value
+    }
+
+    quoted := []byte{'"'}
+    for i := 0; i < len(value); i++ {
+        switch value[i] {
+        case '"', '\\':
+            quoted = append(quoted, '\\', value[i])
+        case '\n':
+            quoted = append(quoted, `\n`...)
+        case '\t':
+            quoted = append(quoted, `\t`...)
+        case '\r':
+            quoted = append(quoted, `\r`...)
+        default:
+            quoted = append(quoted, value[i])
+        }
+    }
+
+    return string(append(quoted, '"'))
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+)
+
+/*
+    Violations of option constraints, all of them are reported at once:
+
+        invalid options: set-uid must be at least 0; trap conflicts with allow-any-syscalls
+ */
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+    messages := make([]string, len(errs))
+    for i, err := range errs {
+        messages[i] = err.Error()
+    }
+    return strings.Join(messages, "; ")
+}
+
+/* Returns nil if there are no errors, so the result can be returned as error */
+func validationResult(errs []error) error {
+    if len(errs) == 0 {
+        return nil
+    }
+    return ValidationErrors(errs)
+}
+
+/*
+    Checks constraints declared in tags of an options struct:
+
+        SetUid      int64   `option:"..." min:"0"`
+        Action      string  `option:"..." enum:"kill,trap,errno"`
+        Trap        bool    `option:"..." conflicts:"allow-any-syscalls"`
+        Preserve    bool    `option:"..." requires:"chroot-path"`
+        ChrootPath  string  `option:"..." pathIsDir:"yes"`
+
+    An option is considered set if its value differs from the value in
+    defaults, a pointer to the same struct made by its constructor. Only
+    set options are checked, so defaults like USE_DEFAULT_ID = -1 are
+    allowed even with min:"0".
+ */
+func ValidateOptions(opt interface{}, defaults interface{}) []error {
+    list := NewOptionList()
+    list.AddFromStruct(reflect.TypeOf(opt).Elem())
+
+    isSet := func (name string) bool {
+        option := list.Lookup(name)
+        if option == nil {
+            panic(fmt.Sprintf("Unknown option %s in constraints", name))
+        }
+        return !reflect.DeepEqual(getFieldForOption(opt, option).Interface(),
+            getFieldForOption(defaults, option).Interface())
+    }
+
+    var errs []error
+    for _, name := range list.Names() {
+        option := list.Lookup(name)
+        if !isSet(name) {
+            continue
+        }
+
+        for _, value := range optionFieldValues(getFieldForOption(opt, option)) {
+            if err := checkOptionValue(option, value); err != nil {
+                errs = append(errs, err)
+            }
+        }
+
+        for _, other := range option.Conflicts {
+            if isSet(other) {
+                errs = append(errs, fmt.Errorf("%s conflicts with %s", name, other))
+            }
+        }
+
+        for _, other := range option.Requires {
+            if !isSet(other) {
+                errs = append(errs, fmt.Errorf("%s requires %s", name, other))
+            }
+        }
+    }
+
+    return errs
+}
+
+/* Returns values of a field, one for every element of a slice */
+func optionFieldValues(field reflect.Value) []reflect.Value {
+    switch field.Kind() {
+    case reflect.Slice:
+        values := make([]reflect.Value, field.Len())
+        for i := range values {
+            values[i] = field.Index(i)
+        }
+        return values
+    case reflect.Map:
+        // NAME=value pairs have no constraints
+        return nil
+    }
+
+    return []reflect.Value{field}
+}
+
+func checkOptionValue(option *Option, value reflect.Value) error {
+    name := option.OptionName
+
+    if option.Min != "" {
+        minValue, _ := parseStringValue(option, option.Min)
+        min, _ := numericValue(minValue)
+        if number, _ := numericValue(value); number < min {
+            return fmt.Errorf("%s must be at least %s", name, option.Min)
+        }
+    }
+
+    if option.Enum != nil && !containsString(option.Enum, value.String()) {
+        return fmt.Errorf("%s must be one of: %s", name, strings.Join(option.Enum, ", "))
+    }
+
+    if option.PathIsDir && value.String() != "" {
+        if isDir, reason := doesDirExist(value.String()); !isDir {
+            return fmt.Errorf("%s: invalid directory %s: %s", name, value.String(), reason)
+        }
+    }
+
+    return nil
+}
+
+/* Returns true if `min` tag is a number of the option type */
+func isValidMin(option *Option) bool {
+    value, err := parseStringValue(option, option.Min)
+    if err != nil {
+        return false
+    }
+
+    _, isNumber := numericValue(value)
+    return isNumber
+}
+
+/* Returns a number to compare with `min`, the lower bound for ranges */
+func numericValue(value reflect.Value) (float64, bool) {
+    if value.Type() == intRangeType {
+        return float64(value.Interface().(IntRange).Min), true
+    }
+
+    switch value.Kind() {
+    case reflect.Int64:
+        return float64(value.Int()), true
+    case reflect.Float64:
+        return value.Float(), true
+    }
+
+    return 0, false
+}
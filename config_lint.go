@@ -0,0 +1,153 @@
+package main
+
+import (
+    "fmt"
+    "guarddog/config"
+    "guarddog/policy"
+    "guarddog/seccomphelper"
+)
+
+/* Syscalls that let a program escape or weaken the sandbox */
+var dangerousSyscalls = []string{
+    "ptrace", "mount", "bpf", "kexec_load", "init_module", "process_vm_writev",
+}
+
+/* Syscalls without which a program cannot start or exit normally */
+var essentialSyscalls = []struct {
+    name        string
+    reason      string
+}{
+    {"execve", "the program cannot be started"},
+    {"exit_group", "the program cannot exit normally"},
+}
+
+/* Finding of "guarddog check", location is "file:line" or a file name */
+type configWarning struct {
+    location    string
+    message     string
+}
+
+func (w configWarning) String() string {
+    return fmt.Sprintf("%s: warning: %s", w.location, w.message)
+}
+
+/* Options of a config file with locations of their values */
+type lintedConfig struct {
+    fileName    string
+    options     *config.GuarddogOptions
+    allow       []config.OptionValue
+    allowAny    []config.OptionValue
+}
+
+/*
+    Finds problems that do not need a resolved policy: duplicate and
+    unknown -allow entries and -allow-any-syscalls with an allow list
+ */
+func lintOptions(c *lintedConfig) []configWarning {
+    var warnings []configWarning
+    firstOrigins := make(map[string]string)
+
+    for _, value := range c.allow {
+        if origin, isSeen := firstOrigins[value.Value]; isSeen {
+            warnings = append(warnings, configWarning{value.Origin,
+                fmt.Sprintf("%s is allowed again, first allowed at %s", value.Value, origin)})
+            continue
+        }
+        firstOrigins[value.Value] = value.Origin
+
+        if policy.IsGroupName(value.Value) {
+            continue
+        }
+
+        if _, unknown := seccomphelper.NormalizeSyscallNames([]string{value.Value}); len(unknown) > 0 {
+            warnings = append(warnings, configWarning{value.Origin,
+                fmt.Sprintf("syscall %s does not exist on arch %s", value.Value, seccomphelper.GetLibraryInfo().Arch)})
+        }
+    }
+
+    if c.options.AllowAnySyscalls && len(c.allow) > 0 {
+        warnings = append(warnings, configWarning{lastOrigin(c.allowAny, c.fileName),
+            "allow-any-syscalls disables the filter, the allow list has no effect"})
+    }
+
+    return warnings
+}
+
+/* Finds dangerous syscalls that are allowed and essential ones that are not */
+func lintPolicy(c *lintedConfig, p *policy.Policy, rules []seccomphelper.ResolvedRule) []configWarning {
+    if c.options.AllowAnySyscalls {
+        return nil
+    }
+
+    var warnings []configWarning
+
+    for _, name := range dangerousSyscalls {
+        if isSyscallAllowedByPolicy(rules, p.DefaultAction, name) {
+            warnings = append(warnings, configWarning{allowOrigin(c, name),
+                fmt.Sprintf("dangerous syscall %s is allowed", name)})
+        }
+    }
+
+    for _, essential := range essentialSyscalls {
+        if !isSyscallAllowedByPolicy(rules, p.DefaultAction, essential.name) {
+            warnings = append(warnings, configWarning{c.fileName,
+                fmt.Sprintf("%s is not allowed, %s", essential.name, essential.reason)})
+        }
+    }
+
+    return warnings
+}
+
+/* 
+    Returns true if a rule allows a syscall, possibly with conditions,
+    or it is allowed by the default action when arguments are zeros
+ */
+func isSyscallAllowedByPolicy(rules []seccomphelper.ResolvedRule, defaultAction policy.Action, name string) bool {
+    if seccomphelper.IsSyscallAllowed(rules, name) {
+        return true
+    }
+
+    number, err := seccomphelper.GetSyscallNumber(name)
+    if err != nil {
+        return false
+    }
+
+    return seccomphelper.EvaluateRules(rules, defaultAction, number, nil).Kind == policy.ACTION_ALLOW
+}
+
+/*
+    Returns location of an -allow entry naming a syscall or a group
+    containing it, or the file name if it comes from a profile or a policy
+ */
+func allowOrigin(c *lintedConfig, name string) string {
+    for _, value := range c.allow {
+        if value.Value == name {
+            return value.Origin
+        }
+
+        if policy.IsGroupName(value.Value) {
+            members, _ := policy.LookupGroup(value.Value)
+            if containsName(members, name) {
+                return value.Origin
+            }
+        }
+    }
+
+    return c.fileName
+}
+
+func lastOrigin(values []config.OptionValue, defaultOrigin string) string {
+    if len(values) == 0 {
+        return defaultOrigin
+    }
+    return values[len(values) - 1].Origin
+}
+
+func containsName(names []string, name string) bool {
+    for _, candidate := range names {
+        if candidate == name {
+            return true
+        }
+    }
+    return false
+}
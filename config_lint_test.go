@@ -0,0 +1,114 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+    path := filepath.Join(dir, name)
+    if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLintConfig(t *testing.T) {
+    dir, err := ioutil.TempDir("", "guarddog-lint")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    // FILE in expected warnings is replaced with the config path
+    tests := []struct {
+        config      string
+        expect      []string
+    }{
+        {"allow = execve, exit_group, read\n", nil},
+        {
+            "allow = execve, exit_group\nallow = read\nallow = read\n",
+            []string{"FILE:3: warning: read is allowed again, first allowed at FILE:2"},
+        },
+        {
+            "unknown-syscall = ignore\nallow = execve, exit_group, no_such_call\n",
+            []string{"FILE:2: warning: syscall no_such_call does not exist on arch"},
+        },
+        {
+            "allow = execve, exit_group\nallow = @privileged\n",
+            []string{
+                "FILE:2: warning: dangerous syscall ptrace is allowed",
+                "FILE:2: warning: dangerous syscall mount is allowed",
+            },
+        },
+        {
+            "allow = read\nallow-any-syscalls = true\n",
+            []string{"FILE:2: warning: allow-any-syscalls disables the filter, the allow list has no effect"},
+        },
+        {
+            "allow = read\n",
+            []string{
+                "FILE: warning: execve is not allowed, the program cannot be started",
+                "FILE: warning: exit_group is not allowed, the program cannot exit normally",
+            },
+        },
+    }
+
+    for i, test := range tests {
+        name := writeConfig(t, dir, "test.conf", test.config)
+        warnings, err := checkConfigFile(newStderrLogger(), name)
+        if err != nil {
+            t.Errorf("Case %d: unexpected error %s", i, err)
+            continue
+        }
+
+        var lines []string
+        for _, warning := range warnings {
+            lines = append(lines, warning.String())
+        }
+        found := strings.Join(lines, "\n")
+
+        if len(test.expect) == 0 && len(warnings) > 0 {
+            t.Errorf("Case %d: expected no warnings, got:\n%s", i, found)
+        }
+
+        for _, expect := range test.expect {
+            if !strings.Contains(found, strings.Replace(expect, "FILE", name, -1)) {
+                t.Errorf("Case %d: expected warning %q, got:\n%s", i, expect, found)
+            }
+        }
+    }
+}
+
+func TestCheckCommandExitCodes(t *testing.T) {
+    dir, err := ioutil.TempDir("", "guarddog-lint")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    clean := writeConfig(t, dir, "clean.conf", "allow = execve, exit_group, read\n")
+    warned := writeConfig(t, dir, "warned.conf", "allow = execve, exit_group, read, read\n")
+    invalid := writeConfig(t, dir, "invalid.conf", "no-such-option = 1\n")
+
+    tests := []struct {
+        args        []string
+        code        int
+    }{
+        {[]string{clean}, 0},
+        {[]string{"-strict", clean}, 0},
+        {[]string{warned}, 0},
+        {[]string{"-strict", warned}, 2},
+        {[]string{invalid}, 1},
+        {[]string{"-strict", warned, invalid}, 1},
+    }
+
+    for _, test := range tests {
+        if code := checkCommand(test.args); code != test.code {
+            t.Errorf("Expected exit code %d for %v, got %d", test.code, test.args, code)
+        }
+    }
+}
@@ -1,32 +1,56 @@
 package main 
 
 import (
-    "flag"
+    "context"
     "fmt"
     "os"
+    "os/signal"
+    "strings"
+    "syscall"
     "guarddog/config"
+    "guarddog/policy"
+    "guarddog/sandbox"
     "guarddog/util"
     "guarddog/seccomphelper"
-    "guarddog/external/github.com/seccomp/libseccomp-golang"
 )
 
 func main() {
+    // Applies restrictions and executes a program in a process started by sandbox.Run
+    sandbox.Init()
+
+    if len(os.Args) > 1 {
+        if command := findCommand(commands, os.Args[1]); command != nil {
+            os.Exit(command.run(os.Args[2:]))
+        }
+    }
+
+    // Invocation without a command is the same as "run"
+    os.Exit(runCommand(os.Args[1:]))
+}
+
+/* Implements "guarddog run" command */
+func runCommand(args []string) int {
     p := config.NewConfigurationParser()
-    options, err := p.ParseNoValidate(os.Args[1:])
+    options, err := p.ParseNoValidate(args)
 
-    if err == flag.ErrHelp {
-        // Don't need to call p.PrintUsage()
-        os.Exit(0)
-    } else if err != nil {
-        // Don't need to print fmt.Fprintf(os.Stderr, "%s\n", err)
-        os.Exit(1)
+    if err != nil {
+        return reportParseError(err)
+    }
+
+    // Printed before validation to help finding invalid values
+    if options.PrintConfig {
+        err = p.WriteEffectiveConfig(os.Stdout, options, options.PrintConfigFormat)
+        if err != nil {
+            return printError(err)
+        }
+        return 0
     }
 
     err = options.Validate()    
 
     if err != nil {
         fmt.Fprintf(os.Stderr, "%s: invalid options: %s\n", config.PROGRAM_NAME, err)
-        os.Exit(1)
+        return 1
     }
 
     if options.StatusFd > 2 {
@@ -40,129 +64,195 @@ func main() {
 
     if err != nil {
         fmt.Fprintf(os.Stderr, "%s: failed to start logging: %s\n", config.PROGRAM_NAME, err)
-        os.Exit(1)
+        return 1
     }
 
+    logWarnings(logger, p.Warnings())
+
+    // Same as "guarddog syscalls", kept for compatibility
     if options.DumpSyscalls {
         dumpSyscalls()
-        os.Exit(0)
+        return 0
     }
 
-    if len(options.Command) > 0 {
-        err = executeCommand(logger, options, options.Command)
+    // Same as "guarddog policy export", kept for compatibility
+    if options.ExportPolicyFormat != "" {
+        err = exportPolicy(logger, &options.PolicyOptions, options.ExportPolicyFormat)
         if err != nil {
             logger.Error("%s", err)
-            os.Exit(1)
+            return 1
         }
-    } else {
+        return 0
+    }
+
+    if len(options.Command) == 0 {
         logger.Error("command not specified");
         p.PrintUsage()
-        os.Exit(1)
+        return 1
     }
+
+    return executeCommand(logger, options)
 }
 
-func dumpSyscalls() {
-    debugInfo := seccomphelper.GetLibraryInfo()
-    fmt.Printf(
-        "# arch %s, libseccomp version %s\n",
-        debugInfo.Arch, 
-        debugInfo.LibseccompVersion)
+/* 
+    Builds a policy from options and resolves it for the native arch,
+    reporting warnings and unknown syscalls
+ */
+func resolvePolicy(logger *util.Logger, options *config.PolicyOptions) (*policy.Policy, []seccomphelper.ResolvedRule, error) {
+    return resolvePolicyForArch(logger, options, "")
+}
+
+/* Same as resolvePolicy for given arch, empty name means the native arch */
+func resolvePolicyForArch(logger *util.Logger, options *config.PolicyOptions, archName string) (*policy.Policy, []seccomphelper.ResolvedRule, error) {
 
-    list := seccomphelper.GetSyscallNames()
-    for syscallInfo := range list {
-        fmt.Printf("%4d %s\n", syscallInfo.Number, syscallInfo.Name)
+    arch := archName
+    if arch == "" {
+        arch = seccomphelper.GetLibraryInfo().Arch
     }
-}
 
-func executeCommand(logger *util.Logger, options *config.GuarddogOptions, command []string) error {
+    p, warnings, err := options.BuildPolicy(arch)
+    if err != nil {
+        return nil, nil, err
+    }
 
-    // We need to be able to allocate memory 
-    requiredSyscalls := []string{"execve", "brk", "mmap2", "write"}
-    for _, name := range requiredSyscalls {
-        if !options.IsSyscallAllowed(name) {
-            logger.Info("syscall %s is not allowed, program might fail", name)
+    for _, warning := range warnings {
+        logger.Warning("%s", warning)
+    }
+
+    rules, unknown, err := seccomphelper.ResolvePolicyForArch(p, archName)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if len(unknown) > 0 && !options.AllowAnySyscalls {
+        switch options.UnknownSyscall {
+        case config.UNKNOWN_SYSCALL_ERROR:
+            return nil, nil, fmt.Errorf("syscalls do not exist on arch %s: %s", 
+                arch, strings.Join(unknown, ", "))
+        case config.UNKNOWN_SYSCALL_WARN:
+            logger.Warning("ignoring syscalls that do not exist on arch %s: %s", 
+                arch, strings.Join(unknown, ", "))
         }
     }
-    // Check that command is specified as an absolute path to an existing file?
 
-    err := seccomphelper.ExecuteWithSeccomp(
-        options.Verbose,
-        int(options.StatusFd),
-        config.PROGRAM_NAME,
-        options.AllowAnySyscalls,
-        options.Allow,
-        options.Trap,
-        command)
+    return p, rules, nil
+}
 
-    return err
+/* 
+    Runs a program in the sandbox and returns its exit code,
+    128 + signal number if it is killed by a signal
+ */
+func executeCommand(logger *util.Logger, options *config.GuarddogOptions) int {
 
-    // filter, err := prepareEnvironment(logger, options)
-    // if err != nil {
-    //     return err
-    // }
+    spec, err := newSandboxSpec(logger, options)
+    if err != nil {
+        logger.Error("%s", err)
+        return 1
+    }
 
-    // err = executeWithFilter(logger, filter, /* options.Timeout, */ options.Command)
-    // return err 
-}
+    lease, err := reserveUid(&options.SandboxOptions, spec)
+    if err != nil {
+        logger.Error("%s", err)
+        return 1
+    }
 
-func prepareEnvironment(logger *util.Logger, options *config.GuarddogOptions) (*seccomp.ScmpFilter, error) {
+    if lease != nil {
+        logger.Notice("running program with uid and gid %d", lease.Id)
+        defer func() {
+            if err := lease.Release(); err != nil {
+                logger.Error("%s", err)
+            }
+        }()
+    }
 
-    var filter *seccomp.ScmpFilter
-    var err error
+    // Interrupting guarddog kills the program
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
 
-    if !options.AllowAnySyscalls {
-        filter, err = seccomphelper.PrepareSeccompFilter(options.Allow, options.Trap)
-        if err != nil {
-            return nil, err
-        }
-        logger.Info("created seccomp filter")
-    } else {
-        logger.Info("skip creating seccomp filter")
+    result, err := sandbox.Run(ctx, spec)
+    if result == nil {
+        logger.Error("%s", err)
+        return 1
     }
 
-    if options.ChrootPath != "" {
-        err := util.ChrootInto(options.ChrootPath)
-        if err != nil {
-            return nil, err
-        }
-        logger.Info("chrooted into '%s'", options.ChrootPath)
+    if result.Signal != 0 {
+        logger.Info("program was killed by signal %s", result.Signal)
     }
 
-    err = util.ChangeUids(int(options.SetUid), int(options.SetGid), options.AllowRoot)
+    return result.ExitStatus()
+}
+
+/* Converts options of the run command into a sandbox spec */
+func newSandboxSpec(logger *util.Logger, options *config.GuarddogOptions) (*sandbox.Spec, error) {
+    p, rules, err := resolvePolicy(logger, &options.PolicyOptions)
     if err != nil {
         return nil, err
     }
 
-    logger.Info("uid=%d, gid=%d", os.Geteuid(), os.Getegid())
+    // We need to be able to allocate memory 
+    requiredSyscalls := []string{"execve", "brk", "mmap", "write"}
+    for _, name := range requiredSyscalls {
+        if !options.AllowAnySyscalls && !seccomphelper.IsSyscallAllowed(rules, name) {
+            logger.Info("syscall %s is not allowed, program might fail", name)
+        }
+    }
+
+    spec := sandbox.NewSpec(options.Command...)
+    spec.Env = os.Environ()
+    spec.Limits = p.Rlimits
+    applySandboxOptions(spec, &options.SandboxOptions)
+    spec.Stdin = os.Stdin
+    spec.Stdout = os.Stdout
+    spec.Stderr = os.Stderr
+    spec.Verbose = options.Verbose
+
+    if !options.AllowAnySyscalls {
+        spec.Policy = p
+        // Unknown syscalls are already reported according to -unknown-syscall
+        spec.IgnoreUnknownSyscalls = true
+    }
+
+    if options.Verbose {
+        spec.LogFile = os.NewFile(uintptr(options.StatusFd), "status")
+    }
 
-    return filter, nil
+    return spec, nil
 }
 
-func executeWithFilter(logger *util.Logger, filter *seccomp.ScmpFilter /* , timeout int */, command []string) error {
-    var err error 
+/* Sets restrictions shared by run and serve commands */
+func applySandboxOptions(spec *sandbox.Spec, options *config.SandboxOptions) {
+    spec.ChrootPath = options.ChrootPath
+    spec.Uid = int(options.SetUid)
+    spec.Gid = int(options.SetGid)
+    spec.AllowRoot = options.AllowRoot
+}
 
-    // if timeout != 0 {
-    //     err = lib.SetTimeout(timeout)
-    //     if err != nil {
-    //         return err
-    //     }
-    //     logger.Info("set timeout to %d seconds", timeout)
-    // }
+/*
+    Reserves an id from -uid-pool and sets it in a spec, returns nil if
+    the pool is not used. The lease must be released after the program
+    exits, this kills processes it left.
+ */
+func reserveUid(options *config.SandboxOptions, spec *sandbox.Spec) (*sandbox.UidLease, error) {
+    pool := newUidPool(options)
+    if pool == nil {
+        return nil, nil
+    }
 
-    err = util.SetParentDeathSignal()
+    lease, err := pool.Acquire()
     if err != nil {
-        return fmt.Errorf("failed to set PR_SET_PDEATHSIG signal: %s", err)
+        return nil, fmt.Errorf("cannot reserve an id from uid-pool: %s", err)
     }
 
-    if filter != nil {
-        err = seccomphelper.ApplySeccompFilter(filter)
-        if err != nil {
-            return err
-        }
-        logger.Info("applied seccomp filter")
+    spec.Uid = lease.Id
+    spec.Gid = lease.Id
+    return lease, nil
+}
+
+/* Returns the pool from -uid-pool, nil if it is not used */
+func newUidPool(options *config.SandboxOptions) *sandbox.UidPool {
+    if !options.UsesUidPool() {
+        return nil
     }
 
-    logger.Info("execting program %v", command)
-    err = util.ExecuteProgram(command)
-    return err 
+    return sandbox.NewUidPool(int(options.UidPool.Min), int(options.UidPool.Max), options.RuntimeDir)
 }
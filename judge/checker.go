@@ -0,0 +1,124 @@
+package judge
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+/*
+    Compares output of a program with the expected output. Returns
+    true if the output is accepted, otherwise a message describing
+    the first difference.
+ */
+type Checker func(expected []byte, output []byte) (bool, string)
+
+/* Names of checkers for LookupChecker */
+const (
+    CHECKER_EXACT = "exact"
+    CHECKER_TOKENS = "tokens"
+    CHECKER_FLOAT = "float"
+)
+
+var CheckerNames = []string{CHECKER_EXACT, CHECKER_TOKENS, CHECKER_FLOAT}
+
+/* Returns a checker by name, epsilon is used only by the float checker */
+func LookupChecker(name string, epsilon float64) (Checker, error) {
+    switch name {
+    case CHECKER_EXACT:
+        return Exact, nil
+    case CHECKER_TOKENS:
+        return Tokens, nil
+    case CHECKER_FLOAT:
+        return Floats(epsilon), nil
+    }
+
+    return nil, fmt.Errorf("unknown checker '%s', expected one of: %s",
+        name, strings.Join(CheckerNames, ", "))
+}
+
+/* Accepts output that is byte by byte equal to the expected one */
+func Exact(expected []byte, output []byte) (bool, string) {
+    if bytes.Equal(expected, output) {
+        return true, ""
+    }
+
+    expectedLines := bytes.Split(expected, []byte("\n"))
+    outputLines := bytes.Split(output, []byte("\n"))
+    for i := 0; i < len(expectedLines) && i < len(outputLines); i++ {
+        if !bytes.Equal(expectedLines[i], outputLines[i]) {
+            return false, fmt.Sprintf("line %d differs: expected %s, got %s",
+                i + 1, quote(expectedLines[i]), quote(outputLines[i]))
+        }
+    }
+
+    return false, fmt.Sprintf("expected %d lines, got %d", len(expectedLines), len(outputLines))
+}
+
+/*
+    Accepts output with the same tokens separated by any whitespace,
+    so extra spaces and a missing final newline are not errors
+ */
+func Tokens(expected []byte, output []byte) (bool, string) {
+    return compareTokens(expected, output, func(a string, b string) bool {
+        return a == b
+    })
+}
+
+/*
+    Returns a checker comparing tokens like Tokens, numbers are equal
+    if their absolute or relative difference is at most epsilon
+ */
+func Floats(epsilon float64) Checker {
+    return func(expected []byte, output []byte) (bool, string) {
+        return compareTokens(expected, output, func(want string, got string) bool {
+            if want == got {
+                return true
+            }
+
+            a, err := strconv.ParseFloat(want, 64)
+            if err != nil {
+                return false
+            }
+
+            b, err := strconv.ParseFloat(got, 64)
+            if err != nil {
+                return false
+            }
+
+            // NaN is never equal, so "nan" is accepted only if it is expected verbatim
+            diff := math.Abs(a - b)
+            return diff <= epsilon || diff <= epsilon * math.Abs(a)
+        })
+    }
+}
+
+func compareTokens(expected []byte, output []byte, equal func(want string, got string) bool) (bool, string) {
+    expectedTokens := strings.Fields(string(expected))
+    outputTokens := strings.Fields(string(output))
+
+    for i := 0; i < len(expectedTokens) && i < len(outputTokens); i++ {
+        if !equal(expectedTokens[i], outputTokens[i]) {
+            return false, fmt.Sprintf("token %d differs: expected %s, got %s",
+                i + 1, quote([]byte(expectedTokens[i])), quote([]byte(outputTokens[i])))
+        }
+    }
+
+    if len(expectedTokens) != len(outputTokens) {
+        return false, fmt.Sprintf("expected %d tokens, got %d", len(expectedTokens), len(outputTokens))
+    }
+
+    return true, ""
+}
+
+/* Maximum length of a line or a token in messages */
+const maxQuoted = 64
+
+func quote(value []byte) string {
+    if len(value) > maxQuoted {
+        return strconv.Quote(string(value[:maxQuoted])) + "..."
+    }
+    return strconv.Quote(string(value))
+}
@@ -0,0 +1,304 @@
+/*
+    Package judge runs a submission of an online judge in the sandbox
+    on one test and gives a verdict like OK or TLE along with measured
+    time and memory. Limits are enforced as follows:
+
+      - CPU time with RLIMIT_CPU, which is rounded up so the verdict is
+        decided by measured time, and wall time with a timeout
+      - memory by polling the peak resident set size (VmHWM) of the
+        program, which is killed when it goes over the limit. Polling
+        starts after exec, which resets VmHWM, so the guarddog process
+        that executes the program is not counted, unlike in ru_maxrss.
+        Children of the program and a peak in its last poll interval
+        are not measured.
+      - output size with RLIMIT_FSIZE, which also limits other files
+        the program writes
+ */
+package judge
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "math"
+    "os"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+
+    "guarddog/policy"
+    "guarddog/sandbox"
+)
+
+/* Values of Report.Verdict */
+const (
+    /* output is accepted by the checker */
+    VERDICT_OK = "OK"
+    /* wrong answer */
+    VERDICT_WA = "WA"
+    /* CPU or wall time limit exceeded */
+    VERDICT_TLE = "TLE"
+    /* memory limit exceeded */
+    VERDICT_MLE = "MLE"
+    /* runtime error: non-zero exit code or a signal */
+    VERDICT_RE = "RE"
+    /* security violation: a syscall forbidden by the policy */
+    VERDICT_SV = "SV"
+    /* output limit exceeded */
+    VERDICT_OLE = "OLE"
+)
+
+/* One run of a program on a test */
+type Task struct {
+    /* file given to the program as stdin */
+    Input       string
+    /* file with the expected output */
+    Expected    string
+    /* file receiving the output, empty means a temporary file */
+    Output      string
+    Checker     Checker
+
+    /* user and system CPU time */
+    TimeLimit   time.Duration
+    /* the program is killed after it, zero means twice TimeLimit */
+    WallTimeLimit time.Duration
+    /* peak resident set size of the program in bytes */
+    MemoryLimit int64
+    /* maximum size of the output in bytes */
+    OutputLimit int64
+}
+
+/* Verdict and resource usage, times are in seconds */
+type Report struct {
+    Verdict     string      `json:"verdict"`
+    /* user and system CPU time */
+    Time        float64     `json:"time"`
+    WallTime    float64     `json:"wall-time"`
+    /* peak resident set size in bytes, 0 if the program exited before it was read */
+    Memory      int64       `json:"memory"`
+    /* exit code, -1 if the program was killed by a signal */
+    ExitCode    int         `json:"exit-code"`
+    Signal      int         `json:"signal"`
+    /* difference found by the checker or why the program failed */
+    Message     string      `json:"message,omitempty"`
+}
+
+/* Interval of reading peak RSS of the program */
+const memoryPollInterval = 10 * time.Millisecond
+
+/*
+    Runs a program described by a spec on a test and checks its output.
+    Stdio and limits for CPU time and output size are set by Run, other
+    restrictions are taken from the spec. Errors mean that the program
+    could not be judged, e.g. it failed to execute or the context was
+    cancelled, all failures of the program are reported as verdicts.
+ */
+func Run(ctx context.Context, spec *sandbox.Spec, task *Task) (*Report, error) {
+    if task.TimeLimit <= 0 || task.MemoryLimit <= 0 || task.OutputLimit <= 0 {
+        return nil, errors.New("time, memory and output limits must be positive")
+    }
+
+    expected, err := ioutil.ReadFile(task.Expected)
+    if err != nil {
+        return nil, err
+    }
+
+    input, err := os.Open(task.Input)
+    if err != nil {
+        return nil, err
+    }
+    defer input.Close()
+
+    output, err := createOutput(task.Output)
+    if err != nil {
+        return nil, err
+    }
+    defer output.Close()
+    if task.Output == "" {
+        defer os.Remove(output.Name())
+    }
+
+    wallTimeLimit := task.WallTimeLimit
+    if wallTimeLimit == 0 {
+        wallTimeLimit = 2 * task.TimeLimit
+    }
+    wallCtx, cancel := context.WithTimeout(ctx, wallTimeLimit)
+    defer cancel()
+
+    cmd := sandbox.CommandFromSpec(wallCtx, spec)
+    cmd.Stdin = input
+    cmd.Stdout = output
+    cmd.Stderr = nil
+    cmd.Spec.Limits = task.rlimits(spec.Limits)
+
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+
+    // Start returns after exec, so the memory is only of the program
+    stop := make(chan struct{})
+    memoryWatcher := watchMemory(cmd.Process, task.MemoryLimit, stop)
+    err = cmd.Wait()
+    close(stop)
+    memory := <-memoryWatcher
+
+    if cmd.Result == nil {
+        return nil, err
+    }
+
+    if ctx.Err() != nil {
+        return nil, ctx.Err()
+    }
+
+    info, err := output.Stat()
+    if err != nil {
+        return nil, err
+    }
+
+    result := cmd.Result
+    report := &Report{
+        Time: (result.UserTime + result.SystemTime).Seconds(),
+        WallTime: result.WallTime.Seconds(),
+        Memory: memory.peak,
+        ExitCode: result.ExitCode,
+        Signal: int(result.Signal),
+    }
+
+    switch {
+    case result.IsViolation():
+        report.Verdict = VERDICT_SV
+        report.Message = "program made a syscall forbidden by the policy"
+    case info.Size() > task.OutputLimit || result.Signal == syscall.SIGXFSZ:
+        report.Verdict = VERDICT_OLE
+        report.Message = fmt.Sprintf("output is larger than %d bytes", task.OutputLimit)
+    case memory.killed || memory.peak > task.MemoryLimit:
+        report.Verdict = VERDICT_MLE
+        report.Message = fmt.Sprintf("memory usage is more than %d bytes", task.MemoryLimit)
+    case result.UserTime + result.SystemTime > task.TimeLimit:
+        report.Verdict = VERDICT_TLE
+        report.Message = fmt.Sprintf("CPU time is more than %s", task.TimeLimit)
+    case wallCtx.Err() != nil:
+        report.Verdict = VERDICT_TLE
+        report.Message = fmt.Sprintf("wall time is more than %s", wallTimeLimit)
+    case result.Signal != 0:
+        report.Verdict = VERDICT_RE
+        report.Message = fmt.Sprintf("program was killed by signal %s", result.Signal)
+    case result.ExitCode != 0:
+        report.Verdict = VERDICT_RE
+        report.Message = fmt.Sprintf("program exited with code %d", result.ExitCode)
+    default:
+        // The output is not larger than the limit here
+        content, err := ioutil.ReadFile(output.Name())
+        if err != nil {
+            return nil, err
+        }
+
+        ok, message := task.Checker(expected, content)
+        report.Verdict = VERDICT_WA
+        if ok {
+            report.Verdict = VERDICT_OK
+        }
+        report.Message = message
+    }
+
+    return report, nil
+}
+
+/*
+    Returns limits of the spec with CPU time and output size. The CPU
+    limit is rounded up and a second more than TimeLimit, so the kernel
+    stops the program even with a large wall time limit, and the output
+    can be a byte larger than OutputLimit to tell it was exceeded.
+ */
+func (task *Task) rlimits(limits []policy.Rlimit) []policy.Rlimit {
+    p := &policy.Policy{Rlimits: append([]policy.Rlimit{}, limits...)}
+    p.SetRlimit("cpu", uint64(math.Ceil(task.TimeLimit.Seconds())) + 1)
+    p.SetRlimit("fsize", uint64(task.OutputLimit) + 1)
+    return p.Rlimits
+}
+
+func createOutput(path string) (*os.File, error) {
+    if path == "" {
+        return ioutil.TempFile("", "guarddog-output")
+    }
+    return os.OpenFile(path, os.O_RDWR | os.O_CREATE | os.O_TRUNC, 0644)
+}
+
+/* Memory of the program found by watchMemory */
+type memoryUsage struct {
+    /* largest VmHWM read, 0 if the program exited before the first read */
+    peak        int64
+    /* the program was killed for going over the limit */
+    killed      bool
+}
+
+/*
+    Reads peak resident set size of the process right away and then
+    every memoryPollInterval and kills it when it goes over the limit.
+    It must be called after exec, so memory of guarddog is not counted.
+    The returned channel receives the usage after stop is closed.
+ */
+func watchMemory(process *os.Process, limit int64, stop <-chan struct{}) <-chan memoryUsage {
+    result := make(chan memoryUsage, 1)
+
+    go func() {
+        var usage memoryUsage
+        ticker := time.NewTicker(memoryPollInterval)
+        defer ticker.Stop()
+
+        for {
+            if peak, err := readPeakRss(process.Pid); err == nil && peak > usage.peak {
+                usage.peak = peak
+            }
+
+            // Kill fails if the process has already been waited for
+            if usage.peak > limit && process.Kill() == nil {
+                usage.killed = true
+                <-stop
+                result <- usage
+                return
+            }
+
+            select {
+            case <-stop:
+                result <- usage
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+
+    return result
+}
+
+/*
+    Reads peak resident set size of a process in bytes from VmHWM in
+    /proc/PID/status. Exec starts a new address space, so the peak is
+    only of the program that is executed.
+ */
+func readPeakRss(pid int) (int64, error) {
+    file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+    if err != nil {
+        return 0, err
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 3 && fields[0] == "VmHWM:" && fields[2] == "kB" {
+            kilobytes, err := strconv.ParseInt(fields[1], 10, 64)
+            return kilobytes * 1024, err
+        }
+    }
+
+    if err := scanner.Err(); err != nil {
+        return 0, err
+    }
+
+    // Zombies have no memory
+    return 0, nil
+}
@@ -0,0 +1,144 @@
+package judge
+
+import (
+    "context"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "guarddog/policy"
+    "guarddog/sandbox"
+)
+
+func TestMain(m *testing.M) {
+    // Run starts programs by executing the test binary
+    sandbox.Init()
+    os.Exit(m.Run())
+}
+
+func TestCheckers(t *testing.T) {
+    tests := []struct {
+        checker     Checker
+        expected    string
+        output      string
+        ok          bool
+    }{
+        {Exact, "1 2\n3\n", "1 2\n3\n", true},
+        {Exact, "1 2\n3\n", "1 2\n3", false},
+        {Exact, "1 2\n3\n", "1  2\n3\n", false},
+        {Tokens, "1 2\n3\n", "1  2 3", true},
+        {Tokens, "1 2\n3\n", "1 2", false},
+        {Tokens, "1 2\n3\n", "1 2 3 4", false},
+        {Tokens, "yes\n", "YES\n", false},
+        {Floats(1e-6), "0.5 3 abc\n", "0.5000001 3.0 abc", true},
+        {Floats(1e-6), "1000000\n", "1000000.5\n", true},
+        {Floats(1e-6), "0.5\n", "0.501\n", false},
+        {Floats(1e-6), "0.5\n", "nan\n", false},
+        {Floats(1e-6), "abc\n", "abd\n", false},
+    }
+
+    for _, test := range tests {
+        ok, message := test.checker([]byte(test.expected), []byte(test.output))
+        if ok != test.ok || (!ok && message == "") {
+            t.Errorf("Expected %t for %q and %q, got %t with message %q",
+                test.ok, test.expected, test.output, ok, message)
+        }
+    }
+
+    if _, err := LookupChecker("diff", 0); err == nil {
+        t.Errorf("Expected an error for unknown checker")
+    }
+}
+
+func TestVerdicts(t *testing.T) {
+    dir, err := ioutil.TempDir("", "guarddog-judge")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    input := filepath.Join(dir, "input.txt")
+    expected := filepath.Join(dir, "expected.txt")
+    ioutil.WriteFile(input, []byte("2 3\n"), 0644)
+    ioutil.WriteFile(expected, []byte("5\n"), 0644)
+
+    forbidUname := policy.New(policy.Allow)
+    forbidUname.AddRule(policy.Rule{Syscall: "uname", Action: policy.Kill})
+
+    tests := []struct {
+        script      string
+        policy      *policy.Policy
+        verdict     string
+    }{
+        {"read a b; echo $((a + b))", nil, VERDICT_OK},
+        {"read a b; echo $((a * b))", nil, VERDICT_WA},
+        {"exit 3", nil, VERDICT_RE},
+        {"kill -SEGV $$", nil, VERDICT_RE},
+        {"while :; do :; done", nil, VERDICT_TLE},
+        {"sleep 10", nil, VERDICT_TLE},
+        {"exec uname", forbidUname, VERDICT_SV},
+        {"while :; do echo 5; done", nil, VERDICT_OLE},
+        {"x=$(head -c 100000000 /dev/zero | tr '\\0' a); echo 5", nil, VERDICT_MLE},
+    }
+
+    for _, test := range tests {
+        spec := sandbox.NewSpec("/bin/sh", "-c", test.script)
+        spec.AllowRoot = true
+        spec.Policy = test.policy
+
+        task := &Task{
+            Input: input,
+            Expected: expected,
+            Checker: Tokens,
+            TimeLimit: 500 * time.Millisecond,
+            MemoryLimit: 64 << 20,
+            OutputLimit: 1 << 16,
+        }
+
+        report, err := Run(context.Background(), spec, task)
+        if err != nil {
+            t.Errorf("Run failed for %q: %s", test.script, err)
+            continue
+        }
+
+        // Memory is read a few times while a program runs for the time limit
+        if report.Verdict != test.verdict || (report.Verdict == VERDICT_TLE && report.Memory <= 0) {
+            t.Errorf("Expected %s for %q, got %+v", test.verdict, test.script, report)
+        }
+    }
+}
+
+func TestSmallMemoryLimit(t *testing.T) {
+    dir, err := ioutil.TempDir("", "guarddog-judge")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    // Empty input and expected output
+    input := filepath.Join(dir, "input.txt")
+    ioutil.WriteFile(input, nil, 0644)
+
+    // Memory of guarddog that executes the program is larger than the limit
+    spec := sandbox.NewSpec("/bin/sleep", "0.1")
+    spec.AllowRoot = true
+    task := &Task{
+        Input: input,
+        Expected: input,
+        Checker: Exact,
+        TimeLimit: time.Second,
+        MemoryLimit: 4 << 20,
+        OutputLimit: 1 << 16,
+    }
+
+    report, err := Run(context.Background(), spec, task)
+    if err != nil {
+        t.Fatalf("Run failed: %s", err)
+    }
+
+    if report.Verdict != VERDICT_OK || report.Memory <= 0 || report.Memory > task.MemoryLimit {
+        t.Errorf("Expected OK with memory under %d, got %+v", task.MemoryLimit, report)
+    }
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os/signal"
+    "syscall"
+    "guarddog/config"
+    "guarddog/judge"
+    "guarddog/sandbox"
+)
+
+/*
+    Implements "guarddog judge" command that prints a report with
+    the verdict in JSON. Exit code is 0 for OK, 2 for other verdicts
+    and 1 if the program cannot be judged.
+ */
+func judgeCommand(args []string) int {
+    options := config.NewJudgeOptions()
+    usage := "judge -input=FILE -expected=FILE -time-limit=TIME -memory-limit=SIZE [options] -- command [args]"
+    if ok, code := parseCommandOptions(usage, options, args); !ok {
+        return code
+    }
+
+    logger := newStderrLogger()
+    checker, err := judge.LookupChecker(options.Checker, options.Epsilon)
+    if err != nil {
+        return printError(err)
+    }
+
+    p, _, err := resolvePolicy(logger, &options.PolicyOptions)
+    if err != nil {
+        return printError(err)
+    }
+
+    spec := sandbox.NewSpec(options.Command...)
+    spec.Limits = p.Rlimits
+    applySandboxOptions(spec, &options.SandboxOptions)
+    if !options.AllowAnySyscalls {
+        spec.Policy = p
+        // Unknown syscalls are already reported according to -unknown-syscall
+        spec.IgnoreUnknownSyscalls = true
+    }
+
+    lease, err := reserveUid(&options.SandboxOptions, spec)
+    if err != nil {
+        return printError(err)
+    }
+
+    if lease != nil {
+        defer func() {
+            if err := lease.Release(); err != nil {
+                logger.Error("%s", err)
+            }
+        }()
+    }
+
+    task := &judge.Task{
+        Input: options.Input,
+        Expected: options.Expected,
+        Output: options.Output,
+        Checker: checker,
+        TimeLimit: options.TimeLimit,
+        WallTimeLimit: options.WallTimeLimit,
+        MemoryLimit: int64(options.MemoryLimit),
+        OutputLimit: int64(options.OutputLimit),
+    }
+
+    // Interrupting guarddog kills the program
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    report, err := judge.Run(ctx, spec, task)
+    if err != nil {
+        return printError(err)
+    }
+
+    content, err := json.MarshalIndent(report, "", "  ")
+    if err != nil {
+        return printError(err)
+    }
+    fmt.Println(string(content))
+
+    if report.Verdict != judge.VERDICT_OK {
+        return 2
+    }
+    return 0
+}
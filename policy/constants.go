@@ -0,0 +1,189 @@
+package policy
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "syscall"
+)
+
+/*
+    Symbolic names for errno values and syscall arguments.
+    Values are taken from the syscall package so they match
+    the native arch.
+ */
+
+const EPERM = int(syscall.EPERM)
+
+/* ioctl requests missing in syscall package, values for x86 and arm */
+const (
+    FIONCLEX = 0x5450
+    FIOCLEX = 0x5451
+)
+
+var errnoNames = map[string]syscall.Errno{
+    "EPERM": syscall.EPERM,
+    "ENOENT": syscall.ENOENT,
+    "ESRCH": syscall.ESRCH,
+    "EINTR": syscall.EINTR,
+    "EIO": syscall.EIO,
+    "ENXIO": syscall.ENXIO,
+    "E2BIG": syscall.E2BIG,
+    "ENOEXEC": syscall.ENOEXEC,
+    "EBADF": syscall.EBADF,
+    "ECHILD": syscall.ECHILD,
+    "EAGAIN": syscall.EAGAIN,
+    "ENOMEM": syscall.ENOMEM,
+    "EACCES": syscall.EACCES,
+    "EFAULT": syscall.EFAULT,
+    "EBUSY": syscall.EBUSY,
+    "EEXIST": syscall.EEXIST,
+    "EXDEV": syscall.EXDEV,
+    "ENODEV": syscall.ENODEV,
+    "ENOTDIR": syscall.ENOTDIR,
+    "EISDIR": syscall.EISDIR,
+    "EINVAL": syscall.EINVAL,
+    "ENFILE": syscall.ENFILE,
+    "EMFILE": syscall.EMFILE,
+    "ENOTTY": syscall.ENOTTY,
+    "EFBIG": syscall.EFBIG,
+    "ENOSPC": syscall.ENOSPC,
+    "ESPIPE": syscall.ESPIPE,
+    "EROFS": syscall.EROFS,
+    "EPIPE": syscall.EPIPE,
+    "ERANGE": syscall.ERANGE,
+    "ENOSYS": syscall.ENOSYS,
+    "EAFNOSUPPORT": syscall.EAFNOSUPPORT,
+    "EADDRINUSE": syscall.EADDRINUSE,
+    "ECONNREFUSED": syscall.ECONNREFUSED,
+    "ENETUNREACH": syscall.ENETUNREACH,
+    "EOPNOTSUPP": syscall.EOPNOTSUPP,
+}
+
+/* Parses errno given as a number or a name like "EPERM" */
+func ParseErrno(s string) (int, error) {
+    if errno, ok := errnoNames[s]; ok {
+        return int(errno), nil
+    }
+
+    errno, err := strconv.ParseUint(s, 10, 16)
+    if err != nil {
+        return 0, fmt.Errorf("invalid errno '%s'", s)
+    }
+
+    return int(errno), nil
+}
+
+/* Returns a name like "EPERM" for errno value or a number if name is unknown */
+func ErrnoName(errno int) string {
+    for name, value := range errnoNames {
+        if int(value) == errno {
+            return name
+        }
+    }
+
+    return strconv.Itoa(errno)
+}
+
+var argumentConstants = map[string]uint64{
+    "AF_UNIX": syscall.AF_UNIX,
+    "AF_INET": syscall.AF_INET,
+    "AF_INET6": syscall.AF_INET6,
+    "AF_NETLINK": syscall.AF_NETLINK,
+    "AF_PACKET": syscall.AF_PACKET,
+
+    "SOCK_STREAM": syscall.SOCK_STREAM,
+    "SOCK_DGRAM": syscall.SOCK_DGRAM,
+    "SOCK_RAW": syscall.SOCK_RAW,
+    "SOCK_SEQPACKET": syscall.SOCK_SEQPACKET,
+    "SOCK_NONBLOCK": syscall.SOCK_NONBLOCK,
+    "SOCK_CLOEXEC": syscall.SOCK_CLOEXEC,
+
+    "O_RDONLY": syscall.O_RDONLY,
+    "O_WRONLY": syscall.O_WRONLY,
+    "O_RDWR": syscall.O_RDWR,
+    "O_ACCMODE": syscall.O_ACCMODE,
+    "O_CREAT": syscall.O_CREAT,
+    "O_EXCL": syscall.O_EXCL,
+    "O_TRUNC": syscall.O_TRUNC,
+    "O_APPEND": syscall.O_APPEND,
+    "O_NONBLOCK": syscall.O_NONBLOCK,
+    "O_DIRECTORY": syscall.O_DIRECTORY,
+    "O_NOFOLLOW": syscall.O_NOFOLLOW,
+    "O_CLOEXEC": syscall.O_CLOEXEC,
+
+    "PROT_NONE": syscall.PROT_NONE,
+    "PROT_READ": syscall.PROT_READ,
+    "PROT_WRITE": syscall.PROT_WRITE,
+    "PROT_EXEC": syscall.PROT_EXEC,
+
+    "MAP_SHARED": syscall.MAP_SHARED,
+    "MAP_PRIVATE": syscall.MAP_PRIVATE,
+    "MAP_FIXED": syscall.MAP_FIXED,
+    "MAP_ANONYMOUS": syscall.MAP_ANONYMOUS,
+
+    "CLONE_VM": syscall.CLONE_VM,
+    "CLONE_FS": syscall.CLONE_FS,
+    "CLONE_FILES": syscall.CLONE_FILES,
+    "CLONE_SIGHAND": syscall.CLONE_SIGHAND,
+    "CLONE_THREAD": syscall.CLONE_THREAD,
+    "CLONE_NEWNS": syscall.CLONE_NEWNS,
+    "CLONE_NEWUSER": syscall.CLONE_NEWUSER,
+    "CLONE_NEWPID": syscall.CLONE_NEWPID,
+    "CLONE_NEWNET": syscall.CLONE_NEWNET,
+
+    "F_GETFD": syscall.F_GETFD,
+    "F_SETFD": syscall.F_SETFD,
+    "F_GETFL": syscall.F_GETFL,
+    "F_SETFL": syscall.F_SETFL,
+    "F_DUPFD": syscall.F_DUPFD,
+    "F_DUPFD_CLOEXEC": syscall.F_DUPFD_CLOEXEC,
+
+    "TCGETS": syscall.TCGETS,
+    "TIOCGWINSZ": syscall.TIOCGWINSZ,
+    "FIOCLEX": FIOCLEX,
+    "FIONCLEX": FIONCLEX,
+}
+
+/* Returns a value of a named constant like "AF_UNIX" */
+func LookupConstant(name string) (uint64, bool) {
+    value, ok := argumentConstants[name]
+    return value, ok
+}
+
+/* Returns sorted names of all known constants */
+func ConstantNames() []string {
+    names := make([]string, 0, len(argumentConstants))
+    for name := range argumentConstants {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+/*
+    Parses a number or a constant name. Several constants
+    can be combined with '|', e.g. "O_WRONLY|O_CREAT".
+ */
+func ParseValue(s string) (uint64, error) {
+    var result uint64
+    parts := splitAndTrim(s, "|")
+    if len(parts) == 0 {
+        return 0, fmt.Errorf("value cannot be empty")
+    }
+
+    for _, part := range parts {
+        if value, ok := LookupConstant(part); ok {
+            result |= value
+            continue
+        }
+
+        value, err := ParseNumber(part)
+        if err != nil {
+            return 0, fmt.Errorf("'%s' is neither a number nor a known constant", part)
+        }
+        result |= value
+    }
+
+    return result, nil
+}
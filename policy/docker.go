@@ -0,0 +1,390 @@
+package policy
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "strconv"
+    "strings"
+    "syscall"
+)
+
+/*
+    Docker and OCI seccomp profiles, see
+    https://github.com/moby/moby/blob/master/profiles/seccomp/default.json
+ */
+type dockerProfile struct {
+    DefaultAction   string          `json:"defaultAction"`
+    DefaultErrnoRet *int            `json:"defaultErrnoRet,omitempty"`
+    Architectures   []string        `json:"architectures,omitempty"`
+    Syscalls        []dockerSyscall `json:"syscalls"`
+}
+
+type dockerSyscall struct {
+    /* Old profiles use a single name */
+    Name            string          `json:"name,omitempty"`
+    Names           []string        `json:"names,omitempty"`
+    Action          string          `json:"action"`
+    ErrnoRet        *int            `json:"errnoRet,omitempty"`
+    Args            []dockerArg     `json:"args,omitempty"`
+    Includes        *dockerFilter   `json:"includes,omitempty"`
+    Excludes        *dockerFilter   `json:"excludes,omitempty"`
+}
+
+type dockerArg struct {
+    Index           uint            `json:"index"`
+    Value           uint64          `json:"value"`
+    ValueTwo        uint64          `json:"valueTwo"`
+    Op              string          `json:"op"`
+}
+
+type dockerFilter struct {
+    Arches          []string        `json:"arches,omitempty"`
+    Caps            []string        `json:"caps,omitempty"`
+    MinKernel       string          `json:"minKernel,omitempty"`
+}
+
+/* libseccomp arch names used in "architectures" and their names in libseccomp-golang */
+var dockerArchs = map[string]string{
+    "SCMP_ARCH_X86": "x86",
+    "SCMP_ARCH_X86_64": "amd64",
+    "SCMP_ARCH_X32": "x32",
+    "SCMP_ARCH_ARM": "arm",
+    "SCMP_ARCH_AARCH64": "arm64",
+    "SCMP_ARCH_MIPS": "mips",
+    "SCMP_ARCH_MIPS64": "mips64",
+    "SCMP_ARCH_MIPS64N32": "mips64n32",
+    "SCMP_ARCH_MIPSEL": "mipsel",
+    "SCMP_ARCH_MIPSEL64": "mipsel64",
+    "SCMP_ARCH_MIPSEL64N32": "mipsel64n32",
+    "SCMP_ARCH_PPC": "ppc",
+    "SCMP_ARCH_PPC64": "ppc64",
+    "SCMP_ARCH_PPC64LE": "ppc64le",
+    "SCMP_ARCH_S390": "s390",
+    "SCMP_ARCH_S390X": "s390x",
+}
+
+var dockerOperators = map[string]Operator{
+    "SCMP_CMP_EQ": OP_EQ,
+    "SCMP_CMP_NE": OP_NE,
+    "SCMP_CMP_LT": OP_LT,
+    "SCMP_CMP_LE": OP_LE,
+    "SCMP_CMP_GT": OP_GT,
+    "SCMP_CMP_GE": OP_GE,
+    "SCMP_CMP_MASKED_EQ": OP_MASKED_EQ,
+}
+
+type dockerImporter struct {
+    arch            string
+    /* release of the running kernel like "5.10.0", used for minKernel */
+    kernel          string
+    warnings        []string
+}
+
+/*
+    Converts a Docker seccomp profile into a policy for given arch.
+    Rules that cannot be represented exactly, for example rules
+    depending on capabilities, are reported in warnings.
+ */
+func ImportDockerProfile(fileName string, arch string) (*Policy, []string, error) {
+    content, err := ioutil.ReadFile(fileName)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    importer := &dockerImporter{arch: arch, kernel: kernelRelease()}
+    p, err := importer.convert(content)
+    if err != nil {
+        return nil, nil, fmt.Errorf("%s: %s", fileName, err)
+    }
+
+    return p, importer.warnings, nil
+}
+
+func (importer *dockerImporter) warn(format string, args ...interface{}) {
+    importer.warnings = append(importer.warnings, fmt.Sprintf(format, args...))
+}
+
+func (importer *dockerImporter) convert(content []byte) (*Policy, error) {
+    var profile dockerProfile
+    if err := json.Unmarshal(content, &profile); err != nil {
+        return nil, describeJsonError(content, err)
+    }
+
+    defaultAction, supported, err := importer.convertAction(
+        profile.DefaultAction, profile.DefaultErrnoRet, "defaultAction")
+    if err != nil {
+        return nil, err
+    }
+
+    if !supported {
+        return nil, fmt.Errorf("defaultAction %s is not supported", profile.DefaultAction)
+    }
+
+    if len(profile.Architectures) > 0 {
+        found := false
+        for _, name := range profile.Architectures {
+            if _, ok := dockerArchs[name]; !ok {
+                importer.warn("unknown architecture %s", name)
+            }
+            found = found || dockerArchs[name] == importer.arch
+        }
+
+        if !found {
+            importer.warn("profile does not list native architecture %s", importer.arch)
+        }
+    }
+
+    result := New(defaultAction)
+
+    for i, entry := range profile.Syscalls {
+        names := entry.Names
+        if entry.Name != "" {
+            names = append([]string{entry.Name}, names...)
+        }
+
+        location := fmt.Sprintf("syscalls[%d] (%s)", i, strings.Join(names, ", "))
+        if len(names) == 0 {
+            return nil, fmt.Errorf("syscalls[%d]: no syscall names", i)
+        }
+
+        if !importer.matchesFilters(entry, location) {
+            continue
+        }
+
+        action, supported, err := importer.convertAction(entry.Action, entry.ErrnoRet, location)
+        if err != nil {
+            return nil, err
+        }
+
+        if !supported {
+            continue
+        }
+
+        conditionSets, err := convertDockerArgs(entry.Args)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %s", location, err)
+        }
+
+        for _, name := range names {
+            for _, conditions := range conditionSets {
+                // Docker profiles list syscalls for all archs and ignore unknown names
+                result.AddRule(Rule{Syscall: name, Action: action, Conditions: conditions, Optional: true})
+            }
+        }
+    }
+
+    return result, nil
+}
+
+/*
+    Converts action name, returns supported = false
+    if the rule should be skipped
+ */
+func (importer *dockerImporter) convertAction(name string, errnoRet *int, location string) (Action, bool, error) {
+    switch name {
+    case "SCMP_ACT_ALLOW":
+        return Allow, true, nil
+    case "SCMP_ACT_ERRNO":
+        if errnoRet != nil {
+            return Errno(*errnoRet), true, nil
+        }
+        return Errno(EPERM), true, nil
+    case "SCMP_ACT_KILL", "SCMP_ACT_KILL_THREAD":
+        importer.warn("%s: %s is replaced with kill, the whole process is killed instead of the calling thread",
+            location, name)
+        return Kill, true, nil
+    case "SCMP_ACT_KILL_PROCESS":
+        return Kill, true, nil
+    case "SCMP_ACT_TRAP":
+        return Trap, true, nil
+    case "SCMP_ACT_TRACE":
+        // Without a tracer the kernel returns ENOSYS for SCMP_ACT_TRACE
+        importer.warn("%s: SCMP_ACT_TRACE is replaced with errno:ENOSYS, tracing is not supported", location)
+        return Errno(int(syscall.ENOSYS)), true, nil
+    case "SCMP_ACT_LOG":
+        importer.warn("%s: SCMP_ACT_LOG is replaced with allow, logging is not supported", location)
+        return Allow, true, nil
+    case "SCMP_ACT_NOTIFY":
+        importer.warn("%s: SCMP_ACT_NOTIFY is not supported, rule is skipped", location)
+        return Action{}, false, nil
+    case "":
+        return Action{}, false, fmt.Errorf("%s: action is missing", location)
+    }
+
+    return Action{}, false, fmt.Errorf("%s: unknown action %s", location, name)
+}
+
+/* Checks includes and excludes, returns false if the rule does not apply */
+func (importer *dockerImporter) matchesFilters(entry dockerSyscall, location string) bool {
+    if includes := entry.Includes; includes != nil {
+        if len(includes.Arches) > 0 && !containsString(includes.Arches, importer.arch) {
+            return false
+        }
+
+        if includes.MinKernel != "" && compareKernelVersions(importer.kernel, includes.MinKernel) < 0 {
+            return false
+        }
+
+        if len(includes.Caps) > 0 {
+            importer.warn("%s: rule requires capabilities %s which cannot be checked, rule is skipped",
+                location, strings.Join(includes.Caps, ", "))
+            return false
+        }
+    }
+
+    if excludes := entry.Excludes; excludes != nil {
+        if containsString(excludes.Arches, importer.arch) {
+            return false
+        }
+
+        if excludes.MinKernel != "" && compareKernelVersions(importer.kernel, excludes.MinKernel) >= 0 {
+            return false
+        }
+
+        if len(excludes.Caps) > 0 {
+            importer.warn("%s: rule is excluded for capabilities %s, it is applied assuming the program has none",
+                location, strings.Join(excludes.Caps, ", "))
+        }
+    }
+
+    return true
+}
+
+/*
+    Converts arguments into lists of conditions. Like runc, if several
+    conditions check the same argument, every condition becomes a
+    separate rule (they are joined with OR), otherwise all conditions
+    form a single rule (joined with AND).
+ */
+func convertDockerArgs(args []dockerArg) ([][]Condition, error) {
+    if len(args) == 0 {
+        return [][]Condition{nil}, nil
+    }
+
+    var conditions []Condition
+    seenIndexes := make(map[uint]bool)
+    sameIndex := false
+
+    for _, arg := range args {
+        op, ok := dockerOperators[arg.Op]
+        if !ok {
+            return nil, fmt.Errorf("unknown comparison operator %s", arg.Op)
+        }
+
+        condition := Condition{Arg: arg.Index, Op: op, Value: arg.Value}
+        if op == OP_MASKED_EQ {
+            // Docker passes mask in value and expected result in valueTwo
+            condition.Mask = arg.Value
+            condition.Value = arg.ValueTwo
+        }
+
+        if err := condition.Validate(); err != nil {
+            return nil, err
+        }
+
+        sameIndex = sameIndex || seenIndexes[arg.Index]
+        seenIndexes[arg.Index] = true
+        conditions = append(conditions, condition)
+    }
+
+    if !sameIndex {
+        return [][]Condition{conditions}, nil
+    }
+
+    var result [][]Condition
+    for _, condition := range conditions {
+        result = append(result, []Condition{condition})
+    }
+
+    return result, nil
+}
+
+/* Adds a line and a column to JSON errors */
+func describeJsonError(content []byte, err error) error {
+    var offset int64 = -1
+    switch jsonErr := err.(type) {
+    case *json.SyntaxError:
+        offset = jsonErr.Offset
+    case *json.UnmarshalTypeError:
+        offset = jsonErr.Offset
+    }
+
+    if offset < 0 || offset > int64(len(content)) {
+        return err
+    }
+
+    line, col := 1, 1
+    for _, c := range content[:offset] {
+        if c == '\n' {
+            line++
+            col = 1
+        } else {
+            col++
+        }
+    }
+
+    return fmt.Errorf("line %d, column %d: %s", line, col, err)
+}
+
+func kernelRelease() string {
+    var uts syscall.Utsname
+    if err := syscall.Uname(&uts); err != nil {
+        return ""
+    }
+
+    var release []byte
+    for _, c := range uts.Release {
+        if c == 0 {
+            break
+        }
+        release = append(release, byte(c))
+    }
+
+    return string(release)
+}
+
+/* Compares versions like "5.10" and "5.4.0-generic", returns -1, 0 or 1 */
+func compareKernelVersions(a string, b string) int {
+    partsA, partsB := parseKernelVersion(a), parseKernelVersion(b)
+    for i := 0; i < len(partsA) || i < len(partsB); i++ {
+        var x, y int
+        if i < len(partsA) {
+            x = partsA[i]
+        }
+        if i < len(partsB) {
+            y = partsB[i]
+        }
+
+        if x != y {
+            if x < y {
+                return -1
+            }
+            return 1
+        }
+    }
+
+    return 0
+}
+
+func parseKernelVersion(version string) []int {
+    var result []int
+    for _, part := range strings.Split(version, ".") {
+        end := 0
+        for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+            end++
+        }
+
+        number, err := strconv.Atoi(part[:end])
+        if err != nil {
+            break
+        }
+        result = append(result, number)
+
+        if end < len(part) {
+            break
+        }
+    }
+
+    return result
+}
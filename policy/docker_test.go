@@ -0,0 +1,123 @@
+package policy
+
+import (
+    "strings"
+    "testing"
+)
+
+const testDockerProfile = `{
+    "defaultAction": "SCMP_ACT_ERRNO",
+    "defaultErrnoRet": 1,
+    "architectures": ["SCMP_ARCH_X86_64", "SCMP_ARCH_X86", "SCMP_ARCH_X32"],
+    "syscalls": [
+        {"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"},
+        {"name": "socket", "action": "SCMP_ACT_ALLOW",
+            "args": [
+                {"index": 0, "value": 1, "valueTwo": 0, "op": "SCMP_CMP_EQ"},
+                {"index": 0, "value": 2, "valueTwo": 0, "op": "SCMP_CMP_EQ"}
+            ]},
+        {"names": ["clone"], "action": "SCMP_ACT_ALLOW",
+            "args": [{"index": 0, "value": 2114060288, "valueTwo": 0, "op": "SCMP_CMP_MASKED_EQ"}],
+            "excludes": {"caps": ["CAP_SYS_ADMIN"], "arches": ["s390x"]}},
+        {"names": ["mount"], "action": "SCMP_ACT_ALLOW",
+            "includes": {"caps": ["CAP_SYS_ADMIN"]}},
+        {"names": ["arch_prctl"], "action": "SCMP_ACT_ALLOW",
+            "includes": {"arches": ["amd64", "x32"]}},
+        {"names": ["s390_pci_mmio_read"], "action": "SCMP_ACT_ALLOW",
+            "includes": {"arches": ["s390x"]}},
+        {"names": ["io_uring_setup"], "action": "SCMP_ACT_ALLOW",
+            "includes": {"minKernel": "5.1"}},
+        {"names": ["ptrace"], "action": "SCMP_ACT_ERRNO", "errnoRet": 38}
+    ]
+}`
+
+func TestImportDockerProfile(t *testing.T) {
+    importer := &dockerImporter{arch: "amd64", kernel: "4.19.0-generic"}
+    p, err := importer.convert([]byte(testDockerProfile))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if p.DefaultAction != Errno(1) {
+        t.Errorf("Invalid default action: %s", p.DefaultAction)
+    }
+
+    var rules []string
+    for _, rule := range p.Rules {
+        if !rule.Optional {
+            t.Errorf("Imported rule '%s' must be optional", rule)
+        }
+        rules = append(rules, rule.String())
+    }
+
+    expected := []string{
+        "read: allow",
+        "write: allow",
+        "socket: allow if arg0 == 0x1",
+        "socket: allow if arg0 == 0x2",
+        "clone: allow if arg0 & 0x7e020000 == 0x0",
+        "arch_prctl: allow",
+        "ptrace: errno:38",
+    }
+
+    if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+        t.Errorf("Invalid rules:\n%s\nexpected:\n%s", strings.Join(rules, "\n"),
+            strings.Join(expected, "\n"))
+    }
+
+    warnings := strings.Join(importer.warnings, "\n")
+    if len(importer.warnings) != 2 ||
+        !strings.Contains(warnings, "syscalls[3] (mount): rule requires capabilities CAP_SYS_ADMIN") ||
+        !strings.Contains(warnings, "syscalls[2] (clone): rule is excluded for capabilities") {
+        t.Errorf("Invalid warnings:\n%s", warnings)
+    }
+}
+
+func TestImportDockerKillActions(t *testing.T) {
+    importer := &dockerImporter{arch: "amd64"}
+    p, err := importer.convert([]byte(`{"defaultAction": "SCMP_ACT_KILL_PROCESS", "syscalls": [
+        {"names": ["ptrace"], "action": "SCMP_ACT_KILL_THREAD"}]}`))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if p.DefaultAction != Kill || p.Rules[0].Action != Kill {
+        t.Errorf("Expected kill actions, got %s and %v", p.DefaultAction, p.Rules)
+    }
+
+    // Only the thread kill changes its meaning
+    if len(importer.warnings) != 1 ||
+            !strings.Contains(importer.warnings[0], "syscalls[0] (ptrace): SCMP_ACT_KILL_THREAD is replaced with kill") {
+        t.Errorf("Invalid warnings: %q", importer.warnings)
+    }
+}
+
+func TestImportDockerProfileErrors(t *testing.T) {
+    testDockerError(t, `{"defaultAction": "SCMP_ACT_NOTIFY"}`, "is not supported")
+    testDockerError(t, `{"defaultAction": "SCMP_ACT_KILL", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_FOO"}]}`,
+        "syscalls[0] (read): unknown action SCMP_ACT_FOO")
+    testDockerError(t, `{"defaultAction": "SCMP_ACT_KILL", "syscalls": [{"names": ["read"], "action": "SCMP_ACT_ALLOW",
+        "args": [{"index": 6, "value": 0, "op": "SCMP_CMP_EQ"}]}]}`, "argument index 6 is out of range")
+    testDockerError(t, "{\n  \"defaultAction\": 1\n}", "line 2, column")
+}
+
+func testDockerError(t *testing.T, content string, expect string) {
+    importer := &dockerImporter{arch: "amd64"}
+    _, err := importer.convert([]byte(content))
+    if err == nil {
+        t.Errorf("Expected error for %s", content)
+        return
+    }
+
+    if !strings.Contains(err.Error(), expect) {
+        t.Errorf("Error '%s' does not contain '%s'", err, expect)
+    }
+}
+
+func TestCompareKernelVersions(t *testing.T) {
+    if compareKernelVersions("5.10.0-8-amd64", "5.4") != 1 ||
+        compareKernelVersions("4.19", "5.1") != -1 ||
+        compareKernelVersions("5.1.0", "5.1") != 0 {
+        t.Errorf("Invalid kernel version comparison")
+    }
+}
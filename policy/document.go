@@ -0,0 +1,117 @@
+package policy
+
+import (
+    "fmt"
+    "strings"
+)
+
+/*
+    Parsed JSON or YAML document. Every node remembers its position
+    so that errors found during validation can point to the exact
+    place in the file.
+ */
+type nodeKind int
+
+const (
+    NODE_SCALAR nodeKind = iota
+    NODE_LIST
+    NODE_MAP
+)
+
+type node struct {
+    kind        nodeKind
+    line        int
+    col         int
+    /* value of a scalar */
+    value       string
+    /* true for quoted scalars, they are never treated as null */
+    quoted      bool
+    /* items of a list */
+    items       []*node
+    /* keys and values of a map in the order they appear in the file */
+    keys        []*node
+    values      []*node
+}
+
+/* Error with a location in a policy file */
+type DocumentError struct {
+    File        string
+    Line        int
+    Col         int
+    /* path to the value like "rules[2].action", can be empty */
+    Path        string
+    Message     string
+}
+
+func (err *DocumentError) Error() string {
+    location := fmt.Sprintf("%s:%d:%d", err.File, err.Line, err.Col)
+    if err.Path == "" {
+        return fmt.Sprintf("%s: %s", location, err.Message)
+    }
+
+    return fmt.Sprintf("%s: %s: %s", location, err.Path, err.Message)
+}
+
+func (n *node) kindName() string {
+    switch n.kind {
+    case NODE_LIST:
+        return "list"
+    case NODE_MAP:
+        return "map"
+    }
+
+    return "scalar"
+}
+
+/* Returns a value for the key or nil */
+func (n *node) get(key string) *node {
+    for i, keyNode := range n.keys {
+        if keyNode.value == key {
+            return n.values[i]
+        }
+    }
+
+    return nil
+}
+
+func (n *node) isNull() bool {
+    return n.kind == NODE_SCALAR && !n.quoted && (n.value == "" || n.value == "null" || n.value == "~")
+}
+
+/* Reports errors for documents with unknown file name */
+func syntaxError(file string, line int, col int, format string, args ...interface{}) error {
+    return &DocumentError{
+        File: file,
+        Line: line,
+        Col: col,
+        Message: fmt.Sprintf(format, args...),
+    }
+}
+
+/* Parses JSON or YAML depending on file extension or content */
+func parseDocument(file string, content []byte) (*node, error) {
+    if isJsonDocument(file, content) {
+        return parseJson(file, content)
+    }
+
+    return parseYaml(file, content)
+}
+
+func isJsonDocument(file string, content []byte) bool {
+    if strings.HasSuffix(file, ".json") {
+        return true
+    }
+
+    if strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yml") {
+        return false
+    }
+
+    for _, c := range content {
+        if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+            continue
+        }
+        return c == '{' || c == '['
+    }
+
+    return false
+}
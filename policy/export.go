@@ -0,0 +1,235 @@
+package policy
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+/* Formats for ExportPolicy */
+const (
+    EXPORT_OCI = "oci"
+    EXPORT_SYSTEMD = "systemd"
+)
+
+var ExportFormats = []string{EXPORT_OCI, EXPORT_SYSTEMD}
+
+/*
+    Converts a policy into a format used by other sandboxes. The policy
+    must contain only native syscall names without groups, for example
+    built from resolved rules. A nil policy means no filter at all.
+
+    Rules that cannot be represented in given format are reported
+    in warnings.
+ */
+func ExportPolicy(p *Policy, arch string, format string) (output string, warnings []string, err error) {
+    switch format {
+    case EXPORT_OCI:
+        return ExportOci(p, arch)
+    case EXPORT_SYSTEMD:
+        return ExportSystemd(p)
+    }
+
+    return "", nil, fmt.Errorf("unknown export format '%s', expected %s",
+        format, strings.Join(ExportFormats, " or "))
+}
+
+/*
+    Returns an OCI "linux.seccomp" JSON document, the same format
+    is used for Docker seccomp profiles
+ */
+func ExportOci(p *Policy, arch string) (string, []string, error) {
+    profile := dockerProfile{DefaultAction: "SCMP_ACT_ALLOW", Syscalls: []dockerSyscall{}}
+
+    if p != nil {
+        var err error
+        profile.DefaultAction, profile.DefaultErrnoRet, err = exportDockerAction(p.DefaultAction)
+        if err != nil {
+            return "", nil, err
+        }
+
+        for dockerArch, name := range dockerArchs {
+            if name == arch {
+                profile.Architectures = []string{dockerArch}
+            }
+        }
+
+        if profile.Architectures == nil {
+            return "", nil, fmt.Errorf("architecture %s is not supported by OCI runtimes", arch)
+        }
+
+        profile.Syscalls, err = exportDockerSyscalls(p.Rules)
+        if err != nil {
+            return "", nil, err
+        }
+    }
+
+    content, err := json.MarshalIndent(profile, "", "    ")
+    if err != nil {
+        return "", nil, err
+    }
+
+    return string(content) + "\n", nil, nil
+}
+
+/*
+    Unconditional rules with the same action are joined into one
+    entry, every conditional rule becomes a separate entry
+ */
+func exportDockerSyscalls(rules []Rule) ([]dockerSyscall, error) {
+    result := []dockerSyscall{}
+    entryByAction := make(map[Action]int)
+
+    for _, rule := range rules {
+        if index, ok := entryByAction[rule.Action]; ok && !rule.IsConditional() {
+            result[index].Names = append(result[index].Names, rule.Syscall)
+            continue
+        }
+
+        action, errnoRet, err := exportDockerAction(rule.Action)
+        if err != nil {
+            return nil, err
+        }
+
+        args, err := exportDockerArgs(rule)
+        if err != nil {
+            return nil, err
+        }
+
+        result = append(result, dockerSyscall{
+            Names: []string{rule.Syscall},
+            Action: action,
+            ErrnoRet: errnoRet,
+            Args: args,
+        })
+
+        if !rule.IsConditional() {
+            entryByAction[rule.Action] = len(result) - 1
+        }
+    }
+
+    return result, nil
+}
+
+func exportDockerAction(action Action) (string, *int, error) {
+    switch action.Kind {
+    case ACTION_KILL:
+        // Kill action of guarddog filters kills the whole process
+        return "SCMP_ACT_KILL_PROCESS", nil, nil
+    case ACTION_TRAP:
+        return "SCMP_ACT_TRAP", nil, nil
+    case ACTION_ALLOW:
+        return "SCMP_ACT_ALLOW", nil, nil
+    case ACTION_ERRNO:
+        errno := action.Errno
+        return "SCMP_ACT_ERRNO", &errno, nil
+    }
+
+    return "", nil, fmt.Errorf("unknown action %d", action.Kind)
+}
+
+func exportDockerArgs(rule Rule) ([]dockerArg, error) {
+    var result []dockerArg
+    seenIndexes := make(map[uint]bool)
+
+    for _, condition := range rule.Conditions {
+        // OCI runtimes join conditions for the same argument with OR
+        if seenIndexes[condition.Arg] {
+            return nil, fmt.Errorf("rule '%s' cannot be exported: OCI runtimes do not support "+
+                "several conditions for the same argument", rule)
+        }
+        seenIndexes[condition.Arg] = true
+
+        arg := dockerArg{Index: condition.Arg, Value: condition.Value}
+        for name, op := range dockerOperators {
+            if op == condition.Op {
+                arg.Op = name
+            }
+        }
+
+        if condition.Op == OP_MASKED_EQ {
+            arg.Value = condition.Mask
+            arg.ValueTwo = condition.Value
+        }
+
+        result = append(result, arg)
+    }
+
+    return result, nil
+}
+
+/*
+    Returns SystemCallFilter= and SystemCallErrorNumber= directives
+    for a systemd unit. Systemd cannot check arguments so conditional
+    rules are skipped, making the filter stricter. Per-syscall errno
+    values are supported only in deny-list mode (when default action
+    is allow).
+ */
+func ExportSystemd(p *Policy) (string, []string, error) {
+    if p == nil {
+        return "# syscall filter is disabled\n", nil, nil
+    }
+
+    var warnings []string
+    var names []string
+
+    if p.DefaultAction.Kind == ACTION_ALLOW {
+        for _, rule := range p.Rules {
+            if rule.IsConditional() {
+                warnings = append(warnings, fmt.Sprintf(
+                    "rule '%s' is skipped: systemd cannot check syscall arguments", rule))
+                continue
+            }
+
+            switch rule.Action.Kind {
+            case ACTION_ERRNO:
+                names = append(names, rule.Syscall + ":" + ErrnoName(rule.Action.Errno))
+            case ACTION_TRAP:
+                warnings = append(warnings, fmt.Sprintf(
+                    "rule '%s' is exported as kill: systemd does not support trap", rule))
+                fallthrough
+            case ACTION_KILL:
+                names = append(names, rule.Syscall)
+            }
+        }
+
+        if len(names) == 0 {
+            return "# syscall filter allows all syscalls\n", warnings, nil
+        }
+
+        return fmt.Sprintf("SystemCallFilter=~%s\n", strings.Join(names, " ")), warnings, nil
+    }
+
+    for _, rule := range p.Rules {
+        if rule.IsConditional() {
+            warnings = append(warnings, fmt.Sprintf(
+                "rule '%s' is skipped: systemd cannot check syscall arguments", rule))
+            continue
+        }
+
+        if rule.Action.Kind == ACTION_ALLOW {
+            names = append(names, rule.Syscall)
+        } else {
+            warnings = append(warnings, fmt.Sprintf(
+                "rule '%s' is replaced with default action: systemd does not support "+
+                "other actions in allow-list mode", rule))
+        }
+    }
+
+    // An empty SystemCallFilter= resets the filter instead of denying everything
+    if len(names) == 0 {
+        return "", nil, fmt.Errorf("policy allows no syscalls, this cannot be expressed for systemd")
+    }
+
+    var lines []string
+    lines = append(lines,"SystemCallFilter=" + strings.Join(names, " "))
+
+    switch p.DefaultAction.Kind {
+    case ACTION_ERRNO:
+        lines = append(lines, "SystemCallErrorNumber=" + ErrnoName(p.DefaultAction.Errno))
+    case ACTION_TRAP:
+        warnings = append(warnings, "default action trap is exported as kill: systemd does not support trap")
+    }
+
+    return strings.Join(lines, "\n") + "\n", warnings, nil
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+    "strings"
+    "testing"
+)
+
+func createExportTestPolicy() *Policy {
+    p := New(Errno(EPERM))
+    p.Allow("read", "write")
+    p.AddRule(Rule{Syscall: "ptrace", Action: Kill})
+    p.AddRule(Rule{Syscall: "ioctl", Action: Allow, Conditions: []Condition{
+        {Arg: 1, Op: OP_EQ, Value: 0x5401},
+    }})
+    p.AddRule(Rule{Syscall: "clone", Action: Allow, Conditions: []Condition{
+        {Arg: 0, Op: OP_MASKED_EQ, Mask: 0x10000, Value: 0x10000},
+    }})
+    p.Allow("exit_group")
+    return p
+}
+
+func TestExportOci(t *testing.T) {
+    p := createExportTestPolicy()
+    output, _, err := ExportOci(p, "amd64")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // guarddog kills the whole process, not only the calling thread
+    if !strings.Contains(output, `"SCMP_ACT_KILL_PROCESS"`) {
+        t.Errorf("Expected kill to be exported as SCMP_ACT_KILL_PROCESS:\n%s", output)
+    }
+
+    importer := &dockerImporter{arch: "amd64"}
+    imported, err := importer.convert([]byte(output))
+    if err != nil {
+        t.Fatalf("Cannot import exported policy: %s\n%s", err, output)
+    }
+
+    if imported.DefaultAction != p.DefaultAction {
+        t.Errorf("Invalid default action: %s", imported.DefaultAction)
+    }
+
+    var rules []string
+    for _, rule := range imported.Rules {
+        rules = append(rules, rule.String())
+    }
+
+    expected := []string{
+        "read: allow",
+        "write: allow",
+        "exit_group: allow",
+        "ptrace: kill",
+        "ioctl: allow if arg1 == 0x5401",
+        "clone: allow if arg0 & 0x10000 == 0x10000",
+    }
+
+    if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+        t.Errorf("Invalid rules:\n%s\nexported:\n%s", strings.Join(rules, "\n"), output)
+    }
+
+    if len(importer.warnings) > 0 {
+        t.Errorf("Unexpected warnings: %s", importer.warnings)
+    }
+}
+
+func TestExportOciRejectsSameArgument(t *testing.T) {
+    p := New(Kill)
+    p.AddRule(Rule{Syscall: "socket", Action: Allow, Conditions: []Condition{
+        {Arg: 0, Op: OP_GE, Value: 1},
+        {Arg: 0, Op: OP_LE, Value: 2},
+    }})
+
+    if _, _, err := ExportOci(p, "amd64"); err == nil {
+        t.Errorf("Expected an error for several conditions on one argument")
+    }
+}
+
+func TestExportSystemd(t *testing.T) {
+    output, warnings, err := ExportSystemd(createExportTestPolicy())
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "SystemCallFilter=read write exit_group\nSystemCallErrorNumber=EPERM\n"
+    if output != expected {
+        t.Errorf("Invalid output:\n%s\nexpected:\n%s", output, expected)
+    }
+
+    // ptrace action and two conditional rules cannot be exported
+    if len(warnings) != 3 {
+        t.Errorf("Invalid warnings: %s", warnings)
+    }
+
+    denyList := New(Allow)
+    denyList.AddRule(Rule{Syscall: "ptrace", Action: Kill})
+    denyList.AddRule(Rule{Syscall: "mount", Action: Errno(EPERM)})
+
+    output, _, err = ExportSystemd(denyList)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if output != "SystemCallFilter=~ptrace mount:EPERM\n" {
+        t.Errorf("Invalid deny-list output: %s", output)
+    }
+}
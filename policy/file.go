@@ -0,0 +1,604 @@
+package policy
+
+import (
+    "fmt"
+    "io/ioutil"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+/*
+    Structured policy files are written in YAML or JSON:
+
+        extends: base.yaml              # or profile:python3
+        include: [network.yaml]
+        default-action: kill            # kill, trap, allow, errno:EPERM
+        allow: [read, write, "@memory"]
+        rules:
+          - syscall: ioctl              # or syscalls: [a, b]
+            action: allow
+            args: ["arg1 == TCGETS"]
+          - syscall: socket
+            args:
+              - {arg: 0, op: "==", value: AF_UNIX}
+        rlimits:
+          nofile: 64
+        arch:
+          amd64:
+            allow: [arch_prctl]
+
+    The parent policy from "extends" is applied first, then included
+    files, then the file itself and then the section for the native
+    arch. Included files cannot set extends and default-action.
+    Paths are relative to the file that contains them.
+ */
+
+/* Names of archs as returned by libseccomp */
+var knownArchs = []string{
+    "x86", "amd64", "x32", "arm", "arm64",
+    "mips", "mips64", "mips64n32", "mipsel", "mipsel64", "mipsel64n32",
+    "ppc", "ppc64", "ppc64le", "s390", "s390x",
+}
+
+const PROFILE_PREFIX = "profile:"
+
+var documentKeys = []string{"extends", "include", "default-action", "allow", "rules", "rlimits", "arch"}
+var archSectionKeys = []string{"include", "allow", "rules", "rlimits"}
+var ruleKeys = []string{"syscall", "syscalls", "action", "args"}
+var conditionKeys = []string{"arg", "op", "value", "mask"}
+
+type fileLoader struct {
+    arch        string
+    /* files being loaded, used to detect cycles */
+    stack       []string
+    /* extends and include cannot name files, only profiles */
+    noFiles     bool
+}
+
+/* Loads a policy file for given arch, see format above */
+func LoadFile(fileName string, arch string) (*Policy, error) {
+    loader := &fileLoader{arch: arch}
+    return loader.load(fileName, false)
+}
+
+/*
+    Loads a policy from the content of a policy file, e.g. received
+    over a socket. Name is used in error messages. The content may
+    come from another user, so it cannot refer to files: extends can
+    only name a profile and include is not allowed.
+ */
+func LoadDocument(name string, content []byte, arch string) (*Policy, error) {
+    loader := &fileLoader{arch: arch, noFiles: true}
+    return loader.loadContent(name, content, false)
+}
+
+func (loader *fileLoader) load(fileName string, isFragment bool) (*Policy, error) {
+    if loader.noFiles {
+        return nil, fmt.Errorf("cannot load '%s', this policy can only extend profiles", fileName)
+    }
+
+    absName, err := filepath.Abs(fileName)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, name := range loader.stack {
+        if name == absName {
+            chain := append(loader.stack, absName)
+            return nil, fmt.Errorf("policy files include each other: %s",
+                strings.Join(chain, " -> "))
+        }
+    }
+
+    content, err := ioutil.ReadFile(fileName)
+    if err != nil {
+        return nil, err
+    }
+
+    loader.stack = append(loader.stack, absName)
+    defer func () {
+        loader.stack = loader.stack[:len(loader.stack) - 1]
+    } ()
+
+    return loader.loadContent(fileName, content, isFragment)
+}
+
+func (loader *fileLoader) loadContent(fileName string, content []byte, isFragment bool) (*Policy, error) {
+    root, err := parseDocument(fileName, content)
+    if err != nil {
+        return nil, err
+    }
+
+    d := &documentDecoder{file: fileName, loader: loader}
+    return d.decodeDocument(root, isFragment)
+}
+
+/* Converts parsed document into a policy and reports errors with locations */
+type documentDecoder struct {
+    file        string
+    loader      *fileLoader
+}
+
+func (d *documentDecoder) errorAt(n *node, path string, format string, args ...interface{}) error {
+    return &DocumentError{
+        File: d.file,
+        Line: n.line,
+        Col: n.col,
+        Path: path,
+        Message: fmt.Sprintf(format, args...),
+    }
+}
+
+/* Wraps errors from nested files so the include chain is visible */
+func (d *documentDecoder) wrapError(n *node, path string, err error) error {
+    return d.errorAt(n, path, "%s", err)
+}
+
+func (d *documentDecoder) expectKind(n *node, path string, kind nodeKind) error {
+    if n.kind != kind {
+        expected := (&node{kind: kind}).kindName()
+        return d.errorAt(n, path, "expected %s, got %s", expected, n.kindName())
+    }
+    return nil
+}
+
+func (d *documentDecoder) checkKeys(n *node, path string, allowed []string) error {
+    for _, key := range n.keys {
+        if !containsString(allowed, key.value) {
+            return d.errorAt(key, joinPath(path, key.value), "unknown key '%s', expected one of: %s",
+                key.value, strings.Join(allowed, ", "))
+        }
+    }
+    return nil
+}
+
+func (d *documentDecoder) stringValue(n *node, path string) (string, error) {
+    if err := d.expectKind(n, path, NODE_SCALAR); err != nil {
+        return "", err
+    }
+
+    if n.isNull() {
+        return "", d.errorAt(n, path, "value cannot be empty")
+    }
+
+    return n.value, nil
+}
+
+/* Accepts a single string or a list of strings */
+func (d *documentDecoder) stringList(n *node, path string) ([]string, error) {
+    if n.kind == NODE_SCALAR {
+        value, err := d.stringValue(n, path)
+        if err != nil {
+            return nil, err
+        }
+        return []string{value}, nil
+    }
+
+    if err := d.expectKind(n, path, NODE_LIST); err != nil {
+        return nil, err
+    }
+
+    var result []string
+    for i, item := range n.items {
+        value, err := d.stringValue(item, indexPath(path, i))
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, value)
+    }
+
+    return result, nil
+}
+
+func (d *documentDecoder) decodeDocument(root *node, isFragment bool) (*Policy, error) {
+    if err := d.expectKind(root, "", NODE_MAP); err != nil {
+        return nil, err
+    }
+
+    if err := d.checkKeys(root, "", documentKeys); err != nil {
+        return nil, err
+    }
+
+    result := New(Kill)
+
+    if extends := root.get("extends"); extends != nil {
+        if isFragment {
+            return nil, d.errorAt(extends, "extends", "included files cannot extend other files")
+        }
+
+        parent, err := d.decodeExtends(extends)
+        if err != nil {
+            return nil, err
+        }
+        result = parent
+    }
+
+    if action := root.get("default-action"); action != nil {
+        if isFragment {
+            return nil, d.errorAt(action, "default-action", "included files cannot set default action")
+        }
+
+        value, err := d.stringValue(action, "default-action")
+        if err != nil {
+            return nil, err
+        }
+
+        result.DefaultAction, err = ParseAction(value)
+        if err != nil {
+            return nil, d.errorAt(action, "default-action", "%s", err)
+        }
+    }
+
+    if err := d.decodeSection(root, "", result); err != nil {
+        return nil, err
+    }
+
+    if arch := root.get("arch"); arch != nil {
+        if err := d.decodeArchSections(arch, result); err != nil {
+            return nil, err
+        }
+    }
+
+    return result, nil
+}
+
+func (d *documentDecoder) decodeExtends(n *node) (*Policy, error) {
+    name, err := d.stringValue(n, "extends")
+    if err != nil {
+        return nil, err
+    }
+
+    if strings.HasPrefix(name, PROFILE_PREFIX) {
+        profile, err := LookupProfile(name[len(PROFILE_PREFIX):])
+        if err != nil {
+            return nil, d.errorAt(n, "extends", "%s", err)
+        }
+        return profile.Policy(d.loader.arch, Kill), nil
+    }
+
+    parent, err := d.loader.load(d.relativePath(name), false)
+    if err != nil {
+        return nil, d.wrapError(n, "extends", err)
+    }
+
+    return parent, nil
+}
+
+/* Decodes keys that can be used both at top level and in arch sections */
+func (d *documentDecoder) decodeSection(n *node, path string, result *Policy) error {
+    if include := n.get("include"); include != nil {
+        includePath := joinPath(path, "include")
+        names, err := d.stringList(include, includePath)
+        if err != nil {
+            return err
+        }
+
+        for i, name := range names {
+            fragment, err := d.loader.load(d.relativePath(name), true)
+            if err != nil {
+                location := include
+                if include.kind == NODE_LIST {
+                    location = include.items[i]
+                }
+                return d.wrapError(location, includePath, err)
+            }
+            result.Merge(fragment)
+        }
+    }
+
+    if allow := n.get("allow"); allow != nil {
+        names, err := d.stringList(allow, joinPath(path, "allow"))
+        if err != nil {
+            return err
+        }
+
+        for i, name := range names {
+            if err := d.checkSyscallName(allow, joinPath(path, "allow"), i, name); err != nil {
+                return err
+            }
+        }
+
+        result.Allow(names...)
+    }
+
+    if rules := n.get("rules"); rules != nil {
+        rulesPath := joinPath(path, "rules")
+        if err := d.expectKind(rules, rulesPath, NODE_LIST); err != nil {
+            return err
+        }
+
+        for i, item := range rules.items {
+            decoded, err := d.decodeRule(item, indexPath(rulesPath, i))
+            if err != nil {
+                return err
+            }
+            result.Rules = append(result.Rules, decoded...)
+        }
+    }
+
+    if rlimits := n.get("rlimits"); rlimits != nil {
+        if err := d.decodeRlimits(rlimits, joinPath(path, "rlimits"), result); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+func (d *documentDecoder) checkSyscallName(list *node, path string, index int, name string) error {
+    if !IsGroupName(name) {
+        return nil
+    }
+
+    if _, err := LookupGroup(name); err != nil {
+        location := list
+        if list.kind == NODE_LIST {
+            location = list.items[index]
+            path = indexPath(path, index)
+        }
+        return d.errorAt(location, path, "%s", err)
+    }
+
+    return nil
+}
+
+func (d *documentDecoder) decodeArchSections(n *node, result *Policy) error {
+    if err := d.expectKind(n, "arch", NODE_MAP); err != nil {
+        return err
+    }
+
+    if err := d.checkKeys(n, "arch", knownArchs); err != nil {
+        return err
+    }
+
+    for i, key := range n.keys {
+        section := n.values[i]
+        path := joinPath("arch", key.value)
+
+        if err := d.expectKind(section, path, NODE_MAP); err != nil {
+            return err
+        }
+
+        if err := d.checkKeys(section, path, archSectionKeys); err != nil {
+            return err
+        }
+
+        // Sections for other archs are validated but not applied
+        target := result
+        if key.value != d.loader.arch {
+            target = New(result.DefaultAction)
+        }
+
+        if err := d.decodeSection(section, path, target); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+/* A rule with several syscalls is converted into several rules */
+func (d *documentDecoder) decodeRule(n *node, path string) ([]Rule, error) {
+    if err := d.expectKind(n, path, NODE_MAP); err != nil {
+        return nil, err
+    }
+
+    if err := d.checkKeys(n, path, ruleKeys); err != nil {
+        return nil, err
+    }
+
+    var names []string
+    syscall, syscalls := n.get("syscall"), n.get("syscalls")
+    switch {
+    case syscall != nil && syscalls != nil:
+        return nil, d.errorAt(n, path, "only one of 'syscall' and 'syscalls' can be used")
+    case syscall != nil:
+        name, err := d.stringValue(syscall, joinPath(path, "syscall"))
+        if err != nil {
+            return nil, err
+        }
+        if err := d.checkSyscallName(syscall, joinPath(path, "syscall"), 0, name); err != nil {
+            return nil, err
+        }
+        names = []string{name}
+    case syscalls != nil:
+        var err error
+        names, err = d.stringList(syscalls, joinPath(path, "syscalls"))
+        if err != nil {
+            return nil, err
+        }
+        for i, name := range names {
+            if err := d.checkSyscallName(syscalls, joinPath(path, "syscalls"), i, name); err != nil {
+                return nil, err
+            }
+        }
+    default:
+        return nil, d.errorAt(n, path, "rule must have 'syscall' or 'syscalls' key")
+    }
+
+    action := Allow
+    if actionNode := n.get("action"); actionNode != nil {
+        value, err := d.stringValue(actionNode, joinPath(path, "action"))
+        if err != nil {
+            return nil, err
+        }
+
+        action, err = ParseAction(value)
+        if err != nil {
+            return nil, d.errorAt(actionNode, joinPath(path, "action"), "%s", err)
+        }
+    }
+
+    var conditions []Condition
+    if args := n.get("args"); args != nil {
+        argsPath := joinPath(path, "args")
+        if err := d.expectKind(args, argsPath, NODE_LIST); err != nil {
+            return nil, err
+        }
+
+        for i, item := range args.items {
+            condition, err := d.decodeCondition(item, indexPath(argsPath, i))
+            if err != nil {
+                return nil, err
+            }
+            conditions = append(conditions, condition)
+        }
+    }
+
+    var rules []Rule
+    for _, name := range names {
+        rules = append(rules, Rule{Syscall: name, Action: action, Conditions: conditions})
+    }
+
+    return rules, nil
+}
+
+/* Condition is a string like "arg1 == TCGETS" or a map with arg, op, value and mask keys */
+func (d *documentDecoder) decodeCondition(n *node, path string) (Condition, error) {
+    if n.kind == NODE_SCALAR {
+        value, err := d.stringValue(n, path)
+        if err != nil {
+            return Condition{}, err
+        }
+
+        condition, err := ParseCondition(value)
+        if err != nil {
+            return Condition{}, d.errorAt(n, path, "%s", err)
+        }
+        return condition, nil
+    }
+
+    if err := d.expectKind(n, path, NODE_MAP); err != nil {
+        return Condition{}, err
+    }
+
+    if err := d.checkKeys(n, path, conditionKeys); err != nil {
+        return Condition{}, err
+    }
+
+    var condition Condition
+    argNode := n.get("arg")
+    if argNode == nil {
+        return condition, d.errorAt(n, path, "condition must have 'arg' key")
+    }
+
+    argText, err := d.stringValue(argNode, joinPath(path, "arg"))
+    if err != nil {
+        return condition, err
+    }
+
+    arg, err := strconv.ParseUint(argText, 10, 8)
+    if err != nil || arg >= MAX_ARGS {
+        return condition, d.errorAt(argNode, joinPath(path, "arg"),
+            "argument index must be a number from 0 to %d", MAX_ARGS - 1)
+    }
+    condition.Arg = uint(arg)
+
+    condition.Op = OP_EQ
+    if opNode := n.get("op"); opNode != nil {
+        opText, err := d.stringValue(opNode, joinPath(path, "op"))
+        if err != nil {
+            return condition, err
+        }
+
+        condition.Op, err = ParseOperator(opText)
+        if err != nil {
+            return condition, d.errorAt(opNode, joinPath(path, "op"), "%s", err)
+        }
+    }
+
+    valueNode := n.get("value")
+    if valueNode == nil {
+        return condition, d.errorAt(n, path, "condition must have 'value' key")
+    }
+
+    condition.Value, err = d.decodeNumber(valueNode, joinPath(path, "value"))
+    if err != nil {
+        return condition, err
+    }
+
+    maskNode := n.get("mask")
+    if condition.Op == OP_MASKED_EQ {
+        if maskNode == nil {
+            return condition, d.errorAt(n, path, "operator '&' requires 'mask' key")
+        }
+
+        condition.Mask, err = d.decodeNumber(maskNode, joinPath(path, "mask"))
+        if err != nil {
+            return condition, err
+        }
+    } else if maskNode != nil {
+        return condition, d.errorAt(maskNode, joinPath(path, "mask"), "mask can be used only with operator '&'")
+    }
+
+    return condition, nil
+}
+
+func (d *documentDecoder) decodeNumber(n *node, path string) (uint64, error) {
+    text, err := d.stringValue(n, path)
+    if err != nil {
+        return 0, err
+    }
+
+    value, err := ParseValue(text)
+    if err != nil {
+        return 0, d.errorAt(n, path, "%s", err)
+    }
+
+    return value, nil
+}
+
+func (d *documentDecoder) decodeRlimits(n *node, path string, result *Policy) error {
+    if err := d.expectKind(n, path, NODE_MAP); err != nil {
+        return err
+    }
+
+    if err := d.checkKeys(n, path, RlimitNames); err != nil {
+        return err
+    }
+
+    for i, key := range n.keys {
+        text, err := d.stringValue(n.values[i], joinPath(path, key.value))
+        if err != nil {
+            return err
+        }
+
+        value, err := strconv.ParseUint(text, 10, 64)
+        if err != nil {
+            return d.errorAt(n.values[i], joinPath(path, key.value), "limit must be a number")
+        }
+
+        result.SetRlimit(key.value, value)
+    }
+
+    return nil
+}
+
+func (d *documentDecoder) relativePath(name string) string {
+    if filepath.IsAbs(name) {
+        return name
+    }
+
+    return filepath.Join(filepath.Dir(d.file), name)
+}
+
+func joinPath(path string, key string) string {
+    if path == "" {
+        return key
+    }
+    return path + "." + key
+}
+
+func indexPath(path string, index int) string {
+    return fmt.Sprintf("%s[%d]", path, index)
+}
+
+func containsString(haystack []string, needle string) bool {
+    for _, value := range haystack {
+        if value == needle {
+            return true
+        }
+    }
+    return false
+}
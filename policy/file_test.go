@@ -0,0 +1,217 @@
+package policy
+
+import (
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestLoadYamlPolicy(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "network.yaml", `
+allow:
+  - socket
+  - connect
+`)
+    writeFile(t, dir, "base.yaml", `
+default-action: errno:EPERM
+allow: [read, write]
+rlimits:
+  nofile: 32
+`)
+    name := writeFile(t, dir, "main.yaml", `
+# Comment
+extends: base.yaml
+include: network.yaml
+allow:
+  - "@memory"
+rules:
+  - syscall: ioctl
+    args: ["arg1 == TCGETS"]
+  - syscalls: [ptrace, mount]
+    action: kill
+  - syscall: clone
+    args:
+      - {arg: 0, op: "&", mask: CLONE_THREAD, value: CLONE_THREAD}
+rlimits:
+  nofile: 64
+arch:
+  amd64:
+    allow: [arch_prctl]
+  x86:
+    allow: [set_thread_area]
+`)
+
+    p, err := LoadFile(name, "amd64")
+    if err != nil {
+        t.Fatalf("Failed to load policy: %s", err)
+    }
+
+    if p.DefaultAction != Errno(EPERM) {
+        t.Errorf("Expected default action to be inherited, got %s", p.DefaultAction)
+    }
+
+    var names []string
+    for _, rule := range p.Rules {
+        names = append(names, rule.Syscall)
+    }
+
+    expect := "read write socket connect @memory ioctl ptrace mount clone arch_prctl"
+    if strings.Join(names, " ") != expect {
+        t.Errorf("Expected rules for %s, got %v", expect, names)
+    }
+
+    if p.Rules[5].Conditions[0].Arg != 1 || p.Rules[6].Action != Kill {
+        t.Errorf("Rules were not parsed correctly: %v", p.Rules)
+    }
+
+    clone := p.Rules[8].Conditions[0]
+    if clone.Op != OP_MASKED_EQ || clone.Mask != clone.Value || clone.Mask == 0 {
+        t.Errorf("Masked condition was not parsed correctly: %s", clone)
+    }
+
+    if len(p.Rlimits) != 1 || p.Rlimits[0].Value != 64 {
+        t.Errorf("Expected nofile limit to be overridden, got %v", p.Rlimits)
+    }
+}
+
+func TestLoadJsonPolicy(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    name := writeFile(t, dir, "policy.json", `{
+    "extends": "profile:static-c",
+    "default-action": "trap",
+    "rules": [
+        {"syscall": "socket", "args": [{"arg": 0, "value": "AF_UNIX"}]}
+    ]
+}`)
+
+    p, err := LoadFile(name, "amd64")
+    if err != nil {
+        t.Fatalf("Failed to load policy: %s", err)
+    }
+
+    if p.DefaultAction != Trap {
+        t.Errorf("Expected default action to be trap, got %s", p.DefaultAction)
+    }
+
+    last := p.Rules[len(p.Rules) - 1]
+    if last.Syscall != "socket" || len(last.Conditions) != 1 {
+        t.Errorf("Expected last rule to be for socket, got %s", last)
+    }
+
+    if !hasRule(p, "execve") {
+        t.Errorf("Expected rules from static-c profile")
+    }
+}
+
+func TestPolicyErrorLocations(t *testing.T) {
+    testPolicyError(t, "p.yaml", "allow: [read]\nrules:\n  - syscall: ioctl\n    action: deny\n",
+        "p.yaml:4:13: rules[0].action: unknown action 'deny'")
+    testPolicyError(t, "p.yaml", "alow: [read]\n",
+        "p.yaml:1:1: alow: unknown key 'alow'")
+    testPolicyError(t, "p.yaml", "rules:\n  - syscall: ioctl\n    args: ['arg7 == 1']\n",
+        "p.yaml:3:12: rules[0].args[0]: argument index 7 is out of range")
+    testPolicyError(t, "p.yaml", "allow: [read, \"@nope\"]\n",
+        "p.yaml:1:15: allow[1]: unknown syscall group '@nope'")
+    testPolicyError(t, "p.yaml", "arch:\n  vax: {allow: [read]}\n",
+        "p.yaml:2:3: arch.vax: unknown key 'vax'")
+    testPolicyError(t, "p.yaml", "rlimits:\n  nofile: many\n",
+        "p.yaml:2:11: rlimits.nofile: limit must be a number")
+    testPolicyError(t, "p.json", "{\n  \"allow\": [\"read\",]\n}",
+        "p.json:2:20: unexpected character ']', expected a value")
+    testPolicyError(t, "p.json", "{\"rules\": [{\"action\": \"kill\"}]}",
+        "p.json:1:12: rules[0]: rule must have 'syscall' or 'syscalls' key")
+}
+
+func testPolicyError(t *testing.T, fileName string, content string, expect string) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, fileName, content)
+    cwd, _ := os.Getwd()
+    os.Chdir(dir)
+    defer os.Chdir(cwd)
+
+    _, err := LoadFile(fileName, "amd64")
+    if err == nil {
+        t.Errorf("Expected to get error for %s", content)
+        return
+    }
+
+    if !strings.HasPrefix(err.Error(), expect) {
+        t.Errorf("Expected error '%s', got '%s'", expect, err)
+    }
+}
+
+func TestPolicyIncludeCycle(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "a.yaml", "include: b.yaml\n")
+    writeFile(t, dir, "b.yaml", "include: [c.yaml]\n")
+    writeFile(t, dir, "c.yaml", "include: b.yaml\n")
+
+    _, err := LoadFile(filepath.Join(dir, "a.yaml"), "amd64")
+    if err == nil || !strings.Contains(err.Error(), "include each other") {
+        t.Fatalf("Expected to get error about include cycle, got %v", err)
+    }
+}
+
+func TestIncludedFileCannotExtend(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "fragment.yaml", "extends: profile:go\n")
+    name := writeFile(t, dir, "main.yaml", "include: fragment.yaml\n")
+
+    _, err := LoadFile(name, "amd64")
+    if err == nil || !strings.Contains(err.Error(), "fragment.yaml:1:10: extends") {
+        t.Fatalf("Expected to get error with location in included file, got %v", err)
+    }
+}
+
+func TestDocumentCannotReferToFiles(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    name := writeFile(t, dir, "base.yaml", "allow: [read]\n")
+
+    for _, content := range []string{
+        `{"extends": "` + name + `"}`,
+        `{"include": ["` + name + `"]}`,
+        `{"arch": {"amd64": {"include": "` + name + `"}}}`,
+    } {
+        _, err := LoadDocument("<job>", []byte(content), "amd64")
+        if err == nil || !strings.Contains(err.Error(), "can only extend profiles") {
+            t.Errorf("Expected to get error for %s, got %v", content, err)
+        }
+    }
+
+    p, err := LoadDocument("<job>", []byte(`{"extends": "profile:static-c"}`), "amd64")
+    if err != nil || !hasRule(p, "execve") {
+        t.Errorf("Expected a document extending a profile to load, got %v", err)
+    }
+}
+
+func createTmpDir(t *testing.T) string {
+    dir, err := ioutil.TempDir("", "guarddog-test")
+    if err != nil {
+        t.Fatalf("Failed to create tmp dir: %s", err)
+    }
+    return dir
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+    path := filepath.Join(dir, name)
+    err := ioutil.WriteFile(path, []byte(content), 0644)
+    if err != nil {
+        t.Fatalf("Failed to write file %s: %s", path, err)
+    }
+    return path
+}
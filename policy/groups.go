@@ -0,0 +1,114 @@
+package policy
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+/*
+    Groups of syscalls that can be referred as "@name" in allow lists
+    and rules. Groups list names for all supported archs, names that
+    do not exist on the native arch are skipped silently when a
+    policy is resolved.
+ */
+var syscallGroups = map[string][]string{
+    "@basic-io": {
+        "read", "write", "readv", "writev", "pread64", "pwrite64",
+        "preadv", "pwritev", "close", "lseek", "_llseek",
+        "dup", "dup2", "dup3",
+    },
+    "@memory": {
+        "brk", "mmap", "mmap2", "munmap", "mprotect", "mremap", "madvise",
+    },
+    "@exit": {
+        "exit", "exit_group",
+    },
+    "@file-read": {
+        "open", "openat", "access", "faccessat", "faccessat2",
+        "stat", "stat64", "fstat", "fstat64", "lstat", "lstat64",
+        "newfstatat", "fstatat64", "statx", "statfs", "statfs64",
+        "fstatfs", "fstatfs64", "readlink", "readlinkat",
+        "getdents", "getdents64", "fcntl", "fcntl64", "getcwd",
+    },
+    "@file-write": {
+        "mkdir", "mkdirat", "rmdir", "unlink", "unlinkat",
+        "rename", "renameat", "renameat2", "truncate", "truncate64",
+        "ftruncate", "ftruncate64", "fsync", "fdatasync",
+        "chmod", "fchmod", "fchmodat", "umask", "fallocate",
+    },
+    "@process-info": {
+        "getpid", "getppid", "gettid", "getuid", "getuid32",
+        "geteuid", "geteuid32", "getgid", "getgid32", "getegid", "getegid32",
+        "getresuid", "getresuid32", "getresgid", "getresgid32",
+        "getrlimit", "ugetrlimit", "prlimit64", "getrusage", "uname",
+        "sysinfo", "getrandom", "sched_getaffinity",
+    },
+    "@signal": {
+        "rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sigreturn",
+        "sigaltstack", "rt_sigsuspend", "rt_sigtimedwait",
+    },
+    "@thread": {
+        "set_tid_address", "set_robust_list", "get_robust_list",
+        "futex", "futex_time64", "sched_yield", "rseq", "tgkill", "membarrier",
+    },
+    "@time": {
+        "clock_gettime", "clock_gettime64", "clock_getres", "clock_getres_time64",
+        "gettimeofday", "time", "nanosleep", "clock_nanosleep", "clock_nanosleep_time64",
+    },
+    "@poll": {
+        "poll", "ppoll", "ppoll_time64", "select", "_newselect", "pselect6",
+        "epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait", "epoll_pwait",
+        "pipe", "pipe2", "eventfd", "eventfd2",
+    },
+    "@network": {
+        "socket", "socketpair", "connect", "bind", "listen", "accept", "accept4",
+        "sendto", "recvfrom", "sendmsg", "recvmsg", "sendmmsg", "recvmmsg",
+        "shutdown", "getsockname", "getpeername", "setsockopt", "getsockopt",
+        "socketcall",
+    },
+    "@privileged": {
+        "ptrace", "mount", "umount", "umount2", "pivot_root", "chroot",
+        "bpf", "kexec_load", "kexec_file_load", "init_module", "finit_module",
+        "delete_module", "process_vm_readv", "process_vm_writev", "reboot",
+        "swapon", "swapoff", "setns", "unshare", "perf_event_open",
+        "open_by_handle_at", "iopl", "ioperm", "acct", "settimeofday",
+        "clock_settime", "adjtimex", "sethostname", "setdomainname",
+    },
+}
+
+func IsGroupName(name string) bool {
+    return strings.HasPrefix(name, "@")
+}
+
+/* Returns syscalls in a group or an error if there is no such group */
+func LookupGroup(name string) ([]string, error) {
+    syscalls, ok := syscallGroups[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown syscall group '%s', known groups are: %s",
+            name, strings.Join(GroupNames(), ", "))
+    }
+
+    return syscalls, nil
+}
+
+/* Returns sorted names of all groups */
+func GroupNames() []string {
+    names := make([]string, 0, len(syscallGroups))
+    for name := range syscallGroups {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+func splitAndTrim(s string, separator string) []string {
+    var result []string
+    for _, part := range strings.Split(s, separator) {
+        part = strings.TrimSpace(part)
+        if part != "" {
+            result = append(result, part)
+        }
+    }
+    return result
+}
@@ -0,0 +1,260 @@
+package policy
+
+import (
+    "strconv"
+    "unicode/utf8"
+)
+
+/*
+    A small JSON parser that keeps line and column of every value.
+    encoding/json reports only byte offsets and loses positions
+    of values inside decoded structures.
+ */
+type jsonParser struct {
+    file        string
+    content     []byte
+    pos         int
+    line        int
+    col         int
+}
+
+func parseJson(file string, content []byte) (*node, error) {
+    p := &jsonParser{file: file, content: content, line: 1, col: 1}
+    p.skipSpace()
+    root, err := p.parseValue()
+    if err != nil {
+        return nil, err
+    }
+
+    p.skipSpace()
+    if p.pos < len(p.content) {
+        return nil, p.errorf("unexpected data after the end of document")
+    }
+
+    return root, nil
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+    return syntaxError(p.file, p.line, p.col, format, args...)
+}
+
+func (p *jsonParser) advance() {
+    if p.content[p.pos] == '\n' {
+        p.line++
+        p.col = 1
+    } else {
+        p.col++
+    }
+    p.pos++
+}
+
+func (p *jsonParser) skipSpace() {
+    for p.pos < len(p.content) {
+        switch p.content[p.pos] {
+        case ' ', '\t', '\r', '\n':
+            p.advance()
+        default:
+            return
+        }
+    }
+}
+
+func (p *jsonParser) peek() byte {
+    if p.pos >= len(p.content) {
+        return 0
+    }
+    return p.content[p.pos]
+}
+
+func (p *jsonParser) expect(c byte) error {
+    if p.peek() != c {
+        return p.unexpected("'" + string(c) + "'")
+    }
+    p.advance()
+    return nil
+}
+
+func (p *jsonParser) unexpected(expected string) error {
+    if p.pos >= len(p.content) {
+        return p.errorf("unexpected end of file, expected %s", expected)
+    }
+
+    r, _ := utf8.DecodeRune(p.content[p.pos:])
+    return p.errorf("unexpected character '%c', expected %s", r, expected)
+}
+
+func (p *jsonParser) parseValue() (*node, error) {
+    switch c := p.peek(); {
+    case c == '{':
+        return p.parseObject()
+    case c == '[':
+        return p.parseArray()
+    case c == '"':
+        line, col := p.line, p.col
+        value, err := p.parseString()
+        if err != nil {
+            return nil, err
+        }
+        return &node{kind: NODE_SCALAR, line: line, col: col, value: value, quoted: true}, nil
+    case c == '-' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z'):
+        return p.parseLiteral()
+    }
+
+    return nil, p.unexpected("a value")
+}
+
+func (p *jsonParser) parseObject() (*node, error) {
+    result := &node{kind: NODE_MAP, line: p.line, col: p.col}
+    p.advance()
+    p.skipSpace()
+
+    if p.peek() == '}' {
+        p.advance()
+        return result, nil
+    }
+
+    for {
+        p.skipSpace()
+        if p.peek() != '"' {
+            return nil, p.unexpected("a quoted key")
+        }
+
+        key := &node{kind: NODE_SCALAR, line: p.line, col: p.col, quoted: true}
+        value, err := p.parseString()
+        if err != nil {
+            return nil, err
+        }
+        key.value = value
+
+        if result.get(key.value) != nil {
+            return nil, syntaxError(p.file, key.line, key.col, "duplicate key '%s'", key.value)
+        }
+
+        p.skipSpace()
+        if err := p.expect(':'); err != nil {
+            return nil, err
+        }
+
+        p.skipSpace()
+        item, err := p.parseValue()
+        if err != nil {
+            return nil, err
+        }
+
+        result.keys = append(result.keys, key)
+        result.values = append(result.values, item)
+
+        p.skipSpace()
+        if p.peek() == ',' {
+            p.advance()
+            continue
+        }
+
+        if err := p.expect('}'); err != nil {
+            return nil, p.unexpected("',' or '}'")
+        }
+
+        return result, nil
+    }
+}
+
+func (p *jsonParser) parseArray() (*node, error) {
+    result := &node{kind: NODE_LIST, line: p.line, col: p.col}
+    p.advance()
+    p.skipSpace()
+
+    if p.peek() == ']' {
+        p.advance()
+        return result, nil
+    }
+
+    for {
+        p.skipSpace()
+        item, err := p.parseValue()
+        if err != nil {
+            return nil, err
+        }
+        result.items = append(result.items, item)
+
+        p.skipSpace()
+        if p.peek() == ',' {
+            p.advance()
+            continue
+        }
+
+        if err := p.expect(']'); err != nil {
+            return nil, p.unexpected("',' or ']'")
+        }
+
+        return result, nil
+    }
+}
+
+func (p *jsonParser) parseString() (string, error) {
+    start := p.pos
+    p.advance()
+
+    for p.pos < len(p.content) {
+        c := p.peek()
+        switch {
+        case c == '\\':
+            p.advance()
+            if p.pos >= len(p.content) {
+                return "", p.unexpected("an escape sequence")
+            }
+        case c == '"':
+            p.advance()
+            value, err := unquoteJsonString(p.content[start:p.pos])
+            if err != nil {
+                return "", syntaxError(p.file, p.line, p.col, "invalid string: %s", err)
+            }
+            return value, nil
+        case c == '\n':
+            return "", p.errorf("unterminated string")
+        }
+        p.advance()
+    }
+
+    return "", p.errorf("unterminated string")
+}
+
+/* JSON escapes are the same as Go ones except for "\/" */
+func unquoteJsonString(raw []byte) (string, error) {
+    var buffer []byte
+    for i := 0; i < len(raw); i++ {
+        if raw[i] == '\\' && i + 1 < len(raw) && raw[i + 1] == '/' {
+            buffer = append(buffer, '/')
+            i++
+            continue
+        }
+        buffer = append(buffer, raw[i])
+    }
+
+    return strconv.Unquote(string(buffer))
+}
+
+/* Numbers, true, false and null */
+func (p *jsonParser) parseLiteral() (*node, error) {
+    result := &node{kind: NODE_SCALAR, line: p.line, col: p.col}
+    start := p.pos
+
+    for p.pos < len(p.content) {
+        c := p.peek()
+        if c == ',' || c == '}' || c == ']' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+            break
+        }
+        p.advance()
+    }
+
+    result.value = string(p.content[start:p.pos])
+    switch result.value {
+    case "true", "false", "null":
+        return result, nil
+    }
+
+    if _, err := strconv.ParseFloat(result.value, 64); err != nil {
+        return nil, syntaxError(p.file, result.line, result.col, "invalid literal '%s'", result.value)
+    }
+
+    return result, nil
+}
@@ -0,0 +1,57 @@
+package policy
+
+import (
+    "encoding/json"
+)
+
+/* Policy file in JSON, see file.go for the format */
+type policyDocument struct {
+    DefaultAction   string              `json:"default-action"`
+    Allow           []string            `json:"allow,omitempty"`
+    Rules           []ruleDocument      `json:"rules,omitempty"`
+    Rlimits         map[string]uint64   `json:"rlimits,omitempty"`
+}
+
+type ruleDocument struct {
+    Syscall         string              `json:"syscall"`
+    Action          string              `json:"action"`
+    Args            []string            `json:"args,omitempty"`
+}
+
+/*
+    Returns a JSON policy file that LoadFile reads back into the same
+    policy. Unconditional allow rules at the start go to the allow list,
+    other rules keep their order because later rules override earlier
+    ones. Optional flags of rules are not saved.
+ */
+func MarshalDocument(p *Policy) ([]byte, error) {
+    document := policyDocument{DefaultAction: p.DefaultAction.String()}
+
+    rules := p.Rules
+    for len(rules) > 0 && rules[0].Action == Allow && !rules[0].IsConditional() {
+        document.Allow = append(document.Allow, rules[0].Syscall)
+        rules = rules[1:]
+    }
+
+    for _, rule := range rules {
+        item := ruleDocument{Syscall: rule.Syscall, Action: rule.Action.String()}
+        for _, condition := range rule.Conditions {
+            item.Args = append(item.Args, condition.String())
+        }
+        document.Rules = append(document.Rules, item)
+    }
+
+    if len(p.Rlimits) > 0 {
+        document.Rlimits = make(map[string]uint64)
+        for _, limit := range p.Rlimits {
+            document.Rlimits[limit.Resource] = limit.Value
+        }
+    }
+
+    content, err := json.MarshalIndent(document, "", "  ")
+    if err != nil {
+        return nil, err
+    }
+
+    return append(content, '\n'), nil
+}
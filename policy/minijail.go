@@ -0,0 +1,478 @@
+package policy
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+/*
+    Minijail policy files contain one rule per line:
+
+        read: 1
+        ioctl: arg1 == TCGETS || arg1 == TIOCGWINSZ
+        mmap: arg2 in ~PROT_EXEC
+        fcntl: arg1 == F_GETFL; return EINVAL
+        ptrace: return EPERM
+        @include common.policy
+
+    An expression is a list of comparisons joined with "&&" and "||"
+    ("&&" binds tighter). Besides usual comparisons, "argN & MASK" is
+    true if any bit from MASK is set and "argN in MASK" is true if no
+    bits outside MASK are set. If the expression is false, the syscall
+    gets the action after ";" or the default action.
+
+    The action for a false expression is converted into rules with the
+    negated expression, because libseccomp does not allow conditional
+    rules to fall back to an unconditional one.
+ */
+
+/* Limit for rules generated from one line */
+const MAX_MINIJAIL_CLAUSES = 64
+
+type minijailLoader struct {
+    /* files being loaded, used to detect cycles */
+    stack       []string
+}
+
+/* A comparison, anyBit means (arg & Mask) != 0 */
+type minijailAtom struct {
+    condition   Condition
+    anyBit      bool
+}
+
+/* Expression in disjunctive normal form: OR of ANDs */
+type minijailExpression [][]minijailAtom
+
+/*
+    Loads a minijail policy file. Default action of returned policy
+    is kill, minijail files cannot change it.
+ */
+func LoadMinijailPolicy(fileName string) (*Policy, error) {
+    loader := &minijailLoader{}
+    result := New(Kill)
+    if err := loader.load(fileName, result); err != nil {
+        return nil, err
+    }
+
+    return result, nil
+}
+
+func (loader *minijailLoader) load(fileName string, result *Policy) error {
+    absName, err := filepath.Abs(fileName)
+    if err != nil {
+        return err
+    }
+
+    if containsString(loader.stack, absName) {
+        chain := append(loader.stack, absName)
+        return fmt.Errorf("policy files include each other: %s", strings.Join(chain, " -> "))
+    }
+
+    file, err := os.Open(fileName)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    loader.stack = append(loader.stack, absName)
+    defer func () {
+        loader.stack = loader.stack[:len(loader.stack) - 1]
+    } ()
+
+    scanner := bufio.NewScanner(file)
+    lineNumber := 0
+    for scanner.Scan() {
+        lineNumber++
+        if err := loader.parseLine(fileName, scanner.Text(), result); err != nil {
+            if _, isNested := err.(*minijailLocatedError); isNested {
+                return err
+            }
+            return &minijailLocatedError{fmt.Errorf("%s:%d: %s", fileName, lineNumber, err)}
+        }
+    }
+
+    return scanner.Err()
+}
+
+/* Error that already has a file name and a line */
+type minijailLocatedError struct {
+    err         error
+}
+
+func (e *minijailLocatedError) Error() string {
+    return e.err.Error()
+}
+
+func (loader *minijailLoader) parseLine(fileName string, line string, result *Policy) error {
+    if pos := strings.Index(line, "#"); pos >= 0 {
+        line = line[:pos]
+    }
+
+    line = strings.TrimSpace(line)
+    if line == "" {
+        return nil
+    }
+
+    if strings.HasPrefix(line, "@") {
+        return loader.parseDirective(fileName, line, result)
+    }
+
+    pos := strings.Index(line, ":")
+    if pos < 0 {
+        return fmt.Errorf("expected 'syscall: action', got '%s'", line)
+    }
+
+    name := strings.TrimSpace(line[:pos])
+    if !isMinijailSyscallName(name) {
+        return fmt.Errorf("invalid syscall name '%s'", name)
+    }
+
+    rules, err := parseMinijailRule(name, strings.TrimSpace(line[pos + 1:]))
+    if err != nil {
+        return err
+    }
+
+    for _, rule := range rules {
+        result.AddRule(rule)
+    }
+
+    return nil
+}
+
+func (loader *minijailLoader) parseDirective(fileName string, line string, result *Policy) error {
+    fields := strings.Fields(line)
+    switch fields[0] {
+    case "@include":
+        if len(fields) != 2 {
+            return fmt.Errorf("@include expects a single file name")
+        }
+
+        path := fields[1]
+        if !filepath.IsAbs(path) {
+            path = filepath.Join(filepath.Dir(fileName), path)
+        }
+
+        return loader.load(path, result)
+    case "@frequency":
+        // Only affects the order of checks in minijail
+        return nil
+    }
+
+    return fmt.Errorf("unsupported directive %s", fields[0])
+}
+
+func isMinijailSyscallName(name string) bool {
+    if name == "" {
+        return false
+    }
+
+    for _, c := range name {
+        if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' {
+            return false
+        }
+    }
+
+    return true
+}
+
+/* Parses the part after "syscall:" */
+func parseMinijailRule(name string, s string) ([]Rule, error) {
+    parts := strings.Split(s, ";")
+    if len(parts) > 2 {
+        return nil, fmt.Errorf("too many ';' in '%s'", s)
+    }
+
+    if len(parts) == 1 {
+        if action, ok, err := parseMinijailAction(parts[0]); ok || err != nil {
+            return []Rule{{Syscall: name, Action: action}}, err
+        }
+    }
+
+    expression, err := parseMinijailExpression(parts[0])
+    if err != nil {
+        return nil, err
+    }
+
+    rules, err := minijailRules(name, Allow, expression)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(parts) == 1 {
+        return rules, nil
+    }
+
+    elseAction, ok, err := parseMinijailAction(parts[1])
+    if err != nil {
+        return nil, err
+    }
+
+    if !ok {
+        return nil, fmt.Errorf("expected an action after ';', got '%s'", strings.TrimSpace(parts[1]))
+    }
+
+    negated, err := expression.negate()
+    if err != nil {
+        return nil, err
+    }
+
+    elseRules, err := minijailRules(name, elseAction, negated)
+    if err != nil {
+        return nil, fmt.Errorf("cannot convert action for a false expression: %s", err)
+    }
+
+    return append(rules, elseRules...), nil
+}
+
+/*
+    Parses an action, returns ok = false if the string is not
+    an action and might be an expression
+ */
+func parseMinijailAction(s string) (Action, bool, error) {
+    s = strings.TrimSpace(s)
+    switch s {
+    case "1", "allow":
+        return Allow, true, nil
+    case "kill", "kill-process", "kill-thread":
+        return Kill, true, nil
+    case "trap":
+        return Trap, true, nil
+    case "log", "trace", "user-notify":
+        return Action{}, false, fmt.Errorf("action '%s' is not supported", s)
+    case "":
+        return Action{}, false, fmt.Errorf("action is missing")
+    }
+
+    fields := strings.Fields(s)
+    if fields[0] != "return" {
+        return Action{}, false, nil
+    }
+
+    if len(fields) != 2 {
+        return Action{}, false, fmt.Errorf("expected 'return ERRNO', got '%s'", s)
+    }
+
+    errno, err := ParseErrno(fields[1])
+    if err != nil {
+        return Action{}, false, err
+    }
+
+    return Errno(errno), true, nil
+}
+
+func parseMinijailExpression(s string) (minijailExpression, error) {
+    var result minijailExpression
+    for _, clauseText := range strings.Split(s, "||") {
+        var clause []minijailAtom
+        for _, atomText := range strings.Split(clauseText, "&&") {
+            atom, err := parseMinijailAtom(strings.TrimSpace(atomText))
+            if err != nil {
+                return nil, err
+            }
+            clause = append(clause, atom)
+        }
+        result = append(result, clause)
+    }
+
+    return result, nil
+}
+
+func parseMinijailAtom(s string) (minijailAtom, error) {
+    var atom minijailAtom
+    if !strings.HasPrefix(s, "arg") || len(s) < 4 || s[3] < '0' || s[3] > '9' {
+        return atom, fmt.Errorf("comparison '%s' must start with argument like arg0", s)
+    }
+
+    atom.condition.Arg = uint(s[3] - '0')
+    if err := atom.condition.Validate(); err != nil {
+        return atom, err
+    }
+
+    rest := strings.TrimSpace(s[4:])
+    for _, opName := range []string{"==", "!=", "<=", ">=", "<", ">", "&", "in "} {
+        if !strings.HasPrefix(rest, opName) {
+            continue
+        }
+
+        value, err := parseMinijailValue(rest[len(opName):])
+        if err != nil {
+            return atom, err
+        }
+
+        switch opName {
+        case "&":
+            if value == 0 {
+                return atom, fmt.Errorf("mask in '%s' is zero", s)
+            }
+            atom.anyBit = true
+            atom.condition.Mask = value
+        case "in ":
+            atom.condition.Op = OP_MASKED_EQ
+            atom.condition.Mask = ^value
+        default:
+            atom.condition.Op, _ = ParseOperator(opName)
+            atom.condition.Value = value
+        }
+
+        return atom, nil
+    }
+
+    return atom, fmt.Errorf("comparison '%s' has no supported operator", s)
+}
+
+/* Parses values like "PROT_READ|PROT_WRITE" or "~PROT_EXEC" */
+func parseMinijailValue(s string) (uint64, error) {
+    var result uint64
+    for _, part := range strings.Split(s, "|") {
+        part = strings.TrimSpace(part)
+        invert := strings.HasPrefix(part, "~")
+        if invert {
+            part = strings.TrimSpace(part[1:])
+        }
+
+        value, err := ParseValue(part)
+        if err != nil {
+            return 0, err
+        }
+
+        if invert {
+            value = ^value
+        }
+        result |= value
+    }
+
+    return result, nil
+}
+
+/*
+    Negates the expression. For example, !(a && b || c) becomes
+    (!a || !b) && !c, that is !a && !c || !b && !c.
+ */
+func (expression minijailExpression) negate() (minijailExpression, error) {
+    result := minijailExpression{nil}
+    for _, clause := range expression {
+        var alternatives []minijailAtom
+        for _, atom := range clause {
+            alternatives = append(alternatives, atom.negate())
+        }
+
+        var product minijailExpression
+        for _, existing := range result {
+            for _, atom := range alternatives {
+                combined := append(append([]minijailAtom{}, existing...), atom)
+                product = append(product, combined)
+            }
+        }
+
+        if len(product) > MAX_MINIJAIL_CLAUSES {
+            return nil, fmt.Errorf("expression is too complex to negate")
+        }
+        result = product
+    }
+
+    return result, nil
+}
+
+func (atom minijailAtom) negate() minijailAtom {
+    condition := atom.condition
+    if atom.anyBit {
+        // (arg & mask) != 0 becomes (arg & mask) == 0
+        condition.Op = OP_MASKED_EQ
+        condition.Value = 0
+        return minijailAtom{condition: condition}
+    }
+
+    switch condition.Op {
+    case OP_EQ:
+        condition.Op = OP_NE
+    case OP_NE:
+        condition.Op = OP_EQ
+    case OP_LT:
+        condition.Op = OP_GE
+    case OP_LE:
+        condition.Op = OP_GT
+    case OP_GT:
+        condition.Op = OP_LE
+    case OP_GE:
+        condition.Op = OP_LT
+    case OP_MASKED_EQ:
+        // Masked comparisons always have zero value here
+        return minijailAtom{condition: Condition{Arg: condition.Arg, Mask: condition.Mask}, anyBit: true}
+    }
+
+    return minijailAtom{condition: condition}
+}
+
+/*
+    Converts an expression into rules. "Any bit" checks are split into
+    a rule per bit. Libseccomp cannot check one argument twice in a
+    rule, so such clauses are reported as errors.
+ */
+func minijailRules(name string, action Action, expression minijailExpression) ([]Rule, error) {
+    var rules []Rule
+    for _, clause := range expression {
+        conditionSets := [][]Condition{nil}
+        for _, atom := range clause {
+            alternatives := []Condition{atom.condition}
+            if atom.anyBit {
+                alternatives = nil
+                for bit := uint(0); bit < 64; bit++ {
+                    if mask := atom.condition.Mask & (1 << bit); mask != 0 {
+                        alternatives = append(alternatives, Condition{
+                            Arg: atom.condition.Arg, Op: OP_MASKED_EQ, Mask: mask, Value: mask})
+                    }
+                }
+            }
+
+            var product [][]Condition
+            for _, existing := range conditionSets {
+                for _, condition := range alternatives {
+                    combined := append([]Condition{}, existing...)
+                    if !containsCondition(combined, condition) {
+                        combined = append(combined, condition)
+                    }
+                    product = append(product, combined)
+                }
+            }
+
+            if len(product) > MAX_MINIJAIL_CLAUSES {
+                return nil, fmt.Errorf("expression produces too many rules")
+            }
+            conditionSets = product
+        }
+
+        for _, conditions := range conditionSets {
+            if err := checkArgumentsUnique(conditions); err != nil {
+                return nil, err
+            }
+            rules = append(rules, Rule{Syscall: name, Action: action, Conditions: conditions})
+        }
+    }
+
+    return rules, nil
+}
+
+func containsCondition(conditions []Condition, condition Condition) bool {
+    for _, existing := range conditions {
+        if existing == condition {
+            return true
+        }
+    }
+    return false
+}
+
+func checkArgumentsUnique(conditions []Condition) error {
+    for i := range conditions {
+        for j := 0; j < i; j++ {
+            if conditions[i].Arg == conditions[j].Arg {
+                return fmt.Errorf("'%s' and '%s' check the same argument in one rule, "+
+                    "this is not supported by libseccomp", conditions[j], conditions[i])
+            }
+        }
+    }
+
+    return nil
+}
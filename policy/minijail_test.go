@@ -0,0 +1,108 @@
+package policy
+
+import (
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestLoadMinijailPolicy(t *testing.T) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    writeFile(t, dir, "common.policy", `
+exit_group: 1
+`)
+    name := writeFile(t, dir, "main.policy", `
+# Comment
+@include common.policy
+@frequency ./frequency.txt
+read: 1
+write: allow
+ioctl: arg1 == TCGETS || arg1 == TIOCGWINSZ  # terminal
+mmap: arg2 in ~PROT_EXEC
+clone: arg0 & CLONE_THREAD
+fcntl: arg1 == F_GETFL; return EINVAL
+socket: arg0 == AF_UNIX && arg1 == SOCK_STREAM; return EACCES
+ptrace: return EPERM
+`)
+
+    p, err := LoadMinijailPolicy(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if p.DefaultAction != Kill {
+        t.Errorf("Invalid default action: %s", p.DefaultAction)
+    }
+
+    var rules []string
+    for _, rule := range p.Rules {
+        rules = append(rules, rule.String())
+    }
+
+    expected := []string{
+        "exit_group: allow",
+        "read: allow",
+        "write: allow",
+        "ioctl: allow if arg1 == 0x5401",
+        "ioctl: allow if arg1 == 0x5413",
+        "mmap: allow if arg2 & 0x4 == 0x0",
+        "clone: allow if arg0 & 0x10000 == 0x10000",
+        "fcntl: allow if arg1 == 0x3",
+        "fcntl: errno:22 if arg1 != 0x3",
+        "socket: allow if arg0 == 0x1 && arg1 == 0x1",
+        "socket: errno:13 if arg0 != 0x1",
+        "socket: errno:13 if arg1 != 0x1",
+        "ptrace: errno:1",
+    }
+
+    if strings.Join(rules, "\n") != strings.Join(expected, "\n") {
+        t.Errorf("Invalid rules:\n%s\nexpected:\n%s", strings.Join(rules, "\n"),
+            strings.Join(expected, "\n"))
+    }
+}
+
+func TestMinijailNegateMask(t *testing.T) {
+    rules, err := parseMinijailRule("mmap", "arg2 in ~(PROT_EXEC)")
+    if err == nil {
+        t.Errorf("Expected an error for parentheses, got %v", rules)
+    }
+
+    rules, err = parseMinijailRule("mprotect", "arg2 in PROT_READ|PROT_WRITE|~PROT_EXEC; return EPERM")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if len(rules) != 2 || rules[1].String() != "mprotect: errno:1 if arg2 & 0x4 == 0x4" {
+        t.Errorf("Invalid rules: %v", rules)
+    }
+}
+
+func TestMinijailErrors(t *testing.T) {
+    testMinijailError(t, "read: 1\nwrite: arg0 ~= 1\n", "main.policy:2: comparison 'arg0 ~= 1' has no supported operator")
+    testMinijailError(t, "read: log\n", "main.policy:1: action 'log' is not supported")
+    testMinijailError(t, "ioctl: arg1 == TCFOO\n", "main.policy:1: 'TCFOO' is neither a number nor a known constant")
+    testMinijailError(t, "read: arg7 == 1\n", "argument index 7 is out of range")
+    testMinijailError(t, "@denylist\n", "main.policy:1: unsupported directive @denylist")
+    testMinijailError(t, "ioctl: arg1 == TCGETS || arg1 == TIOCGWINSZ; return ENOTTY\n",
+        "main.policy:1: cannot convert action for a false expression")
+    testMinijailError(t, "\n\n@include missing.policy\n", "main.policy:3: open")
+    testMinijailError(t, "@include main.policy\n", "policy files include each other")
+}
+
+func testMinijailError(t *testing.T, content string, expect string) {
+    dir := createTmpDir(t)
+    defer os.RemoveAll(dir)
+
+    name := writeFile(t, dir, "main.policy", content)
+    _, err := LoadMinijailPolicy(name)
+    if err == nil {
+        t.Errorf("Expected error for %s", content)
+        return
+    }
+
+    if !strings.Contains(err.Error(), expect) {
+        t.Errorf("Error '%s' does not contain '%s'", err, expect)
+    }
+}
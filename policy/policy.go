@@ -0,0 +1,348 @@
+package policy
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+/*
+    Policy describes which system calls a sandboxed program is
+    allowed to make. It is independent from the architecture:
+    syscalls are referred by names and can be resolved into
+    numbers later, when the native arch is known.
+
+    A syscall name starting with '@' refers to a group of syscalls,
+    see groups.go.
+ */
+type Policy struct {
+    DefaultAction   Action
+    Rules           []Rule
+    Rlimits         []Rlimit
+}
+
+/*
+    A rule applies an action to a syscall if all conditions
+    are true. Several rules for one syscall are checked
+    one by one, so conditions from different rules work like OR.
+ */
+type Rule struct {
+    Syscall         string
+    Action          Action
+    Conditions      []Condition
+    /* rule is silently skipped if the syscall does not exist on the arch */
+    Optional        bool
+}
+
+type ActionKind int
+
+const (
+    ACTION_KILL ActionKind = iota
+    ACTION_TRAP
+    ACTION_ERRNO
+    ACTION_ALLOW
+)
+
+type Action struct {
+    Kind            ActionKind
+    /* errno value returned for ACTION_ERRNO */
+    Errno           int
+}
+
+type Operator int
+
+const (
+    OP_EQ Operator = iota
+    OP_NE
+    OP_LT
+    OP_LE
+    OP_GT
+    OP_GE
+    /* (arg & Mask) == Value */
+    OP_MASKED_EQ
+)
+
+/* Maximum number of syscall arguments */
+const MAX_ARGS = 6
+
+/* Compares a syscall argument with a value */
+type Condition struct {
+    Arg             uint
+    Op              Operator
+    Value           uint64
+    Mask            uint64
+}
+
+/* Resource limit, both soft and hard limits are set to Value */
+type Rlimit struct {
+    Resource        string
+    Value           uint64
+}
+
+/* Names of resources that can be limited, see setrlimit(2) */
+var RlimitNames = []string{"as", "core", "cpu", "data", "fsize", "nofile", "nproc", "stack"}
+
+var (
+    Kill = Action{Kind: ACTION_KILL}
+    Trap = Action{Kind: ACTION_TRAP}
+    Allow = Action{Kind: ACTION_ALLOW}
+)
+
+func Errno(errno int) Action {
+    return Action{Kind: ACTION_ERRNO, Errno: errno}
+}
+
+func New(defaultAction Action) *Policy {
+    p := new(Policy)
+    p.DefaultAction = defaultAction
+    return p
+}
+
+/* Adds unconditional rules allowing given syscalls */
+func (p *Policy) Allow(names ...string) {
+    for _, name := range names {
+        p.AddRule(Rule{Syscall: name, Action: Allow})
+    }
+}
+
+func (p *Policy) AddRule(rule Rule) {
+    p.Rules = append(p.Rules, rule)
+}
+
+/*
+    Sets a resource limit replacing previous value
+    for the same resource
+ */
+func (p *Policy) SetRlimit(resource string, value uint64) {
+    for i := range p.Rlimits {
+        if p.Rlimits[i].Resource == resource {
+            p.Rlimits[i].Value = value
+            return
+        }
+    }
+
+    p.Rlimits = append(p.Rlimits, Rlimit{resource, value})
+}
+
+/*
+    Appends rules and rlimits from other policy. Default action
+    is not changed.
+ */
+func (p *Policy) Merge(other *Policy) {
+    p.Rules = append(p.Rules, other.Rules...)
+    for _, limit := range other.Rlimits {
+        p.SetRlimit(limit.Resource, limit.Value)
+    }
+}
+
+func (p *Policy) Copy() *Policy {
+    result := New(p.DefaultAction)
+    result.Merge(p)
+    return result
+}
+
+func (rule Rule) IsConditional() bool {
+    return len(rule.Conditions) > 0
+}
+
+func (rule Rule) String() string {
+    if !rule.IsConditional() {
+        return fmt.Sprintf("%s: %s", rule.Syscall, rule.Action)
+    }
+
+    conditions := make([]string, len(rule.Conditions))
+    for i, condition := range rule.Conditions {
+        conditions[i] = condition.String()
+    }
+
+    return fmt.Sprintf("%s: %s if %s", rule.Syscall, rule.Action,
+        strings.Join(conditions, " && "))
+}
+
+var actionNames = map[ActionKind]string{
+    ACTION_KILL: "kill",
+    ACTION_TRAP: "trap",
+    ACTION_ERRNO: "errno",
+    ACTION_ALLOW: "allow",
+}
+
+/* Returns action as "kill", "allow" or "errno:1" */
+func (action Action) String() string {
+    if action.Kind == ACTION_ERRNO {
+        return fmt.Sprintf("errno:%d", action.Errno)
+    }
+
+    return actionNames[action.Kind]
+}
+
+/*
+    Parses an action written as "kill", "trap", "allow",
+    "errno" (meaning EPERM), "errno:13" or "errno:EACCES"
+ */
+func ParseAction(s string) (Action, error) {
+    name := s
+    errnoName := ""
+    if pos := strings.Index(s, ":"); pos >= 0 {
+        name = s[:pos]
+        errnoName = s[pos + 1:]
+    }
+
+    for kind, kindName := range actionNames {
+        if kindName != name {
+            continue
+        }
+
+        if kind != ACTION_ERRNO {
+            if errnoName != "" {
+                return Action{}, fmt.Errorf("action '%s' cannot have a value", name)
+            }
+            return Action{Kind: kind}, nil
+        }
+
+        if errnoName == "" {
+            return Errno(EPERM), nil
+        }
+
+        errno, err := ParseErrno(errnoName)
+        if err != nil {
+            return Action{}, err
+        }
+        return Errno(errno), nil
+    }
+
+    return Action{}, fmt.Errorf("unknown action '%s', expected kill, trap, allow or errno", s)
+}
+
+var operatorNames = map[Operator]string{
+    OP_EQ: "==",
+    OP_NE: "!=",
+    OP_LT: "<",
+    OP_LE: "<=",
+    OP_GT: ">",
+    OP_GE: ">=",
+    OP_MASKED_EQ: "&",
+}
+
+func (op Operator) String() string {
+    return operatorNames[op]
+}
+
+/* Returns condition as "arg1 == 0x5401" or "arg0 & 0x10000 == 0x10000" */
+func (condition Condition) String() string {
+    if condition.Op == OP_MASKED_EQ {
+        return fmt.Sprintf("arg%d & %#x == %#x", condition.Arg, condition.Mask, condition.Value)
+    }
+
+    return fmt.Sprintf("arg%d %s %#x", condition.Arg, condition.Op, condition.Value)
+}
+
+/* Parses an operator written as "==", "!=", "<", "<=", ">", ">=" or "&" */
+func ParseOperator(s string) (Operator, error) {
+    for op, name := range operatorNames {
+        if name == s {
+            return op, nil
+        }
+    }
+
+    return OP_EQ, fmt.Errorf("unknown comparison operator '%s'", s)
+}
+
+/*
+    Parses a condition written as "arg1 == TCGETS", "arg2 != 0"
+    or "arg0 & CLONE_THREAD == CLONE_THREAD". Values can be numbers
+    or constants combined with '|'.
+ */
+func ParseCondition(s string) (Condition, error) {
+    var condition Condition
+    s = strings.TrimSpace(s)
+
+    if !strings.HasPrefix(s, "arg") || len(s) < 4 || s[3] < '0' || s[3] > '9' {
+        return condition, fmt.Errorf("condition '%s' must start with argument like arg0", s)
+    }
+
+    condition.Arg = uint(s[3] - '0')
+    if err := condition.Validate(); err != nil {
+        return condition, err
+    }
+
+    rest := strings.TrimSpace(s[4:])
+    if strings.HasPrefix(rest, "&") {
+        parts := strings.SplitN(rest[1:], "==", 2)
+        if len(parts) != 2 {
+            return condition, fmt.Errorf("condition '%s' must look like 'argN & MASK == VALUE'", s)
+        }
+
+        mask, err := ParseValue(parts[0])
+        if err != nil {
+            return condition, err
+        }
+
+        value, err := ParseValue(parts[1])
+        if err != nil {
+            return condition, err
+        }
+
+        condition.Op = OP_MASKED_EQ
+        condition.Mask = mask
+        condition.Value = value
+        return condition, nil
+    }
+
+    // Longer operators go first so "<=" is not parsed as "<"
+    for _, opName := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+        if !strings.HasPrefix(rest, opName) {
+            continue
+        }
+
+        value, err := ParseValue(rest[len(opName):])
+        if err != nil {
+            return condition, err
+        }
+
+        condition.Op, _ = ParseOperator(opName)
+        condition.Value = value
+        return condition, nil
+    }
+
+    return condition, fmt.Errorf("condition '%s' has no comparison operator", s)
+}
+
+/* Returns true if the condition is true for given syscall arguments */
+func (condition Condition) Matches(args []uint64) bool {
+    var arg uint64
+    if condition.Arg < uint(len(args)) {
+        arg = args[condition.Arg]
+    }
+
+    switch condition.Op {
+    case OP_EQ:
+        return arg == condition.Value
+    case OP_NE:
+        return arg != condition.Value
+    case OP_LT:
+        return arg < condition.Value
+    case OP_LE:
+        return arg <= condition.Value
+    case OP_GT:
+        return arg > condition.Value
+    case OP_GE:
+        return arg >= condition.Value
+    case OP_MASKED_EQ:
+        return arg & condition.Mask == condition.Value
+    }
+
+    return false
+}
+
+func (condition Condition) Validate() error {
+    if condition.Arg >= MAX_ARGS {
+        return fmt.Errorf("argument index %d is out of range 0-%d", condition.Arg, MAX_ARGS - 1)
+    }
+
+    return nil
+}
+
+/* Parses a decimal, hex (0x...) or octal (0...) number */
+func ParseNumber(s string) (uint64, error) {
+    return strconv.ParseUint(s, 0, 64)
+}
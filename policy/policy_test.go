@@ -0,0 +1,109 @@
+package policy
+
+import (
+    "testing"
+)
+
+func TestParseAction(t *testing.T) {
+    testParseAction(t, "kill", Kill)
+    testParseAction(t, "allow", Allow)
+    testParseAction(t, "errno", Errno(EPERM))
+    testParseAction(t, "errno:EACCES", Errno(13))
+    testParseAction(t, "errno:38", Errno(38))
+
+    for _, invalid := range []string{"", "deny", "errno:EWHAT", "kill:1"} {
+        if _, err := ParseAction(invalid); err == nil {
+            t.Errorf("Expected to get error for action '%s'", invalid)
+        }
+    }
+}
+
+func testParseAction(t *testing.T, s string, expect Action) {
+    action, err := ParseAction(s)
+    if err != nil {
+        t.Errorf("Failed to parse action '%s': %s", s, err)
+        return
+    }
+
+    if action != expect {
+        t.Errorf("Expected action '%s' to be %s, got %s", s, expect, action)
+    }
+}
+
+func TestParseValue(t *testing.T) {
+    value, err := ParseValue("O_WRONLY | O_CREAT")
+    if err != nil || value != argumentConstants["O_WRONLY"] | argumentConstants["O_CREAT"] {
+        t.Errorf("Failed to parse combined constants: %d, %v", value, err)
+    }
+
+    value, err = ParseValue("0x10")
+    if err != nil || value != 16 {
+        t.Errorf("Failed to parse hex number: %d, %v", value, err)
+    }
+
+    if _, err = ParseValue("NO_SUCH_CONSTANT"); err == nil {
+        t.Errorf("Expected to get error for unknown constant")
+    }
+}
+
+func TestMergeOverridesRlimits(t *testing.T) {
+    p := New(Kill)
+    p.SetRlimit("nofile", 64)
+
+    other := New(Kill)
+    other.Allow("read")
+    other.SetRlimit("nofile", 128)
+    p.Merge(other)
+
+    if len(p.Rlimits) != 1 || p.Rlimits[0].Value != 128 {
+        t.Fatalf("Expected nofile limit to be overridden, got %v", p.Rlimits)
+    }
+
+    if len(p.Rules) != 1 || p.Rules[0].Syscall != "read" {
+        t.Fatalf("Expected to get a rule for read, got %v", p.Rules)
+    }
+}
+
+func TestProfiles(t *testing.T) {
+    for _, name := range ProfileNames() {
+        profile, err := LookupProfile(name)
+        if err != nil {
+            t.Fatalf("Failed to find profile %s: %s", name, err)
+        }
+
+        p := profile.Policy("amd64", Kill)
+        if !hasRule(p, "execve") {
+            t.Errorf("Profile %s must allow execve", name)
+        }
+
+        if !hasRule(p, "arch_prctl") {
+            t.Errorf("Profile %s must allow arch_prctl on amd64", name)
+        }
+
+        for _, rule := range p.Rules {
+            // Network access is never allowed by a profile
+            if (rule.Syscall == "socket" && len(rule.Conditions) == 0) || rule.Syscall == "@network" {
+                t.Errorf("Profile %s allows network access with %s", name, rule)
+            }
+
+            if IsGroupName(rule.Syscall) {
+                if _, err := LookupGroup(rule.Syscall); err != nil {
+                    t.Errorf("Profile %s: %s", name, err)
+                }
+            }
+        }
+    }
+
+    if _, err := LookupProfile("cobol"); err == nil {
+        t.Errorf("Expected to get error for unknown profile")
+    }
+}
+
+func hasRule(p *Policy, name string) bool {
+    for _, rule := range p.Rules {
+        if rule.Syscall == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,200 @@
+package policy
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+    "syscall"
+)
+
+/*
+    Profile is a built-in set of syscalls, argument rules and
+    recommended resource limits for a language runtime. Lists
+    were obtained by running hello world programs under strace
+    and can be extended with -allow option.
+ */
+type Profile struct {
+    Name        string
+    Desc        string
+    /* syscalls and groups allowed on every arch */
+    Allow       []string
+    /* syscalls allowed only on given arch, keys are arch names like "amd64" */
+    ArchAllow   map[string][]string
+    Rules       []Rule
+    Rlimits     []Rlimit
+}
+
+/* Syscalls that the kernel and dynamic loader need to start any program */
+var startupSyscalls = []string{
+    "execve", "@basic-io", "@memory", "@exit", "@process-info",
+    "set_tid_address", "set_robust_list", "rseq",
+}
+
+/* Syscalls used to set up thread local storage */
+var tlsSyscalls = map[string][]string{
+    "amd64": {"arch_prctl"},
+    "x32": {"arch_prctl"},
+    "x86": {"set_thread_area", "get_thread_area"},
+    "arm": {"set_tls"},
+}
+
+/* Allows to check whether stdout is a terminal and get its size */
+var terminalRules = allowIfArgEquals("ioctl", 1, syscall.TCGETS, syscall.TIOCGWINSZ)
+
+/* Allows clone() only for creating threads, not processes */
+var threadCloneRules = []Rule{
+    Rule{
+        Syscall: "clone",
+        Action: Allow,
+        Conditions: []Condition{
+            {Arg: 0, Op: OP_MASKED_EQ, Mask: syscall.CLONE_THREAD, Value: syscall.CLONE_THREAD},
+        },
+    },
+    // Newer glibc falls back to clone() if clone3() is not available.
+    // Arguments of clone3() are passed in memory and cannot be checked.
+    Rule{Syscall: "clone3", Action: Errno(int(syscall.ENOSYS))},
+}
+
+var profiles = []*Profile{
+    &Profile{
+        Name: "static-c",
+        Desc: "statically linked C or C++ program",
+        Allow: concatStrings(startupSyscalls, []string{
+            "fstat", "newfstatat", "readlink", "readlinkat",
+        }),
+        ArchAllow: tlsSyscalls,
+        Rules: terminalRules,
+        Rlimits: []Rlimit{
+            {"core", 0},
+            {"nofile", 64},
+        },
+    },
+    &Profile{
+        Name: "dynamic-c",
+        Desc: "dynamically linked C or C++ program",
+        Allow: concatStrings(startupSyscalls, []string{
+            "@file-read",
+        }),
+        ArchAllow: tlsSyscalls,
+        Rules: terminalRules,
+        Rlimits: []Rlimit{
+            {"core", 0},
+            {"nofile", 64},
+        },
+    },
+    &Profile{
+        Name: "python3",
+        Desc: "Python 3 interpreter",
+        Allow: concatStrings(startupSyscalls, []string{
+            "@file-read", "@signal", "@thread", "@time", "@poll",
+        }),
+        ArchAllow: tlsSyscalls,
+        Rules: concatRules(
+            terminalRules,
+            allowIfArgEquals("ioctl", 1, FIOCLEX, FIONCLEX),
+            threadCloneRules,
+        ),
+        Rlimits: []Rlimit{
+            {"core", 0},
+            {"nofile", 256},
+        },
+    },
+    &Profile{
+        Name: "go",
+        Desc: "program compiled with Go",
+        Allow: concatStrings(startupSyscalls, []string{
+            "@file-read", "@signal", "@thread", "@time", "@poll",
+        }),
+        ArchAllow: tlsSyscalls,
+        Rules: concatRules(terminalRules, threadCloneRules),
+        Rlimits: []Rlimit{
+            {"core", 0},
+            {"nofile", 256},
+        },
+    },
+    &Profile{
+        Name: "jvm",
+        Desc: "Java virtual machine",
+        Allow: concatStrings(startupSyscalls, []string{
+            "@file-read", "@file-write", "@signal", "@thread", "@time", "@poll",
+            "prctl", "sched_getscheduler", "sched_getparam", "fchdir",
+            "connect", "getsockname",
+        }),
+        ArchAllow: tlsSyscalls,
+        // The JVM connects to Unix sockets at startup, network
+        // access must be allowed explicitly, e.g. with @network
+        Rules: concatRules(
+            terminalRules,
+            allowIfArgEquals("ioctl", 1, FIOCLEX, FIONCLEX),
+            allowIfArgEquals("socket", 0, syscall.AF_UNIX),
+            threadCloneRules,
+        ),
+        Rlimits: []Rlimit{
+            {"core", 0},
+            {"nofile", 4096},
+        },
+    },
+}
+
+/* Returns a profile by name or an error if there is no such profile */
+func LookupProfile(name string) (*Profile, error) {
+    for _, profile := range profiles {
+        if profile.Name == name {
+            return profile, nil
+        }
+    }
+
+    return nil, fmt.Errorf("unknown profile '%s', known profiles are: %s",
+        name, strings.Join(ProfileNames(), ", "))
+}
+
+/* Returns sorted names of all profiles */
+func ProfileNames() []string {
+    var names []string
+    for _, profile := range profiles {
+        names = append(names, profile.Name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+/* Returns rules and rlimits of the profile for given arch */
+func (profile *Profile) Policy(arch string, defaultAction Action) *Policy {
+    p := New(defaultAction)
+    p.Allow(profile.Allow...)
+    p.Allow(profile.ArchAllow[arch]...)
+    p.Rules = append(p.Rules, profile.Rules...)
+    p.Rlimits = append(p.Rlimits, profile.Rlimits...)
+
+    return p
+}
+
+/* Creates rules that allow a syscall when given argument has one of the values */
+func allowIfArgEquals(name string, arg uint, values ...uint64) []Rule {
+    var rules []Rule
+    for _, value := range values {
+        rules = append(rules, Rule{
+            Syscall: name,
+            Action: Allow,
+            Conditions: []Condition{{Arg: arg, Op: OP_EQ, Value: value}},
+        })
+    }
+
+    return rules
+}
+
+func concatStrings(lists ...[]string) []string {
+    var result []string
+    for _, list := range lists {
+        result = append(result, list...)
+    }
+    return result
+}
+
+func concatRules(lists ...[]Rule) []Rule {
+    var result []Rule
+    for _, list := range lists {
+        result = append(result, list...)
+    }
+    return result
+}
@@ -0,0 +1,361 @@
+package policy
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+)
+
+/*
+    Reads logs written by "strace -f -o FILE" and collects syscalls
+    made by traced processes. Supported lines look like:
+
+        1234  openat(AT_FDCWD, "/etc/passwd", O_RDONLY|O_CLOEXEC) = 3
+        [pid  1234] read(3,  <unfinished ...>
+        1234  <... read resumed>"root:x:0:0"..., 4096) = 1024
+        1234  12:00:01.123456 write(1, "hi\n", 3) = 3
+        1234  +++ killed by SIGSYS (core dumped) +++
+
+    Lines with signals, exits and messages from strace itself
+    are skipped.
+ */
+type StraceSummary struct {
+    /* sorted names of syscalls found in the log */
+    Syscalls        []string
+    /* argument values for syscalls from straceArgRules, e.g. "AF_UNIX" */
+    ArgValues       map[string][]string
+    Warnings        []string
+}
+
+/*
+    Syscalls with arguments that can be turned into rules. If accessMode
+    is set, only O_ACCMODE bits of open flags are compared.
+ */
+type straceArgRule struct {
+    syscall         string
+    arg             int
+    accessMode      bool
+}
+
+var straceArgRules = []straceArgRule{
+    {syscall: "socket", arg: 0},
+    {syscall: "open", arg: 1, accessMode: true},
+    {syscall: "openat", arg: 2, accessMode: true},
+}
+
+/* Value stored in ArgValues if an argument cannot be turned into a rule */
+const STRACE_ANY_VALUE = "*"
+
+/* Number of unparsed lines reported in warnings */
+const MAX_STRACE_WARNINGS = 10
+
+type straceParser struct {
+    summary         *StraceSummary
+    seen            map[string]bool
+    /* syscalls that were interrupted by another process, by pid */
+    unfinished      map[string]string
+    skippedLines    int
+}
+
+func ParseStraceLog(reader io.Reader) (*StraceSummary, error) {
+    parser := &straceParser{
+        summary: &StraceSummary{ArgValues: make(map[string][]string)},
+        seen: make(map[string]bool),
+        unfinished: make(map[string]string),
+    }
+
+    scanner := bufio.NewScanner(reader)
+    scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+    lineNumber := 0
+    for scanner.Scan() {
+        lineNumber++
+        parser.parseLine(lineNumber, scanner.Text())
+    }
+
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    if parser.skippedLines > MAX_STRACE_WARNINGS {
+        parser.warn("%d more lines were not recognized", parser.skippedLines - MAX_STRACE_WARNINGS)
+    }
+
+    sort.Strings(parser.summary.Syscalls)
+    return parser.summary, nil
+}
+
+func (parser *straceParser) warn(format string, args ...interface{}) {
+    parser.summary.Warnings = append(parser.summary.Warnings, fmt.Sprintf(format, args...))
+}
+
+func (parser *straceParser) parseLine(lineNumber int, line string) {
+    pid, rest := splitStracePrefix(strings.TrimSpace(line))
+    if rest == "" || strings.HasPrefix(rest, "---") || strings.HasPrefix(rest, "strace: ") {
+        return
+    }
+
+    if strings.HasPrefix(rest, "+++ ") {
+        if strings.HasPrefix(rest, "+++ killed by ") {
+            signal := strings.Fields(rest)[3]
+            if name := parser.unfinished[pid]; name != "" {
+                parser.warn("process %s was killed by %s during %s", pid, signal, name)
+            } else {
+                parser.warn("process %s was killed by %s", pid, signal)
+            }
+        }
+        delete(parser.unfinished, pid)
+        return
+    }
+
+    if strings.HasPrefix(rest, "<... ") {
+        end := strings.Index(rest, " resumed>")
+        if end < 0 {
+            parser.skip(lineNumber, line)
+            return
+        }
+
+        parser.addSyscall(lineNumber, rest[5:end], "")
+        delete(parser.unfinished, pid)
+        return
+    }
+
+    open := strings.Index(rest, "(")
+    if open <= 0 || !isStraceName(rest[:open]) {
+        parser.skip(lineNumber, line)
+        return
+    }
+
+    name := rest[:open]
+    if strings.HasSuffix(rest, "<unfinished ...>") {
+        parser.unfinished[pid] = name
+    }
+
+    parser.addSyscall(lineNumber, name, rest[open + 1:])
+}
+
+func (parser *straceParser) skip(lineNumber int, line string) {
+    parser.skippedLines++
+    if parser.skippedLines <= MAX_STRACE_WARNINGS {
+        parser.warn("line %d is not recognized: %s", lineNumber, line)
+    }
+}
+
+func (parser *straceParser) addSyscall(lineNumber int, name string, args string) {
+    // strace prints syscalls unknown to it as syscall_0x1b6
+    if strings.HasPrefix(name, "syscall_") {
+        parser.warn("line %d: unknown syscall %s is skipped", lineNumber, name)
+        return
+    }
+
+    if !parser.seen[name] {
+        parser.seen[name] = true
+        parser.summary.Syscalls = append(parser.summary.Syscalls, name)
+    }
+
+    // Arguments of resumed syscalls were printed on another line
+    if args == "" {
+        return
+    }
+
+    for _, rule := range straceArgRules {
+        if rule.syscall == name {
+            parser.addArgValue(name, straceArgValue(rule, splitStraceArgs(args)))
+        }
+    }
+}
+
+func (parser *straceParser) addArgValue(name string, value string) {
+    if !containsString(parser.summary.ArgValues[name], value) {
+        parser.summary.ArgValues[name] = append(parser.summary.ArgValues[name], value)
+    }
+}
+
+/* Returns a constant name for the argument or STRACE_ANY_VALUE */
+func straceArgValue(rule straceArgRule, args []string) string {
+    if rule.arg >= len(args) {
+        return STRACE_ANY_VALUE
+    }
+
+    value := args[rule.arg]
+    if rule.accessMode {
+        for _, flag := range strings.Split(value, "|") {
+            switch flag {
+            case "O_RDONLY", "O_WRONLY", "O_RDWR":
+                return flag
+            }
+        }
+        return STRACE_ANY_VALUE
+    }
+
+    if _, ok := LookupConstant(value); !ok {
+        return STRACE_ANY_VALUE
+    }
+
+    return value
+}
+
+/* Removes pid and timestamps from the beginning of the line */
+func splitStracePrefix(line string) (pid string, rest string) {
+    if strings.HasPrefix(line, "[pid ") {
+        if end := strings.Index(line, "]"); end >= 0 {
+            pid = strings.TrimSpace(line[5:end])
+            line = strings.TrimSpace(line[end + 1:])
+        }
+    }
+
+    for {
+        fields := strings.SplitN(line, " ", 2)
+        if len(fields) < 2 || !isStraceNumber(fields[0]) {
+            return pid, line
+        }
+
+        // The first plain number is a pid, others are timestamps
+        if pid == "" && strings.Trim(fields[0], "0123456789") == "" {
+            pid = fields[0]
+        }
+        line = strings.TrimSpace(fields[1])
+    }
+}
+
+func isStraceNumber(s string) bool {
+    return s != "" && strings.Trim(s, "0123456789:.") == ""
+}
+
+func isStraceName(s string) bool {
+    for _, c := range s {
+        if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' {
+            return false
+        }
+    }
+    return true
+}
+
+/*
+    Splits arguments by commas that are not inside quotes
+    or brackets, stops at the closing parenthesis
+ */
+func splitStraceArgs(s string) []string {
+    var args []string
+    depth := 0
+    inString := false
+    start := 0
+
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if inString {
+            if c == '\\' {
+                i++
+            } else if c == '"' {
+                inString = false
+            }
+            continue
+        }
+
+        switch c {
+        case '"':
+            inString = true
+        case '(', '[', '{':
+            depth++
+        case ']', '}':
+            depth--
+        case ')':
+            if depth == 0 {
+                return append(args, strings.TrimSpace(s[start:i]))
+            }
+            depth--
+        case ',':
+            if depth == 0 {
+                args = append(args, strings.TrimSpace(s[start:i]))
+                start = i + 1
+            }
+        }
+    }
+
+    // Unfinished syscalls have no closing parenthesis
+    last := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s[start:]), "<unfinished ...>"))
+    if last != "" {
+        args = append(args, last)
+    }
+
+    return args
+}
+
+/* Writes a guarddog config file with allowed syscalls */
+func (summary *StraceSummary) WriteConfig(w io.Writer) error {
+    lines := []string{"# Generated from strace log"}
+    for _, name := range summary.Syscalls {
+        lines = append(lines, "allow = " + name)
+    }
+
+    _, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+    return err
+}
+
+/*
+    Writes a YAML policy file. If withArgs is set, rules checking
+    arguments are generated for syscalls from straceArgRules.
+ */
+func (summary *StraceSummary) WritePolicy(w io.Writer, withArgs bool) error {
+    var allow []string
+    var rules []string
+
+    for _, name := range summary.Syscalls {
+        conditions := summary.argConditions(name)
+        if !withArgs || conditions == nil {
+            allow = append(allow, name)
+            continue
+        }
+
+        for _, condition := range conditions {
+            rules = append(rules, fmt.Sprintf("  - syscall: %s\n    args: [\"%s\"]", name, condition))
+        }
+    }
+
+    // An empty allow key is an error in policy files
+    lines := []string{"# Generated from strace log", "default-action: kill"}
+    if len(allow) > 0 {
+        lines = append(lines, "allow:")
+    }
+    for _, name := range allow {
+        lines = append(lines, "  - " + name)
+    }
+
+    if len(rules) > 0 {
+        lines = append(lines, "rules:")
+        lines = append(lines, rules...)
+    }
+
+    _, err := io.WriteString(w, strings.Join(lines, "\n") + "\n")
+    return err
+}
+
+/* Returns nil if the syscall must be allowed without conditions */
+func (summary *StraceSummary) argConditions(name string) []string {
+    values := summary.ArgValues[name]
+    if len(values) == 0 || containsString(values, STRACE_ANY_VALUE) {
+        return nil
+    }
+
+    var rule straceArgRule
+    for _, candidate := range straceArgRules {
+        if candidate.syscall == name {
+            rule = candidate
+        }
+    }
+
+    sorted := append([]string{}, values...)
+    sort.Strings(sorted)
+
+    var conditions []string
+    for _, value := range sorted {
+        if rule.accessMode {
+            conditions = append(conditions, fmt.Sprintf("arg%d & O_ACCMODE == %s", rule.arg, value))
+        } else {
+            conditions = append(conditions, fmt.Sprintf("arg%d == %s", rule.arg, value))
+        }
+    }
+
+    return conditions
+}
@@ -0,0 +1,145 @@
+package policy
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+)
+
+const testStraceLog = `1200  execve("/usr/bin/python3", ["python3", "-c", "import os"], 0x7ffd /* 20 vars */) = 0
+1200  brk(NULL)                         = 0x55d4
+1200  openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3
+1200  open("/tmp/out, (x)", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 4
+1200  socket(AF_UNIX, SOCK_STREAM|SOCK_CLOEXEC|SOCK_NONBLOCK, 0) = 5
+1200  clone(child_stack=NULL, flags=CLONE_CHILD_CLEARTID|SIGCHLD) = 1201
+[pid  1201] 12:00:01.123456 read(3,  <unfinished ...>
+1200  wait4(1201,  <unfinished ...>
+1201  <... read resumed>"hello", 4096) = 5
+1201  mkdir("/tmp/x", 0777 <unfinished ...>
+1201  +++ killed by SIGSYS (core dumped) +++
+1200  <... wait4 resumed>[{WIFSIGNALED(s) && WTERMSIG(s) == SIGSYS}], 0, NULL) = 1201
+1200  --- SIGCHLD {si_signo=SIGCHLD, si_code=CLD_DUMPED, si_pid=1201} ---
+1200  syscall_0x1b6(0x1, 0x2) = -1 ENOSYS (Function not implemented)
+1200  socket(AF_INET6, SOCK_DGRAM, IPPROTO_IP) = 6
+1200  exit_group(0)                     = ?
+1200  +++ exited with 0 +++
+strace: Process 1200 detached
+`
+
+func TestParseStraceLog(t *testing.T) {
+    summary, err := ParseStraceLog(strings.NewReader(testStraceLog))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    expected := "brk clone execve exit_group mkdir open openat read socket wait4"
+    if strings.Join(summary.Syscalls, " ") != expected {
+        t.Errorf("Invalid syscalls: %v", summary.Syscalls)
+    }
+
+    warnings := strings.Join(summary.Warnings, "\n")
+    if len(summary.Warnings) != 2 ||
+        !strings.Contains(warnings, "process 1201 was killed by SIGSYS during mkdir") ||
+        !strings.Contains(warnings, "unknown syscall syscall_0x1b6") {
+        t.Errorf("Invalid warnings:\n%s", warnings)
+    }
+
+    var buffer bytes.Buffer
+    if err := summary.WritePolicy(&buffer, true); err != nil {
+        t.Fatal(err)
+    }
+
+    expectedPolicy := `# Generated from strace log
+default-action: kill
+allow:
+  - brk
+  - clone
+  - execve
+  - exit_group
+  - mkdir
+  - read
+  - wait4
+rules:
+  - syscall: open
+    args: ["arg1 & O_ACCMODE == O_WRONLY"]
+  - syscall: openat
+    args: ["arg2 & O_ACCMODE == O_RDONLY"]
+  - syscall: socket
+    args: ["arg0 == AF_INET6"]
+  - syscall: socket
+    args: ["arg0 == AF_UNIX"]
+`
+    if buffer.String() != expectedPolicy {
+        t.Errorf("Invalid policy:\n%s", buffer.String())
+    }
+
+    // Generated policy must be loadable
+    if _, err := loadPolicyString(buffer.String()); err != nil {
+        t.Errorf("Cannot load generated policy: %s", err)
+    }
+}
+
+func TestStracePolicyWithoutAllowList(t *testing.T) {
+    // Every syscall gets rules, or there are no syscalls at all
+    for _, log := range []string{"socket(AF_UNIX, SOCK_STREAM, 0) = 3\n", ""} {
+        summary, err := ParseStraceLog(strings.NewReader(log))
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        var buffer bytes.Buffer
+        if err := summary.WritePolicy(&buffer, true); err != nil {
+            t.Fatal(err)
+        }
+
+        if strings.Contains(buffer.String(), "allow:") {
+            t.Errorf("Expected no allow key in policy:\n%s", buffer.String())
+        }
+
+        if _, err := loadPolicyString(buffer.String()); err != nil {
+            t.Errorf("Cannot load generated policy: %s\n%s", err, buffer.String())
+        }
+    }
+}
+
+func TestStraceUnknownArgumentValue(t *testing.T) {
+    summary, err := ParseStraceLog(strings.NewReader(
+        "socket(AF_UNIX, SOCK_STREAM, 0) = 3\nsocket(AF_BLUETOOTH, SOCK_RAW, 0) = 4\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if summary.argConditions("socket") != nil {
+        t.Errorf("Socket with unknown domain must be allowed without conditions")
+    }
+}
+
+func TestSplitStraceArgs(t *testing.T) {
+    args := splitStraceArgs(`AT_FDCWD, "a\", b", [1, 2], {x=1, y=2}, f(1, 2)) = 0`)
+    expected := []string{"AT_FDCWD", `"a\", b"`, "[1, 2]", "{x=1, y=2}", "f(1, 2)"}
+    if strings.Join(args, "|") != strings.Join(expected, "|") {
+        t.Errorf("Invalid args: %q", args)
+    }
+}
+
+func loadPolicyString(content string) ([]Rule, error) {
+    file, err := ioutil.TempFile("", "generated-*.yaml")
+    if err != nil {
+        return nil, err
+    }
+    defer os.Remove(file.Name())
+
+    _, err = file.WriteString(content)
+    file.Close()
+    if err != nil {
+        return nil, err
+    }
+
+    p, err := LoadFile(file.Name(), "amd64")
+    if err != nil {
+        return nil, err
+    }
+    return p.Rules, nil
+}
@@ -0,0 +1,451 @@
+package policy
+
+import (
+    "fmt"
+    "strings"
+)
+
+/*
+    Parser for a subset of YAML that is enough for policy files:
+    block maps and lists, flow lists and maps like [a, b] and
+    {key: value}, plain and quoted scalars and comments. Anchors,
+    tags and multiline scalars are not supported.
+ */
+type yamlLine struct {
+    number      int
+    /* column of the first character of text, starts from 0 */
+    indent      int
+    text        string
+}
+
+type yamlParser struct {
+    file        string
+    lines       []*yamlLine
+    pos         int
+}
+
+func parseYaml(file string, content []byte) (*node, error) {
+    p := &yamlParser{file: file}
+
+    for i, text := range strings.Split(string(content), "\n") {
+        text = strings.TrimRight(text, "\r")
+        leading := text[:len(text) - len(strings.TrimLeft(text, " \t"))]
+        if strings.Contains(leading, "\t") && len(leading) < len(text) {
+            return nil, syntaxError(file, i + 1, 1, "tabs cannot be used for indentation")
+        }
+
+        stripped := stripYamlComment(text)
+
+        trimmed := strings.TrimLeft(stripped, " ")
+        trimmed = strings.TrimRight(trimmed, " \t")
+        if trimmed == "" || trimmed == "---" {
+            continue
+        }
+
+        if trimmed == "..." {
+            break
+        }
+
+        p.lines = append(p.lines, &yamlLine{
+            number: i + 1,
+            indent: len(stripped) - len(strings.TrimLeft(stripped, " ")),
+            text: trimmed,
+        })
+    }
+
+    if len(p.lines) == 0 {
+        return &node{kind: NODE_MAP, line: 1, col: 1}, nil
+    }
+
+    root, err := p.parseBlock(p.lines[0].indent)
+    if err != nil {
+        return nil, err
+    }
+
+    if p.pos < len(p.lines) {
+        line := p.lines[p.pos]
+        return nil, syntaxError(file, line.number, line.indent + 1, "unexpected indentation")
+    }
+
+    return root, nil
+}
+
+/* Removes a comment that starts with '#' outside of quotes */
+func stripYamlComment(text string) string {
+    var quote rune
+    for i, c := range text {
+        switch {
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '#' && (i == 0 || text[i - 1] == ' ' || text[i - 1] == '\t'):
+            return text[:i]
+        }
+    }
+
+    return text
+}
+
+func (p *yamlParser) current() *yamlLine {
+    if p.pos >= len(p.lines) {
+        return nil
+    }
+    return p.lines[p.pos]
+}
+
+func (p *yamlParser) errorAt(line *yamlLine, format string, args ...interface{}) error {
+    return syntaxError(p.file, line.number, line.indent + 1, format, args...)
+}
+
+/* Parses a map or a list whose lines start at given indent */
+func (p *yamlParser) parseBlock(indent int) (*node, error) {
+    line := p.current()
+    if isYamlListItem(line.text) {
+        return p.parseList(indent)
+    }
+
+    return p.parseMap(indent)
+}
+
+func isYamlListItem(text string) bool {
+    return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseList(indent int) (*node, error) {
+    first := p.current()
+    result := &node{kind: NODE_LIST, line: first.number, col: indent + 1}
+
+    for {
+        line := p.current()
+        if line == nil || line.indent < indent {
+            return result, nil
+        }
+
+        if line.indent > indent {
+            return nil, p.errorAt(line, "unexpected indentation")
+        }
+
+        if !isYamlListItem(line.text) {
+            return nil, p.errorAt(line, "expected a list item starting with '-'")
+        }
+
+        rest := strings.TrimLeft(line.text[1:], " ")
+        var item *node
+        var err error
+
+        if rest == "" {
+            // Item value is on the following lines
+            p.pos++
+            next := p.current()
+            if next == nil || next.indent <= indent {
+                item = &node{kind: NODE_SCALAR, line: line.number, col: indent + 1}
+            } else {
+                item, err = p.parseBlock(next.indent)
+            }
+        } else if isYamlListItem(rest) || isYamlMapEntry(rest) {
+            // Nested block starts on the same line as the dash,
+            // treat the rest of the line as a separate line
+            restIndent := line.indent + len(line.text) - len(rest)
+            line.indent = restIndent
+            line.text = rest
+            item, err = p.parseBlock(restIndent)
+        } else {
+            item, err = p.parseInlineValue(line, rest, line.indent + len(line.text) - len(rest))
+            p.pos++
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        result.items = append(result.items, item)
+    }
+}
+
+/* Returns true if text looks like "key: value" or "key:" */
+func isYamlMapEntry(text string) bool {
+    _, _, ok := splitYamlMapEntry(text)
+    return ok
+}
+
+func splitYamlMapEntry(text string) (key string, value string, ok bool) {
+    if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+        end := strings.IndexRune(text[1:], rune(text[0]))
+        if end < 0 {
+            return "", "", false
+        }
+
+        rest := text[end + 2:]
+        if !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+            return "", "", false
+        }
+
+        return text[:end + 2], strings.TrimSpace(rest[1:]), true
+    }
+
+    if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+        return "", "", false
+    }
+
+    for i := 0; i < len(text); i++ {
+        if text[i] == ':' && (i + 1 == len(text) || text[i + 1] == ' ') {
+            return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i + 1:]), true
+        }
+    }
+
+    return "", "", false
+}
+
+func (p *yamlParser) parseMap(indent int) (*node, error) {
+    first := p.current()
+    result := &node{kind: NODE_MAP, line: first.number, col: indent + 1}
+
+    for {
+        line := p.current()
+        if line == nil || line.indent < indent {
+            return result, nil
+        }
+
+        if line.indent > indent {
+            return nil, p.errorAt(line, "unexpected indentation")
+        }
+
+        keyText, valueText, ok := splitYamlMapEntry(line.text)
+        if !ok {
+            if isYamlListItem(line.text) {
+                return nil, p.errorAt(line, "expected 'key: value', got a list item")
+            }
+            return nil, p.errorAt(line, "expected 'key: value'")
+        }
+
+        key, err := p.parseScalar(line, keyText, line.indent)
+        if err != nil {
+            return nil, err
+        }
+
+        if result.get(key.value) != nil {
+            return nil, p.errorAt(line, "duplicate key '%s'", key.value)
+        }
+
+        var value *node
+        if valueText == "" {
+            p.pos++
+            next := p.current()
+            switch {
+            case next != nil && next.indent > indent:
+                value, err = p.parseBlock(next.indent)
+            case next != nil && next.indent == indent && isYamlListItem(next.text):
+                // A list can have the same indent as its key
+                value, err = p.parseList(indent)
+            default:
+                value = &node{kind: NODE_SCALAR, line: line.number, col: len(keyText) + indent + 2}
+            }
+        } else {
+            valueCol := line.indent + strings.Index(line.text[len(keyText):], valueText) + len(keyText)
+            value, err = p.parseInlineValue(line, valueText, valueCol)
+            p.pos++
+        }
+
+        if err != nil {
+            return nil, err
+        }
+
+        result.keys = append(result.keys, key)
+        result.values = append(result.values, value)
+    }
+}
+
+/* Parses a scalar or a flow collection that fits on one line */
+func (p *yamlParser) parseInlineValue(line *yamlLine, text string, col int) (*node, error) {
+    if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+        flow := &yamlFlowParser{file: p.file, line: line.number, text: text, col: col}
+        value, err := flow.parseValue()
+        if err != nil {
+            return nil, err
+        }
+
+        flow.skipSpace()
+        if flow.pos < len(flow.text) {
+            return nil, flow.errorf("unexpected data after the end of value")
+        }
+
+        return value, nil
+    }
+
+    if strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*") ||
+            strings.HasPrefix(text, "!") || text == "|" || text == ">" {
+        return nil, syntaxError(p.file, line.number, col + 1,
+            "anchors, tags and multiline values are not supported")
+    }
+
+    return p.parseScalar(line, text, col)
+}
+
+func (p *yamlParser) parseScalar(line *yamlLine, text string, col int) (*node, error) {
+    value, quoted, err := unquoteYamlScalar(text)
+    if err != nil {
+        return nil, syntaxError(p.file, line.number, col + 1, "%s", err)
+    }
+
+    return &node{kind: NODE_SCALAR, line: line.number, col: col + 1, value: value, quoted: quoted}, nil
+}
+
+func unquoteYamlScalar(text string) (value string, quoted bool, err error) {
+    if len(text) >= 2 && text[0] == '\'' && text[len(text) - 1] == '\'' {
+        return strings.Replace(text[1:len(text) - 1], "''", "'", -1), true, nil
+    }
+
+    if len(text) >= 2 && text[0] == '"' && text[len(text) - 1] == '"' {
+        value, err := unquoteJsonString([]byte(text))
+        if err != nil {
+            return "", false, fmt.Errorf("invalid quoted string %s", text)
+        }
+        return value, true, nil
+    }
+
+    if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+        return "", false, fmt.Errorf("unterminated quoted string")
+    }
+
+    return text, false, nil
+}
+
+/* Parses flow collections like [a, "b"] or {key: value} */
+type yamlFlowParser struct {
+    file        string
+    line        int
+    /* column of the first character of text, starts from 0 */
+    col         int
+    text        string
+    pos         int
+}
+
+func (p *yamlFlowParser) errorf(format string, args ...interface{}) error {
+    return syntaxError(p.file, p.line, p.col + p.pos + 1, format, args...)
+}
+
+func (p *yamlFlowParser) skipSpace() {
+    for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+        p.pos++
+    }
+}
+
+func (p *yamlFlowParser) parseValue() (*node, error) {
+    p.skipSpace()
+    if p.pos >= len(p.text) {
+        return nil, p.errorf("unexpected end of line, expected a value")
+    }
+
+    switch p.text[p.pos] {
+    case '[':
+        return p.parseCollection(NODE_LIST, ']')
+    case '{':
+        return p.parseCollection(NODE_MAP, '}')
+    }
+
+    return p.parseScalar()
+}
+
+func (p *yamlFlowParser) parseCollection(kind nodeKind, end byte) (*node, error) {
+    result := &node{kind: kind, line: p.line, col: p.col + p.pos + 1}
+    p.pos++
+
+    for {
+        p.skipSpace()
+        if p.pos < len(p.text) && p.text[p.pos] == end {
+            p.pos++
+            return result, nil
+        }
+
+        if kind == NODE_LIST {
+            item, err := p.parseValue()
+            if err != nil {
+                return nil, err
+            }
+            result.items = append(result.items, item)
+        } else {
+            key, err := p.parseScalar()
+            if err != nil {
+                return nil, err
+            }
+
+            p.skipSpace()
+            if p.pos >= len(p.text) || p.text[p.pos] != ':' {
+                return nil, p.errorf("expected ':' after key '%s'", key.value)
+            }
+            p.pos++
+
+            if result.get(key.value) != nil {
+                return nil, syntaxError(p.file, key.line, key.col, "duplicate key '%s'", key.value)
+            }
+
+            value, err := p.parseValue()
+            if err != nil {
+                return nil, err
+            }
+
+            result.keys = append(result.keys, key)
+            result.values = append(result.values, value)
+        }
+
+        p.skipSpace()
+        if p.pos < len(p.text) && p.text[p.pos] == ',' {
+            p.pos++
+            continue
+        }
+
+        if p.pos >= len(p.text) || p.text[p.pos] != end {
+            return nil, p.errorf("expected ',' or '%c'", end)
+        }
+    }
+}
+
+func (p *yamlFlowParser) parseScalar() (*node, error) {
+    p.skipSpace()
+    start := p.pos
+
+    if p.pos < len(p.text) && (p.text[p.pos] == '"' || p.text[p.pos] == '\'') {
+        quote := p.text[p.pos]
+        p.pos++
+        for p.pos < len(p.text) && p.text[p.pos] != quote {
+            if p.text[p.pos] == '\\' && quote == '"' {
+                p.pos++
+            }
+            p.pos++
+        }
+
+        if p.pos >= len(p.text) {
+            return nil, p.errorf("unterminated quoted string")
+        }
+        p.pos++
+    } else {
+        for p.pos < len(p.text) && !p.isPlainScalarEnd() {
+            p.pos++
+        }
+    }
+
+    text := strings.TrimSpace(p.text[start:p.pos])
+    value, quoted, err := unquoteYamlScalar(text)
+    if err != nil {
+        return nil, syntaxError(p.file, p.line, p.col + start + 1, "%s", err)
+    }
+
+    return &node{kind: NODE_SCALAR, line: p.line, col: p.col + start + 1, value: value, quoted: quoted}, nil
+}
+
+/* 
+    Plain scalar ends at a flow indicator or at ':' followed
+    by a space, so values like "errno:EPERM" can be written 
+    without quotes
+ */
+func (p *yamlFlowParser) isPlainScalarEnd() bool {
+    c := p.text[p.pos]
+    if c == ':' {
+        return p.pos + 1 >= len(p.text) || strings.ContainsRune(" ,]}", rune(p.text[p.pos + 1]))
+    }
+
+    return strings.ContainsRune(",]}[{", rune(c))
+}
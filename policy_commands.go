@@ -0,0 +1,289 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "guarddog/config"
+    "guarddog/policy"
+    "guarddog/seccomphelper"
+    "guarddog/util"
+)
+
+var policyCommands = []command{
+    {"export", policyExportCommand},
+    {"test", policyTestCommand},
+    {"diff", policyDiffCommand},
+    {"from-strace", policyFromStraceCommand},
+}
+
+/* Implements "guarddog policy SUBCOMMAND" */
+func policyCommand(args []string) int {
+    if len(args) > 0 {
+        if command := findCommand(policyCommands, args[0]); command != nil {
+            return command.run(args[1:])
+        }
+    }
+
+    fmt.Fprintf(os.Stderr, "Usage: %s policy export|test|diff|from-strace [options]\n", os.Args[0])
+    if len(args) > 0 && args[0] != "-help" && args[0] != "-h" {
+        fmt.Fprintf(os.Stderr, "%s: unknown policy command '%s'\n", config.PROGRAM_NAME, args[0])
+    }
+    return 1
+}
+
+/* Implements "guarddog policy export" */
+func policyExportCommand(args []string) int {
+    options := config.NewPolicyExportOptions()
+    if ok, code := parseCommandOptions("policy export -format=FORMAT [options]", options, args); !ok {
+        return code
+    }
+
+    if err := exportPolicy(newStderrLogger(), &options.PolicyOptions, options.Format); err != nil {
+        return printError(err)
+    }
+
+    return 0
+}
+
+func exportPolicy(logger *util.Logger, options *config.PolicyOptions, format string) error {
+    p, rules, err := resolvePolicy(logger, options)
+    if err != nil {
+        return err
+    }
+
+    // Resolved rules contain only native names and no overridden rules
+    var exported *policy.Policy
+    if !options.AllowAnySyscalls {
+        exported = policy.New(p.DefaultAction)
+        for _, rule := range rules {
+            exported.AddRule(policy.Rule{Syscall: rule.Syscall, Action: rule.Action, Conditions: rule.Conditions})
+        }
+    }
+
+    arch := seccomphelper.GetLibraryInfo().Arch
+    output, warnings, err := policy.ExportPolicy(exported, arch, format)
+    if err != nil {
+        return err
+    }
+
+    for _, warning := range warnings {
+        logger.Warning("%s", warning)
+    }
+
+    fmt.Print(output)
+    return nil
+}
+
+/*
+    Implements "guarddog policy test SYSCALL [ARGS]", exit code is 0
+    if the syscall is allowed and 2 if it is not
+ */
+func policyTestCommand(args []string) int {
+    options := config.NewPolicyTestOptions()
+    if ok, code := parseCommandOptions("policy test [options] SYSCALL [ARGS]", options, args); !ok {
+        return code
+    }
+
+    name := options.Call[0]
+    natives, _ := seccomphelper.NormalizeSyscallNames([]string{name})
+    if len(natives) == 0 {
+        return printError(fmt.Errorf("syscall %s does not exist on arch %s",
+            name, seccomphelper.GetLibraryInfo().Arch))
+    }
+
+    number, err := seccomphelper.GetSyscallNumber(natives[0])
+    if err != nil {
+        return printError(err)
+    }
+
+    values := make([]uint64, policy.MAX_ARGS)
+    for i, arg := range options.Call[1:] {
+        value, err := policy.ParseValue(arg)
+        if err != nil {
+            return printError(fmt.Errorf("argument %d: %s", i, err))
+        }
+
+        // Arguments of a name that does not exist here are moved to their places in the equivalent
+        position, ok := seccomphelper.EquivalentArgument(name, natives[0], uint(i))
+        if !ok {
+            return printError(fmt.Errorf("argument %d of %s has no equivalent in %s", i, name, natives[0]))
+        }
+        values[position] = value
+    }
+
+    p, rules, err := resolvePolicy(newStderrLogger(), &options.PolicyOptions)
+    if err != nil {
+        return printError(err)
+    }
+
+    action := policy.Allow
+    if !options.AllowAnySyscalls {
+        action = seccomphelper.EvaluateRules(rules, p.DefaultAction, number, values)
+    }
+
+    fmt.Printf("%s(%s): %s\n", natives[0], strings.Join(options.Call[1:], ", "), action)
+    if action != policy.Allow {
+        return 2
+    }
+
+    return 0
+}
+
+/*
+    Implements "guarddog policy diff A B", exit code is 0 if policies
+    are the same and 2 if they differ
+ */
+func policyDiffCommand(args []string) int {
+    options := config.NewPolicyDiffOptions()
+    if ok, code := parseCommandOptions("policy diff [options] CONFIG|POLICY CONFIG|POLICY", options, args); !ok {
+        return code
+    }
+
+    logger := newStderrLogger()
+    var defaults [2]policy.Action
+    var rules [2][]seccomphelper.ResolvedRule
+    for i, fileName := range options.Files {
+        var err error
+        defaults[i], rules[i], err = loadPolicyForDiff(logger, fileName, options.Arch)
+        if err != nil {
+            return printError(fmt.Errorf("%s: %s", fileName, err))
+        }
+    }
+
+    diff := seccomphelper.DiffRules(rules[0], defaults[0], rules[1], defaults[1])
+    diff.Arch = options.Arch
+    if diff.Arch == "" {
+        diff.Arch = seccomphelper.GetLibraryInfo().Arch
+    }
+
+    if options.Format == config.DIFF_FORMAT_JSON {
+        output, err := json.MarshalIndent(diff, "", "  ")
+        if err != nil {
+            return printError(err)
+        }
+        fmt.Printf("%s\n", output)
+    } else {
+        printPolicyDiff(diff)
+    }
+
+    if !diff.IsEmpty() {
+        return 2
+    }
+
+    return 0
+}
+
+/*
+    Loads a policy file (.yaml, .yml, .json) or policy options from
+    a config file, returns default action and resolved rules
+ */
+func loadPolicyForDiff(logger *util.Logger, fileName string, arch string) (policy.Action, []seccomphelper.ResolvedRule, error) {
+    options := config.NewGuarddogOptions()
+
+    switch filepath.Ext(fileName) {
+    case ".yaml", ".yml", ".json":
+        options.Policy = fileName
+    default:
+        parser := config.NewConfigurationParser()
+        if err := parser.ParseConfigFile(options, fileName); err != nil {
+            return policy.Action{}, nil, err
+        }
+        logWarnings(logger, parser.Warnings())
+    }
+
+    if err := options.PolicyOptions.Validate(); err != nil {
+        return policy.Action{}, nil, err
+    }
+
+    // Without a filter every syscall is allowed
+    if options.AllowAnySyscalls {
+        return policy.Allow, nil, nil
+    }
+
+    p, rules, err := resolvePolicyForArch(logger, &options.PolicyOptions, arch)
+    if err != nil {
+        return policy.Action{}, nil, err
+    }
+
+    return p.DefaultAction, rules, nil
+}
+
+/*
+    Prints a diff like:
+
+        default-action: kill -> errno:1
+        + write: allow
+        - exit: allow
+        ~ socket: - allow if arg0 == 0x1
+        ~ socket: + allow if arg0 == 0xa
+ */
+func printPolicyDiff(diff *seccomphelper.PolicyDiff) {
+    if diff.OldDefaultAction != diff.NewDefaultAction {
+        fmt.Printf("default-action: %s -> %s\n", diff.OldDefaultAction, diff.NewDefaultAction)
+    }
+
+    for _, added := range diff.Added {
+        for _, rule := range added.New {
+            fmt.Printf("+ %s: %s\n", added.Syscall, rule)
+        }
+    }
+
+    for _, removed := range diff.Removed {
+        for _, rule := range removed.Old {
+            fmt.Printf("- %s: %s\n", removed.Syscall, rule)
+        }
+    }
+
+    for _, changed := range diff.Changed {
+        for _, rule := range changed.Old {
+            fmt.Printf("~ %s: - %s\n", changed.Syscall, rule)
+        }
+        for _, rule := range changed.New {
+            fmt.Printf("~ %s: + %s\n", changed.Syscall, rule)
+        }
+    }
+}
+
+/* Implements "guarddog policy from-strace LOG" */
+func policyFromStraceCommand(args []string) int {
+    options := config.NewPolicyFromStraceOptions()
+    usage := "policy from-strace [options] LOG\nReads a log written by 'strace -f -o LOG', use '-' for stdin"
+    if ok, code := parseCommandOptions(usage, options, args); !ok {
+        return code
+    }
+
+    input := os.Stdin
+    if fileName := options.Files[0]; fileName != "-" {
+        file, err := os.Open(fileName)
+        if err != nil {
+            return printError(err)
+        }
+        defer file.Close()
+        input = file
+    }
+
+    summary, err := policy.ParseStraceLog(input)
+    if err != nil {
+        return printError(err)
+    }
+
+    logger := newStderrLogger()
+    for _, warning := range summary.Warnings {
+        logger.Warning("%s", warning)
+    }
+
+    if options.Format == config.STRACE_FORMAT_POLICY {
+        err = summary.WritePolicy(os.Stdout, options.InferArgs)
+    } else {
+        err = summary.WriteConfig(os.Stdout)
+    }
+
+    if err != nil {
+        return printError(err)
+    }
+
+    return 0
+}
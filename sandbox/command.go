@@ -0,0 +1,240 @@
+package sandbox
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "io"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+
+    "guarddog/policy"
+)
+
+/*
+    Cmd runs a program in the sandbox with the same API as exec.Cmd,
+    so code written for os/exec needs only a different constructor:
+
+        cmd := sandbox.Command(p, "convert", "in.png", "out.jpg")
+        output, err := cmd.CombinedOutput()
+
+    Like exec.Cmd, Wait returns *exec.ExitError if the program exits
+    with non-zero code or is killed by a signal. Result has details like
+    resource usage and IsViolation.
+ */
+type Cmd struct {
+    /* program to execute, a relative path is resolved against Dir by Start */
+    Path        string
+    /* arguments including argv[0], empty means Path */
+    Args        []string
+    /* environment, nil means the environment of the current process */
+    Env         []string
+    Dir         string
+    Stdin       io.Reader
+    Stdout      io.Writer
+    Stderr      io.Writer
+
+    /* restrictions except fields above, Spec.Policy is set by Command */
+    Spec        *Spec
+
+    /* set by Start and Wait like in exec.Cmd */
+    Process     *os.Process
+    ProcessState *os.ProcessState
+    /* set by Wait */
+    Result      *Result
+
+    ctx         context.Context
+    /* error of resolving the program name returned by Start */
+    lookPathErr error
+    started     *process
+}
+
+/*
+    Returns a command running a program with a policy, nil policy
+    means no seccomp filter. A name without slashes is searched in
+    PATH like in exec.Command, other names are kept as given.
+ */
+func Command(p *policy.Policy, name string, args ...string) *Cmd {
+    return CommandContext(context.Background(), p, name, args...)
+}
+
+/* Same as Command, the program is killed when the context is done */
+func CommandContext(ctx context.Context, p *policy.Policy, name string, args ...string) *Cmd {
+    cmd := &Cmd{
+        Path: name,
+        Args: append([]string{name}, args...),
+        Spec: NewSpec(),
+        ctx: ctx,
+    }
+    cmd.Spec.Policy = p
+
+    if !strings.Contains(name, "/") {
+        cmd.Path, cmd.lookPathErr = exec.LookPath(name)
+        if cmd.lookPathErr == nil {
+            cmd.Path, cmd.lookPathErr = filepath.Abs(cmd.Path)
+        }
+    }
+
+    return cmd
+}
+
+/*
+    Returns a command for a spec made for Run. Path, Command, Env, Dir
+    and stdio of the spec are copied into fields of Cmd, which are used
+    by Start instead of the spec fields.
+ */
+func CommandFromSpec(ctx context.Context, spec *Spec) *Cmd {
+    specCopy := *spec
+    cmd := &Cmd{
+        Args: append([]string{}, spec.Command...),
+        Env: spec.Env,
+        Dir: spec.Dir,
+        Stdin: spec.Stdin,
+        Stdout: spec.Stdout,
+        Stderr: spec.Stderr,
+        Spec: &specCopy,
+        ctx: ctx,
+    }
+
+    if len(spec.Command) == 0 {
+        cmd.lookPathErr = errors.New("command is not specified")
+    } else if spec.Path != "" {
+        cmd.Path = spec.Path
+    } else {
+        cmd.Path = spec.Command[0]
+    }
+
+    return cmd
+}
+
+/* Starts the program, it is executed when Start returns without errors */
+func (c *Cmd) Start() error {
+    if c.lookPathErr != nil {
+        return c.lookPathErr
+    }
+
+    if c.started != nil {
+        return errors.New("sandbox: already started")
+    }
+
+    path := c.Path
+    if !filepath.IsAbs(path) && c.Dir != "" {
+        path = filepath.Join(c.Dir, path)
+    }
+
+    path, err := filepath.Abs(path)
+    if err != nil {
+        return err
+    }
+
+    spec := *c.Spec
+    spec.Path = path
+    spec.Command = c.Args
+    if len(spec.Command) == 0 {
+        spec.Command = []string{c.Path}
+    }
+    spec.Env = c.Env
+    spec.Dir = c.Dir
+    spec.Stdin = c.Stdin
+    spec.Stdout = c.Stdout
+    spec.Stderr = c.Stderr
+
+    started, err := start(c.ctx, &spec)
+    if err != nil {
+        return err
+    }
+
+    c.started = started
+    c.Process = started.cmd.Process
+    return nil
+}
+
+/*
+    Waits for the program started by Start. Returns *exec.ExitError if
+    the program fails or the context error if the context is done.
+ */
+func (c *Cmd) Wait() error {
+    if c.started == nil {
+        return errors.New("sandbox: not started")
+    }
+
+    if c.Result != nil {
+        return errors.New("sandbox: Wait was already called")
+    }
+
+    result, err := c.started.wait(c.ctx)
+    c.Result = result
+    c.ProcessState = c.started.cmd.ProcessState
+
+    if err != nil {
+        return err
+    }
+
+    if !c.ProcessState.Success() {
+        return &exec.ExitError{ProcessState: c.ProcessState}
+    }
+
+    return nil
+}
+
+/* Starts the program and waits for it */
+func (c *Cmd) Run() error {
+    if err := c.Start(); err != nil {
+        return err
+    }
+    return c.Wait()
+}
+
+/*
+    Runs the program and returns its standard output. If Stderr
+    is nil, the error output is saved in exec.ExitError.Stderr.
+ */
+func (c *Cmd) Output() ([]byte, error) {
+    if c.Stdout != nil {
+        return nil, errors.New("sandbox: Stdout already set")
+    }
+
+    var stdout, stderr bytes.Buffer
+    c.Stdout = &stdout
+
+    captureErr := c.Stderr == nil
+    if captureErr {
+        c.Stderr = &stderr
+    }
+
+    err := c.Run()
+    if exitErr, ok := err.(*exec.ExitError); ok && captureErr {
+        exitErr.Stderr = stderr.Bytes()
+    }
+
+    return stdout.Bytes(), err
+}
+
+/* Runs the program and returns its standard output and error output together */
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+    if c.Stdout != nil {
+        return nil, errors.New("sandbox: Stdout already set")
+    }
+
+    if c.Stderr != nil {
+        return nil, errors.New("sandbox: Stderr already set")
+    }
+
+    var output bytes.Buffer
+    c.Stdout = &output
+    c.Stderr = &output
+
+    err := c.Run()
+    return output.Bytes(), err
+}
+
+/* Returns a command line for debugging like exec.Cmd.String */
+func (c *Cmd) String() string {
+    command := []string{c.Path}
+    if len(c.Args) > 1 {
+        command = append(command, c.Args[1:]...)
+    }
+    return strings.Join(command, " ")
+}
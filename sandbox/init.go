@@ -0,0 +1,149 @@
+package sandbox
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "syscall"
+
+    "guarddog/policy"
+    "guarddog/seccomphelper"
+    "guarddog/util"
+)
+
+/* argv[0] of the current binary executed by Run to start a program */
+const initArg0 = "guarddog-sandbox-init"
+
+/* File descriptors passed to the child by Run */
+const (
+    specFd = 3
+    errorFd = 4
+    logFd = 5
+)
+
+/* Exit code of the child if the program cannot be executed */
+const initFailedExitCode = 127
+
+/* Spec with a resolved policy, passed to the child as JSON */
+type initRequest struct {
+    Path        string
+    Command     []string
+    Env         []string
+    Dir         string
+    AllowAnySyscalls bool
+    Rules       []seccomphelper.ResolvedRule
+    DefaultAction policy.Action
+    Limits      []policy.Rlimit
+    ChrootPath  string
+    Uid         int
+    Gid         int
+    AllowRoot   bool
+    Verbose     bool
+    HasLog      bool
+    ParentPid   int
+}
+
+/*
+    Must be called at the start of main by programs that use Run.
+    In a process started by Run it applies restrictions and executes
+    the program, so it never returns there. Otherwise it does nothing.
+ */
+func Init() {
+    if len(os.Args) == 0 || os.Args[0] != initArg0 {
+        return
+    }
+
+    err := initAndExecute()
+
+    // The pipe is closed on successful exec, so the parent sees no error
+    errorPipe := os.NewFile(errorFd, "error pipe")
+    fmt.Fprintf(errorPipe, "%s", err)
+    os.Exit(initFailedExitCode)
+}
+
+/* Applies restrictions in order that keeps needed syscalls available */
+func initAndExecute() error {
+    syscall.CloseOnExec(errorFd)
+
+    request, err := readInitRequest()
+    if err != nil {
+        return err
+    }
+
+    loggerFd := -1
+    if request.HasLog {
+        syscall.CloseOnExec(logFd)
+        loggerFd = logFd
+    }
+
+    limits, err := resolveLimits(request.Limits)
+    if err != nil {
+        return err
+    }
+
+    // Limits are set right before exec, but only root can raise them
+    if err := util.RaiseHardRlimits(request.Limits); err != nil {
+        return err
+    }
+
+    if request.ChrootPath != "" {
+        if err := util.ChrootInto(request.ChrootPath); err != nil {
+            return fmt.Errorf("cannot chroot into '%s': %s", request.ChrootPath, err)
+        }
+    }
+
+    if request.Dir != "" {
+        if err := os.Chdir(request.Dir); err != nil {
+            return err
+        }
+    }
+
+    if err := util.ChangeUids(request.Uid, request.Gid, request.AllowRoot); err != nil {
+        return err
+    }
+
+    // Changing ids resets the signal set by Run
+    if err := util.SetParentDeathSignal(); err != nil {
+        return fmt.Errorf("failed to set PR_SET_PDEATHSIG signal: %s", err)
+    }
+    if os.Getppid() != request.ParentPid {
+        return fmt.Errorf("parent process %d has exited", request.ParentPid)
+    }
+
+    return seccomphelper.ExecuteWithSeccomp(&seccomphelper.ExecuteOptions{
+        Verbose: request.Verbose,
+        LoggerFd: loggerFd,
+        LoggerTag: "guarddog",
+        AllowAnySyscalls: request.AllowAnySyscalls,
+        Rules: request.Rules,
+        DefaultAction: request.DefaultAction,
+        Limits: limits,
+        Path: request.Path,
+        Command: request.Command,
+        Env: request.Env,
+    })
+}
+
+func resolveLimits(limits []policy.Rlimit) ([]seccomphelper.ResourceLimit, error) {
+    var result []seccomphelper.ResourceLimit
+    for _, limit := range limits {
+        resource, err := util.RlimitResource(limit.Resource)
+        if err != nil {
+            return nil, err
+        }
+        result = append(result, seccomphelper.ResourceLimit{Resource: resource, Value: limit.Value})
+    }
+    return result, nil
+}
+
+func readInitRequest() (*initRequest, error) {
+    file := os.NewFile(specFd, "spec pipe")
+    defer file.Close()
+
+    request := new(initRequest)
+    if err := json.NewDecoder(file).Decode(request); err != nil {
+        return nil, fmt.Errorf("cannot read sandbox spec: %s", err)
+    }
+
+    return request, nil
+}
@@ -0,0 +1,321 @@
+/*
+    Package sandbox runs programs with a seccomp filter, resource limits,
+    chroot and changed user and group ids.
+
+    A program is started by executing the current binary again, so
+    programs using this package must call Init at the start of main:
+
+        func main() {
+            sandbox.Init()
+            ...
+            result, err := sandbox.Run(ctx, spec)
+        }
+ */
+package sandbox
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "time"
+
+    "guarddog/policy"
+    "guarddog/seccomphelper"
+)
+
+/* Keeps user or group id of the current process */
+const USE_DEFAULT_ID = -1
+
+/* Describes a program to run and restrictions applied to it */
+type Spec struct {
+    /* absolute path to a program and its arguments, PATH is not searched */
+    Command     []string
+    /* absolute path to the program if Command[0] is only its argv[0] */
+    Path        string
+    /* environment as NAME=value strings, nil means the environment of the current process */
+    Env         []string
+    /* working directory inside the chroot, empty means the current directory or / with chroot */
+    Dir         string
+
+    /* policy resolved for the native arch, nil means no seccomp filter */
+    Policy      *policy.Policy
+    /* skip syscalls that do not exist on the native arch instead of failing */
+    IgnoreUnknownSyscalls bool
+    /*
+        set right before the program is executed; CPU time used by
+        the sandbox setup before exec counts towards the cpu limit
+     */
+    Limits      []policy.Rlimit
+
+    ChrootPath  string
+    /* ids to switch to, USE_DEFAULT_ID keeps ids of the current process */
+    Uid         int
+    Gid         int
+    /* allow running the program with uid 0 */
+    AllowRoot   bool
+
+    /* same as in exec.Cmd, nil means /dev/null */
+    Stdin       io.Reader
+    Stdout      io.Writer
+    Stderr      io.Writer
+
+    /* receives debug messages written before the program is executed */
+    LogFile     *os.File
+    Verbose     bool
+}
+
+/* Returns a spec for a program that keeps user and group ids */
+func NewSpec(command ...string) *Spec {
+    spec := new(Spec)
+    spec.Command = command
+    spec.Uid = USE_DEFAULT_ID
+    spec.Gid = USE_DEFAULT_ID
+    return spec
+}
+
+/* How a program finished */
+type Result struct {
+    /* exit status, -1 if the program was killed by a signal */
+    ExitCode    int
+    /* signal that killed the program, 0 if it exited */
+    Signal      syscall.Signal
+    WallTime    time.Duration
+    /* CPU time, including the sandbox setup before the program is executed */
+    UserTime    time.Duration
+    SystemTime  time.Duration
+    /* peak resident set size in bytes, at least the size of the sandbox setup */
+    MaxRss      int64
+}
+
+/*
+    Returns true if the program was killed for making a forbidden
+    syscall: seccomp kills programs with SIGSYS and the trap action
+    sends SIGSYS that terminates programs without a handler
+ */
+func (r *Result) IsViolation() bool {
+    return r.Signal == syscall.SIGSYS
+}
+
+/* Returns exit code like a shell does: 128 + signal number for killed programs */
+func (r *Result) ExitStatus() int {
+    if r.Signal != 0 {
+        return 128 + int(r.Signal)
+    }
+    return r.ExitCode
+}
+
+/*
+    Runs a program and waits for it. A program that exits with non-zero
+    code or is killed by a signal is not an error, see Result. If the
+    context is done before the program exits, the program is killed and
+    Run returns its result along with the context error.
+ */
+func Run(ctx context.Context, spec *Spec) (*Result, error) {
+    p, err := start(ctx, spec)
+    if err != nil {
+        return nil, err
+    }
+
+    return p.wait(ctx)
+}
+
+/* Program started in the sandbox */
+type process struct {
+    cmd         *exec.Cmd
+    startTime   time.Time
+}
+
+/*
+    Starts a program, returns after it is executed or failed to execute.
+    If the context is done before that, the child is killed.
+ */
+func start(ctx context.Context, spec *Spec) (*process, error) {
+    request, err := newInitRequest(spec)
+    if err != nil {
+        return nil, err
+    }
+
+    payload, err := json.Marshal(request)
+    if err != nil {
+        return nil, err
+    }
+
+    // The spec is passed as fd 3, the child reports errors into fd 4
+    specReader, specWriter, err := os.Pipe()
+    if err != nil {
+        return nil, err
+    }
+    defer specReader.Close()
+    defer specWriter.Close()
+
+    errorReader, errorWriter, err := os.Pipe()
+    if err != nil {
+        return nil, err
+    }
+    defer errorReader.Close()
+    defer errorWriter.Close()
+
+    cmd := &exec.Cmd{
+        Path: "/proc/self/exe",
+        Args: []string{initArg0},
+        Env: []string{},
+        Stdin: spec.Stdin,
+        Stdout: spec.Stdout,
+        Stderr: spec.Stderr,
+        ExtraFiles: []*os.File{specReader, errorWriter},
+        SysProcAttr: &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL},
+    }
+
+    if spec.LogFile != nil {
+        cmd.ExtraFiles = append(cmd.ExtraFiles, spec.LogFile)
+    }
+
+    startTime := time.Now()
+    if err := cmd.Start(); err != nil {
+        return nil, fmt.Errorf("cannot start sandbox: %s", err)
+    }
+
+    specReader.Close()
+    errorWriter.Close()
+
+    // The child may fail before reading the spec, the error is read below
+    _, _ = specWriter.Write(payload)
+    specWriter.Close()
+
+    // The child can hang before exec, e.g. in chroot on a network file system
+    readDone := make(chan struct{})
+    killed := make(chan bool, 1)
+    go func() {
+        select {
+        case <-readDone:
+            killed <- false
+        case <-ctx.Done():
+            cmd.Process.Kill()
+            killed <- true
+        }
+    }()
+
+    // Reading ends when the program is executed and the pipe is closed
+    childError, _ := ioutil.ReadAll(errorReader)
+    close(readDone)
+    if <-killed {
+        cmd.Wait()
+        return nil, ctx.Err()
+    }
+
+    if len(childError) > 0 {
+        cmd.Wait()
+        return nil, errors.New(string(childError))
+    }
+
+    return &process{cmd, startTime}, nil
+}
+
+/* Waits for a program, kills it if the context is done before it exits */
+func (p *process) wait(ctx context.Context) (*Result, error) {
+    done := make(chan error, 1)
+    go func() {
+        done <- p.cmd.Wait()
+    }()
+
+    var err, ctxErr error
+    select {
+    case err = <-done:
+    case <-ctx.Done():
+        ctxErr = ctx.Err()
+        p.cmd.Process.Kill()
+        err = <-done
+    }
+
+    result := newResult(p.cmd.ProcessState, time.Since(p.startTime))
+    if result == nil {
+        return nil, err
+    }
+
+    return result, ctxErr
+}
+
+func newResult(state *os.ProcessState, wallTime time.Duration) *Result {
+    if state == nil {
+        return nil
+    }
+
+    result := &Result{ExitCode: state.ExitCode(), WallTime: wallTime}
+
+    if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+        result.Signal = status.Signal()
+    }
+
+    if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+        result.UserTime = time.Duration(usage.Utime.Nano())
+        result.SystemTime = time.Duration(usage.Stime.Nano())
+        // ru_maxrss is in kilobytes
+        result.MaxRss = usage.Maxrss * 1024
+    }
+
+    return result
+}
+
+/* Checks a spec and resolves its policy into a request for the child */
+func newInitRequest(spec *Spec) (*initRequest, error) {
+    if len(spec.Command) == 0 {
+        return nil, errors.New("command is not specified")
+    }
+
+    path := spec.Path
+    if path == "" {
+        path = spec.Command[0]
+    }
+
+    if !filepath.IsAbs(path) {
+        return nil, fmt.Errorf("command must be an absolute path, got '%s'", path)
+    }
+
+    if spec.Uid == 0 && !spec.AllowRoot {
+        return nil, errors.New("to run program with uid = 0 you need to allow root")
+    }
+
+    request := &initRequest{
+        Path: path,
+        Command: spec.Command,
+        Env: spec.Env,
+        Dir: spec.Dir,
+        Limits: spec.Limits,
+        ChrootPath: spec.ChrootPath,
+        Uid: spec.Uid,
+        Gid: spec.Gid,
+        AllowRoot: spec.AllowRoot,
+        Verbose: spec.Verbose,
+        HasLog: spec.LogFile != nil,
+        ParentPid: os.Getpid(),
+        AllowAnySyscalls: spec.Policy == nil,
+    }
+
+    if request.Env == nil {
+        request.Env = os.Environ()
+    }
+
+    if spec.Policy != nil {
+        rules, unknown, err := seccomphelper.ResolvePolicy(spec.Policy)
+        if err != nil {
+            return nil, err
+        }
+
+        if len(unknown) > 0 && !spec.IgnoreUnknownSyscalls {
+            return nil, fmt.Errorf("syscalls do not exist on this arch: %s", strings.Join(unknown, ", "))
+        }
+
+        request.Rules = rules
+        request.DefaultAction = spec.Policy.DefaultAction
+    }
+
+    return request, nil
+}
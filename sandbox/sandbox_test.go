@@ -0,0 +1,238 @@
+package sandbox
+
+import (
+    "bytes"
+    "context"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+
+    "guarddog/policy"
+)
+
+func TestMain(m *testing.M) {
+    // Run starts programs by executing the test binary
+    Init()
+    os.Exit(m.Run())
+}
+
+func newTestSpec(command ...string) *Spec {
+    spec := NewSpec(command...)
+    spec.AllowRoot = true
+    return spec
+}
+
+func TestRunExitCodeAndOutput(t *testing.T) {
+    var stdout bytes.Buffer
+    spec := newTestSpec("/bin/sh", "-c", "read line; echo $line $GREETING; exit 3")
+    spec.Env = []string{"GREETING=world"}
+    spec.Stdin = strings.NewReader("hello\n")
+    spec.Stdout = &stdout
+
+    result, err := Run(context.Background(), spec)
+    if err != nil {
+        t.Fatalf("Run returned error %s", err)
+    }
+
+    if result.ExitCode != 3 || result.Signal != 0 || result.ExitStatus() != 3 {
+        t.Errorf("unexpected result %+v", result)
+    }
+
+    if stdout.String() != "hello world\n" {
+        t.Errorf("unexpected output %q", stdout.String())
+    }
+}
+
+func TestRunWithPolicy(t *testing.T) {
+    spec := newTestSpec("/bin/uname")
+    spec.Policy = policy.New(policy.Allow)
+    spec.Policy.AddRule(policy.Rule{Syscall: "uname", Action: policy.Kill})
+
+    result, err := Run(context.Background(), spec)
+    if err != nil {
+        t.Fatalf("Run returned error %s", err)
+    }
+
+    if result.Signal != syscall.SIGSYS || result.ExitCode != -1 {
+        t.Errorf("expected program to be killed with SIGSYS, got %+v", result)
+    }
+}
+
+func TestRunCancel(t *testing.T) {
+    ctx, cancel := context.WithTimeout(context.Background(), 100 * time.Millisecond)
+    defer cancel()
+
+    result, err := Run(ctx, newTestSpec("/bin/sleep", "10"))
+    if err != context.DeadlineExceeded {
+        t.Fatalf("expected deadline error, got %v", err)
+    }
+
+    if result == nil || result.Signal != syscall.SIGKILL || result.WallTime > 5 * time.Second {
+        t.Errorf("unexpected result %+v", result)
+    }
+
+    // The child is killed before exec or right after it
+    ctx, cancel = context.WithCancel(context.Background())
+    cancel()
+    if _, err := Run(ctx, newTestSpec("/bin/sleep", "10")); err != context.Canceled {
+        t.Errorf("expected canceled error, got %v", err)
+    }
+}
+
+func TestRunLimits(t *testing.T) {
+    var stdout bytes.Buffer
+    spec := newTestSpec("/bin/sh", "-c", "ulimit -n; ulimit -Hn")
+    spec.Limits = []policy.Rlimit{{Resource: "nofile", Value: 32}}
+    spec.Stdout = &stdout
+
+    if _, err := Run(context.Background(), spec); err != nil {
+        t.Fatalf("Run returned error %s", err)
+    }
+
+    if stdout.String() != "32\n32\n" {
+        t.Errorf("expected soft and hard limits to be set, got %q", stdout.String())
+    }
+}
+
+func TestRunErrors(t *testing.T) {
+    for _, spec := range []*Spec{
+            NewSpec(),
+            newTestSpec("sh"),
+            newTestSpec("/nonexistent/program"),
+            &Spec{Command: []string{"/bin/true"}}} {
+        if _, err := Run(context.Background(), spec); err == nil {
+            t.Errorf("expected error for %v", spec.Command)
+        }
+    }
+
+    spec := newTestSpec("/bin/true")
+    spec.ChrootPath = "/nonexistent/chroot"
+    _, err := Run(context.Background(), spec)
+    if err == nil || !strings.Contains(err.Error(), "cannot chroot") {
+        t.Errorf("expected chroot error, got %v", err)
+    }
+}
+
+func TestCommand(t *testing.T) {
+    cmd := Command(nil, "sh", "-c", "echo out; echo err >&2; exit 2")
+    cmd.Spec.AllowRoot = true
+
+    output, err := cmd.CombinedOutput()
+    if _, ok := err.(*exec.ExitError); !ok {
+        t.Fatalf("expected exec.ExitError, got %v", err)
+    }
+
+    if cmd.Result == nil {
+        t.Fatalf("expected result to be set by Wait")
+    }
+
+    if string(output) != "out\nerr\n" || cmd.Result.ExitCode != 2 || cmd.ProcessState.ExitCode() != 2 {
+        t.Errorf("unexpected output %q and result %+v", output, cmd.Result)
+    }
+
+    p := policy.New(policy.Allow)
+    p.AddRule(policy.Rule{Syscall: "uname", Action: policy.Kill})
+    cmd = Command(p, "/bin/uname")
+    cmd.Spec.AllowRoot = true
+
+    if _, err := cmd.Output(); cmd.Result == nil {
+        t.Fatalf("expected result to be set by Wait, got error %v", err)
+    } else if err == nil || !cmd.Result.IsViolation() {
+        t.Errorf("expected violation, got %v and %+v", err, cmd.Result)
+    }
+
+    cmd = Command(nil, "/bin/echo", "hello")
+    cmd.Spec.AllowRoot = true
+    cmd.Env = []string{}
+    output, err = cmd.Output()
+    if err != nil || string(output) != "hello\n" {
+        t.Errorf("unexpected output %q, error %v", output, err)
+    }
+
+    if err := Command(nil, "no-such-program-in-path").Run(); err == nil {
+        t.Errorf("expected error for unknown program")
+    }
+}
+
+func TestCommandArgs(t *testing.T) {
+    cmd := Command(nil, "/bin/cat", "/proc/self/cmdline")
+    cmd.Spec.AllowRoot = true
+    cmd.Args[0] = "renamed"
+    output, err := cmd.Output()
+    if err != nil || string(output) != "renamed\x00/proc/self/cmdline\x00" {
+        t.Errorf("expected argv[0] to be kept, got %q and error %v", output, err)
+    }
+
+    cmd = Command(nil, "./echo", "hello")
+    cmd.Spec.AllowRoot = true
+    cmd.Dir = "/bin"
+    output, err = cmd.Output()
+    if err != nil || string(output) != "hello\n" {
+        t.Errorf("expected relative path to be resolved against Dir, got %q and error %v", output, err)
+    }
+
+    cmd = Command(nil, "/bin/true")
+    cmd.Spec.AllowRoot = true
+    cmd.Args = nil
+    if err := cmd.Run(); err != nil || cmd.String() != "/bin/true" {
+        t.Errorf("expected program without arguments to run, got %v", err)
+    }
+}
+
+func TestUidPool(t *testing.T) {
+    if os.Getuid() != 0 {
+        t.Skip("changing uids requires root")
+    }
+
+    dir, err := ioutil.TempDir("", "guarddog-uid-pool")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    pool := NewUidPool(30000, 30001, dir)
+    first, err := pool.Acquire()
+    if err != nil {
+        t.Fatalf("failed to acquire an id: %s", err)
+    }
+
+    second, err := pool.Acquire()
+    if err != nil || second.Id == first.Id {
+        t.Fatalf("expected another id, got %v, error %v", second, err)
+    }
+
+    if _, err := pool.Acquire(); err == nil {
+        t.Fatalf("expected an error for an exhausted pool")
+    }
+
+    // A process left in background must be killed on release
+    spec := NewSpec("/bin/sh", "-c", "/bin/sleep 100 &")
+    spec.Uid = first.Id
+    spec.Gid = first.Id
+    if _, err := Run(context.Background(), spec); err != nil {
+        t.Fatalf("failed to run: %s", err)
+    }
+
+    if pids, _ := processesOfUid(first.Id); len(pids) == 0 {
+        t.Fatalf("expected a process left with uid %d", first.Id)
+    }
+
+    if err := first.Release(); err != nil {
+        t.Fatalf("failed to release: %s", err)
+    }
+
+    if pids, _ := processesOfUid(first.Id); len(pids) != 0 {
+        t.Errorf("processes %v were not killed", pids)
+    }
+
+    again, err := pool.Acquire()
+    if err != nil || again.Id != first.Id {
+        t.Errorf("expected to get released id %d again, got %v, error %v", first.Id, again, err)
+    }
+    again.Release()
+    second.Release()
+}
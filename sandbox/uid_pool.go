@@ -0,0 +1,173 @@
+package sandbox
+
+import (
+    "bufio"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "syscall"
+    "time"
+)
+
+/*
+    UidPool gives every sandbox its own uid and gid, so programs
+    running at the same time cannot signal or ptrace each other.
+    An id is reserved with an flock(2) lock on a file in Dir, so the
+    pool is shared by all guarddog processes using the same Dir, and
+    the lock is released by the kernel even if guarddog is killed.
+ */
+type UidPool struct {
+    Min         int
+    Max         int
+    /* directory for lock files, created if it does not exist */
+    Dir         string
+}
+
+/* Reserved id, used both as uid and gid */
+type UidLease struct {
+    Id          int
+    file        *os.File
+}
+
+func NewUidPool(min int, max int, dir string) *UidPool {
+    return &UidPool{Min: min, Max: max, Dir: dir}
+}
+
+/*
+    Reserves a free id. Processes left with this id by a guarddog
+    that was killed before releasing it are killed.
+ */
+func (pool *UidPool) Acquire() (*UidLease, error) {
+    if err := os.MkdirAll(pool.Dir, 0755); err != nil {
+        return nil, fmt.Errorf("cannot create runtime dir: %s", err)
+    }
+
+    for id := pool.Min; id <= pool.Max; id++ {
+        name := filepath.Join(pool.Dir, fmt.Sprintf("uid-%d.lock", id))
+        file, err := os.OpenFile(name, os.O_RDWR | os.O_CREATE, 0644)
+        if err != nil {
+            return nil, fmt.Errorf("cannot create lock file: %s", err)
+        }
+
+        err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX | syscall.LOCK_NB)
+        if err == syscall.EWOULDBLOCK {
+            file.Close()
+            continue
+        }
+        if err != nil {
+            file.Close()
+            return nil, fmt.Errorf("cannot lock %s: %s", name, err)
+        }
+
+        if err := KillProcessesOfUid(id); err != nil {
+            file.Close()
+            return nil, err
+        }
+
+        return &UidLease{Id: id, file: file}, nil
+    }
+
+    return nil, fmt.Errorf("all ids from %d to %d are in use", pool.Min, pool.Max)
+}
+
+/* Kills processes left with the id and makes the id free */
+func (lease *UidLease) Release() error {
+    err := KillProcessesOfUid(lease.Id)
+
+    // Closing the file releases the lock, the file is kept so the lock is not raced
+    lease.file.Close()
+    return err
+}
+
+/* Attempts to kill processes that keep appearing, e.g. after fork */
+const maxKillRounds = 20
+
+/*
+    Sends SIGKILL to all processes with given real, effective or
+    saved uid and repeats it until there are none, because they
+    might fork while being killed
+ */
+func KillProcessesOfUid(uid int) error {
+    for round := 0; round < maxKillRounds; round++ {
+        pids, err := processesOfUid(uid)
+        if err != nil {
+            return err
+        }
+
+        if len(pids) == 0 {
+            return nil
+        }
+
+        for _, pid := range pids {
+            // The process might have exited already
+            syscall.Kill(pid, syscall.SIGKILL)
+        }
+
+        time.Sleep(time.Millisecond * time.Duration(round + 1))
+    }
+
+    return fmt.Errorf("cannot kill processes of uid %d", uid)
+}
+
+/* Returns pids of live processes with given uid, zombies are skipped */
+func processesOfUid(uid int) ([]int, error) {
+    entries, err := ioutil.ReadDir("/proc")
+    if err != nil {
+        return nil, err
+    }
+
+    var pids []int
+    for _, entry := range entries {
+        pid, err := strconv.Atoi(entry.Name())
+        if err != nil {
+            continue
+        }
+
+        uids, state, err := readProcessStatus(pid)
+        if err != nil || state == "Z" {
+            continue
+        }
+
+        for _, processUid := range uids {
+            if processUid == uid {
+                pids = append(pids, pid)
+                break
+            }
+        }
+    }
+
+    return pids, nil
+}
+
+/* Reads uids and a state letter of a process from /proc/PID/status */
+func readProcessStatus(pid int) (uids []int, state string, err error) {
+    file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+    if err != nil {
+        return nil, "", err
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) < 2 {
+            continue
+        }
+
+        switch fields[0] {
+        case "State:":
+            state = fields[1]
+        case "Uid:":
+            for _, field := range fields[1:] {
+                if value, err := strconv.Atoi(field); err == nil {
+                    uids = append(uids, value)
+                }
+            }
+        }
+    }
+
+    return uids, state, scanner.Err()
+}
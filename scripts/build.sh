@@ -2,4 +2,4 @@
 
 set -e 
 cd "`dirname $0`/.."
-exec ./scripts/go.sh build "$@" guarddog.go
+exec ./scripts/go.sh build "$@" -o guarddog .
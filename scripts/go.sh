@@ -7,4 +7,6 @@ if [ -z ${GOPATH+x} ]
 then
     export GOPATH="`realpath "$dir/../../../"`"
 fi
+# There is no go.mod, the code is built in GOPATH mode
+export GO111MODULE=off
 exec go "$@"
\ No newline at end of file
@@ -11,13 +11,14 @@ echo "Running go vet"
 ./scripts/go.sh vet ./... || true
 
 echo "Running Go unit tests"
-./scripts/go.sh test "$@" ./config ./seccomphelper ./util
+./scripts/go.sh test "$@" . ./config ./judge ./policy ./sandbox ./seccomphelper ./server ./util
 
 echo "Building"
 # Disable optimizations for easier debugging
 ./scripts/build.sh -v -ccflags="-N" -gcflags="-N -l"
 
 echo "Running functional tests"
+./scripts/test-profiles.sh ./guarddog
 ./scripts/test-sandbox.sh ./guarddog
 code=$?
 echo "Exited with code $code"
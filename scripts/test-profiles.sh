@@ -0,0 +1,108 @@
+#!/bin/bash
+
+# Runs hello world programs for every built-in profile. 
+# Runtimes that are not installed on the host are skipped.
+
+BINARY="$1"
+[ ! -f "$BINARY" ] && { echo "Fail: path to tested binary not given"; exit 1; } 
+BINARY="`realpath "$BINARY"`"
+
+TMP_DIR="`mktemp -d /tmp/guarddog-profiles.XXXXXX`"
+trap 'rm -rf "$TMP_DIR"' EXIT
+
+failed=0
+
+# Usage: run_profile profile expected_output command [args]
+function run_profile() {
+    local profile="$1"
+    local expected="$2"
+    shift 2
+
+    echo 
+    echo "Test: profile $profile runs $1"
+    local output
+    output=`"$BINARY" -default-action=trap -profile="$profile" -- "$@"`
+    local code=$?
+
+    if [ "$code" -ne 0 ] || [ "$output" != "$expected" ]
+    then 
+        echo "Test failed, exit code $code, output:"
+        echo "$output"
+        failed=1
+        return
+    fi
+
+    echo "OK"
+}
+
+function skip_profile() {
+    echo 
+    echo "Skipping profile $1: $2"
+}
+
+cat > "$TMP_DIR/hello.c" <<'CODE'
+#include <stdio.h>
+int main() { printf("hello\n"); return 0; }
+CODE
+
+if ! which gcc > /dev/null
+then
+    skip_profile static-c "gcc not found"
+    skip_profile dynamic-c "gcc not found"
+else
+    if gcc -static -o "$TMP_DIR/hello-static" "$TMP_DIR/hello.c" 2> /dev/null
+    then 
+        run_profile static-c hello "$TMP_DIR/hello-static"
+    else
+        skip_profile static-c "static libc is not installed"
+    fi
+
+    gcc -o "$TMP_DIR/hello-dynamic" "$TMP_DIR/hello.c"
+    run_profile dynamic-c hello "$TMP_DIR/hello-dynamic"
+fi
+
+# Find a real binary, not a wrapper script like pyenv shim
+PYTHON="`python3 -c 'import sys; print(sys.executable)' 2> /dev/null`"
+if [ -n "$PYTHON" ]
+then
+    run_profile python3 hello "$PYTHON" -c 'print("hello")'
+else
+    skip_profile python3 "python3 not found"
+fi
+
+cat > "$TMP_DIR/hello.go" <<'CODE'
+package main
+import "fmt"
+func main() { fmt.Println("hello") }
+CODE
+
+if which go > /dev/null && GO111MODULE=off go build -o "$TMP_DIR/hello-go" "$TMP_DIR/hello.go"
+then 
+    run_profile go hello "$TMP_DIR/hello-go"
+else
+    skip_profile go "go not found"
+fi
+
+cat > "$TMP_DIR/Hello.java" <<'CODE'
+public class Hello {
+    public static void main(String[] args) { System.out.println("hello"); }
+}
+CODE
+
+JAVA="`which java 2> /dev/null`"
+if [ -n "$JAVA" ] && which javac > /dev/null && javac -d "$TMP_DIR" "$TMP_DIR/Hello.java"
+then 
+    run_profile jvm hello "`realpath "$JAVA"`" -cp "$TMP_DIR" Hello
+else
+    skip_profile jvm "java or javac not found"
+fi
+
+echo
+if [ "$failed" -ne 0 ]
+then
+    echo "Profile tests failed"
+    exit 1
+fi
+
+echo "Profile tests finished OK"
+exit 0
@@ -90,13 +90,13 @@ expect_string "yes" "$output"
 
 echo 
 echo "Test: whether echo works with write allowed"
-command1="$BINARY $FLAGS -verbose -trap ${allowed_options[@]} -allow=write -- /bin/echo yes"
+command1="$BINARY $FLAGS -verbose -default-action=trap ${allowed_options[@]} -allow=write -- /bin/echo yes"
 run_command zero $command1
 expect_string "yes" "$output"
 
 echo 
 echo "Test: whether echo fails if write is not allowed"
-command2="$BINARY $FLAGS -trap ${allowed_options[@]} -- /bin/echo no"
+command2="$BINARY $FLAGS -default-action=trap ${allowed_options[@]} -- /bin/echo no"
 run_command nonzero $command2
 expect_string "" "$output"
 
@@ -0,0 +1,271 @@
+package seccomphelper
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "guarddog/policy"
+)
+
+/* Largest errno value that a seccomp filter can return */
+const MAX_ERRNO = 4095
+
+/* Maximum number of conditions in a rule, same as in seccomp_execute.h */
+const MAX_CONDITIONS = policy.MAX_ARGS
+
+/*
+    PolicyBuilder creates a policy in code:
+
+        builder := NewPolicy().
+            Default(policy.Kill).
+            Group("@memory").
+            Allow("read", "write", "exit_group").
+            AllowIf("socket", Arg(0).Eq(syscall.AF_UNIX)).
+            Errno("ptrace", policy.EPERM)
+
+        filter, err := builder.Filter()
+        document, err := builder.Document()
+
+    Rules are applied in the order they are added, so a later rule
+    for the same syscall overrides an earlier one. Mistakes like unknown
+    groups or syscalls are collected and returned by Build, Filter and
+    Document.
+ */
+type PolicyBuilder struct {
+    policy      *policy.Policy
+    /* archs to check syscall names for, empty means the native arch */
+    archs       []string
+    errs        []error
+}
+
+/* Returns a builder of a policy that kills a program on any syscall */
+func NewPolicy() *PolicyBuilder {
+    return &PolicyBuilder{policy: policy.New(policy.Kill)}
+}
+
+/* Sets an action for syscalls without rules */
+func (b *PolicyBuilder) Default(action policy.Action) *PolicyBuilder {
+    b.policy.DefaultAction = action
+    return b
+}
+
+/*
+    Sets archs like "amd64" or "arm64" whose syscall names are checked,
+    so one policy can be used on several archs. Names are the same as
+    in ParseArch.
+ */
+func (b *PolicyBuilder) Arch(names ...string) *PolicyBuilder {
+    for _, name := range names {
+        if _, err := ParseArch(name); err != nil {
+            b.errs = append(b.errs, err)
+            continue
+        }
+        b.archs = append(b.archs, name)
+    }
+    return b
+}
+
+/* Allows syscalls or groups like "@memory" without conditions */
+func (b *PolicyBuilder) Allow(names ...string) *PolicyBuilder {
+    for _, name := range names {
+        b.Rule(name, policy.Allow)
+    }
+    return b
+}
+
+/* Allows all syscalls of a group, the name must start with '@' */
+func (b *PolicyBuilder) Group(name string) *PolicyBuilder {
+    if !policy.IsGroupName(name) {
+        b.errs = append(b.errs, fmt.Errorf("group name '%s' must start with '@'", name))
+        return b
+    }
+    return b.Rule(name, policy.Allow)
+}
+
+/* Allows a syscall if all conditions are true */
+func (b *PolicyBuilder) AllowIf(name string, conditions ...policy.Condition) *PolicyBuilder {
+    if len(conditions) == 0 {
+        b.errs = append(b.errs, fmt.Errorf("AllowIf for syscall %s needs at least one condition", name))
+        return b
+    }
+    return b.Rule(name, policy.Allow, conditions...)
+}
+
+/* Makes syscalls fail with given errno, e.g. policy.EPERM */
+func (b *PolicyBuilder) Errno(name string, errno int) *PolicyBuilder {
+    if errno <= 0 || errno > MAX_ERRNO {
+        b.errs = append(b.errs, fmt.Errorf("errno %d for syscall %s is out of range 1-%d",
+            errno, name, MAX_ERRNO))
+        return b
+    }
+    return b.Rule(name, policy.Errno(errno))
+}
+
+/* Sends SIGSYS to a program making given syscalls */
+func (b *PolicyBuilder) Trap(names ...string) *PolicyBuilder {
+    for _, name := range names {
+        b.Rule(name, policy.Trap)
+    }
+    return b
+}
+
+/* Kills a program making given syscalls */
+func (b *PolicyBuilder) Kill(names ...string) *PolicyBuilder {
+    for _, name := range names {
+        b.Rule(name, policy.Kill)
+    }
+    return b
+}
+
+/* Adds a rule with any action, conditions are combined with AND */
+func (b *PolicyBuilder) Rule(name string, action policy.Action, conditions ...policy.Condition) *PolicyBuilder {
+    rule := policy.Rule{Syscall: name, Action: action, Conditions: conditions}
+
+    if len(conditions) > MAX_CONDITIONS {
+        b.errs = append(b.errs, fmt.Errorf("rule '%s' has more than %d conditions", rule, MAX_CONDITIONS))
+        return b
+    }
+
+    if policy.IsGroupName(name) {
+        if _, err := policy.LookupGroup(name); err != nil {
+            b.errs = append(b.errs, err)
+            return b
+        }
+    }
+
+    for _, condition := range conditions {
+        if err := condition.Validate(); err != nil {
+            b.errs = append(b.errs, fmt.Errorf("invalid rule '%s': %s", rule, err))
+            return b
+        }
+    }
+
+    b.policy.AddRule(rule)
+    return b
+}
+
+/* Sets a resource limit like "nofile", see policy.RlimitNames */
+func (b *PolicyBuilder) Rlimit(resource string, value uint64) *PolicyBuilder {
+    if !containsName(policy.RlimitNames, resource) {
+        b.errs = append(b.errs, fmt.Errorf("unknown resource '%s', expected one of: %s",
+            resource, strings.Join(policy.RlimitNames, ", ")))
+        return b
+    }
+
+    b.policy.SetRlimit(resource, value)
+    return b
+}
+
+/* Returns a copy of the policy after checking it for every arch */
+func (b *PolicyBuilder) Build() (*policy.Policy, error) {
+    errs := append([]error{}, b.errs...)
+
+    archs := b.archs
+    if len(archs) == 0 {
+        archs = []string{""}
+    }
+
+    for _, arch := range archs {
+        _, unknown, err := ResolvePolicyForArch(b.policy, arch)
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+
+        if len(unknown) > 0 {
+            archName := arch
+            if archName == "" {
+                archName = "this arch"
+            }
+            errs = append(errs, fmt.Errorf("syscalls do not exist on %s: %s",
+                archName, strings.Join(unknown, ", ")))
+        }
+    }
+
+    if len(errs) > 0 {
+        messages := make([]string, len(errs))
+        for i, err := range errs {
+            messages[i] = err.Error()
+        }
+        return nil, errors.New(strings.Join(messages, "; "))
+    }
+
+    return b.policy.Copy(), nil
+}
+
+/*
+    Builds a seccomp filter for the native arch to export, e.g. for
+    inspecting it with ExportPFC. To run a program with the policy,
+    pass Build result to sandbox.Run instead.
+ */
+func (b *PolicyBuilder) Filter() (*Filter, error) {
+    p, err := b.Build()
+    if err != nil {
+        return nil, err
+    }
+
+    return NewFilter(p)
+}
+
+/* Returns the policy as a JSON policy file, see policy.MarshalDocument */
+func (b *PolicyBuilder) Document() ([]byte, error) {
+    p, err := b.Build()
+    if err != nil {
+        return nil, err
+    }
+
+    return policy.MarshalDocument(p)
+}
+
+/* Refers to a syscall argument by its index, e.g. Arg(0).Eq(syscall.AF_UNIX) */
+type ArgRef uint
+
+func Arg(index uint) ArgRef {
+    return ArgRef(index)
+}
+
+func (arg ArgRef) compare(op policy.Operator, value uint64) policy.Condition {
+    return policy.Condition{Arg: uint(arg), Op: op, Value: value}
+}
+
+func (arg ArgRef) Eq(value uint64) policy.Condition { return arg.compare(policy.OP_EQ, value) }
+func (arg ArgRef) Ne(value uint64) policy.Condition { return arg.compare(policy.OP_NE, value) }
+func (arg ArgRef) Lt(value uint64) policy.Condition { return arg.compare(policy.OP_LT, value) }
+func (arg ArgRef) Le(value uint64) policy.Condition { return arg.compare(policy.OP_LE, value) }
+func (arg ArgRef) Gt(value uint64) policy.Condition { return arg.compare(policy.OP_GT, value) }
+func (arg ArgRef) Ge(value uint64) policy.Condition { return arg.compare(policy.OP_GE, value) }
+
+/* True if (arg & mask) == value */
+func (arg ArgRef) MaskedEq(mask uint64, value uint64) policy.Condition {
+    condition := arg.compare(policy.OP_MASKED_EQ, value)
+    condition.Mask = mask
+    return condition
+}
+
+/*
+    Creates a seccomp filter for the native arch from a policy, see
+    Filter. Syscalls that do not exist on this arch are an error, use
+    ResolvePolicy to find them.
+ */
+func NewFilter(p *policy.Policy) (*Filter, error) {
+    rules, unknown, err := ResolvePolicy(p)
+    if err != nil {
+        return nil, err
+    }
+
+    if len(unknown) > 0 {
+        return nil, fmt.Errorf("syscalls do not exist on this arch: %s", strings.Join(unknown, ", "))
+    }
+
+    return newFilter(rules, p.DefaultAction)
+}
+
+func containsName(names []string, name string) bool {
+    for _, candidate := range names {
+        if candidate == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,122 @@
+package seccomphelper
+
+import (
+    "sort"
+    "strings"
+    "guarddog/policy"
+)
+
+/*
+    Difference between two resolved policies. Rules of a syscall
+    are described like "allow" or "errno:1 if arg0 == 0x1" and
+    sorted, so the order of rules in source files does not matter.
+ */
+type PolicyDiff struct {
+    Arch                string          `json:"arch"`
+    OldDefaultAction    string          `json:"old-default-action"`
+    NewDefaultAction    string          `json:"new-default-action"`
+    /* syscalls that have rules only in the new policy */
+    Added               []SyscallDiff   `json:"added"`
+    /* syscalls that have rules only in the old policy */
+    Removed             []SyscallDiff   `json:"removed"`
+    /* syscalls with different rules */
+    Changed             []SyscallDiff   `json:"changed"`
+}
+
+/* Rules of a syscall that exist only in the old or only in the new policy */
+type SyscallDiff struct {
+    Syscall             string          `json:"syscall"`
+    Old                 []string        `json:"old,omitempty"`
+    New                 []string        `json:"new,omitempty"`
+}
+
+/*
+    Compares rules returned by ResolvePolicy. Syscalls in the result
+    are sorted by name. A syscall without rules uses default action,
+    so changing a default action changes every such syscall.
+ */
+func DiffRules(
+        oldRules []ResolvedRule, oldDefault policy.Action,
+        newRules []ResolvedRule, newDefault policy.Action) *PolicyDiff {
+
+    diff := &PolicyDiff{
+        OldDefaultAction: oldDefault.String(),
+        NewDefaultAction: newDefault.String(),
+        Added: []SyscallDiff{},
+        Removed: []SyscallDiff{},
+        Changed: []SyscallDiff{},
+    }
+
+    oldBySyscall := describeRules(oldRules)
+    newBySyscall := describeRules(newRules)
+
+    var names []string
+    for name := range oldBySyscall {
+        names = append(names, name)
+    }
+    for name := range newBySyscall {
+        if _, found := oldBySyscall[name]; !found {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+
+    for _, name := range names {
+        oldList, inOld := oldBySyscall[name]
+        newList, inNew := newBySyscall[name]
+
+        switch {
+        case !inOld:
+            diff.Added = append(diff.Added, SyscallDiff{Syscall: name, New: newList})
+        case !inNew:
+            diff.Removed = append(diff.Removed, SyscallDiff{Syscall: name, Old: oldList})
+        default:
+            removed := subtractStrings(oldList, newList)
+            added := subtractStrings(newList, oldList)
+            if len(removed) > 0 || len(added) > 0 {
+                diff.Changed = append(diff.Changed, SyscallDiff{Syscall: name, Old: removed, New: added})
+            }
+        }
+    }
+
+    return diff
+}
+
+/* Returns true if policies make the same decisions */
+func (diff *PolicyDiff) IsEmpty() bool {
+    return diff.OldDefaultAction == diff.NewDefaultAction &&
+        len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+/* Returns sorted descriptions of rules by syscall name */
+func describeRules(rules []ResolvedRule) map[string][]string {
+    result := make(map[string][]string)
+    for _, resolved := range rules {
+        rule := policy.Rule{Syscall: resolved.Syscall, Action: resolved.Action, Conditions: resolved.Conditions}
+        description := strings.TrimPrefix(rule.String(), rule.Syscall + ": ")
+        result[rule.Syscall] = append(result[rule.Syscall], description)
+    }
+
+    for _, list := range result {
+        sort.Strings(list)
+    }
+
+    return result
+}
+
+/* Returns items of a that are not in b */
+func subtractStrings(a []string, b []string) []string {
+    var result []string
+    for _, item := range a {
+        found := false
+        for _, other := range b {
+            found = found || item == other
+        }
+
+        if !found {
+            result = append(result, item)
+        }
+    }
+
+    return result
+}
@@ -0,0 +1,193 @@
+package seccomphelper
+
+import (
+    "fmt"
+    "guarddog/external/github.com/seccomp/libseccomp-golang"
+    "guarddog/policy"
+)
+
+/* Policy rule with a syscall resolved into a number on the native arch */
+type ResolvedRule struct {
+    Syscall     string
+    Number      int
+    Action      policy.Action
+    Conditions  []policy.Condition
+}
+
+/*
+    Converts policy rules into rules for the native arch. Groups
+    are expanded and names are normalized (see NormalizeSyscallNames),
+    argument numbers in conditions are changed for equivalents with
+    a different argument layout. A variant of an existing name is
+    skipped if a condition has no equivalent in it, e.g. the offset
+    of mmap in mmap2, otherwise such conditions are an error.
+    Syscalls from groups and optional rules that do not exist on this
+    arch are skipped, other unknown names are returned in unknown list.
+
+    Rules are applied in order: an unconditional rule replaces all
+    previous rules for the same syscall, so later options override
+    earlier ones. Rules with default action are dropped because
+    they have no effect.
+ */
+func ResolvePolicy(p *policy.Policy) (rules []ResolvedRule, unknown []string, err error) {
+    return resolvePolicy(p, seccomp.ArchNative)
+}
+
+/* Same as ResolvePolicy, but numbers and names are for given arch, see ParseArch */
+func ResolvePolicyForArch(p *policy.Policy, archName string) ([]ResolvedRule, []string, error) {
+    arch, err := ParseArch(archName)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return resolvePolicy(p, arch)
+}
+
+func resolvePolicy(p *policy.Policy, arch seccomp.ScmpArch) (rules []ResolvedRule, unknown []string, err error) {
+    seenUnknown := make(map[string]bool)
+
+    for _, rule := range p.Rules {
+        for _, condition := range rule.Conditions {
+            if err := condition.Validate(); err != nil {
+                return nil, nil, fmt.Errorf("invalid rule '%s': %s", rule, err)
+            }
+        }
+
+        names := []string{rule.Syscall}
+        isGroup := policy.IsGroupName(rule.Syscall)
+        if isGroup {
+            names, err = policy.LookupGroup(rule.Syscall)
+            if err != nil {
+                return nil, nil, err
+            }
+        }
+
+        for _, requested := range names {
+            natives := equivalentsOnArch(requested, arch)
+            if len(natives) == 0 && !isGroup && !rule.Optional && !seenUnknown[requested] {
+                seenUnknown[requested] = true
+                unknown = append(unknown, requested)
+            }
+
+            for _, name := range natives {
+                syscallId, err := seccomp.GetSyscallFromNameByArch(name, arch)
+                if err != nil {
+                    return nil, nil, fmt.Errorf("Failed to find a number for syscall name '%s': %s",
+                        name, err)
+                }
+
+                conditions, err := equivalentConditions(requested, name, rule.Conditions)
+                if err != nil && natives[0] == requested {
+                    continue
+                }
+                if err != nil {
+                    return nil, nil, fmt.Errorf("invalid rule '%s': %s", rule, err)
+                }
+
+                rules = addResolvedRule(rules, ResolvedRule{
+                    Syscall: name,
+                    Number: int(syscallId),
+                    Action: rule.Action,
+                    Conditions: conditions,
+                })
+            }
+        }
+    }
+
+    var result []ResolvedRule
+    for _, rule := range rules {
+        if rule.Action != p.DefaultAction {
+            result = append(result, rule)
+        }
+    }
+
+    return result, unknown, nil
+}
+
+func addResolvedRule(rules []ResolvedRule, rule ResolvedRule) []ResolvedRule {
+    if len(rule.Conditions) == 0 {
+        var result []ResolvedRule
+        for _, existing := range rules {
+            if existing.Number != rule.Number {
+                result = append(result, existing)
+            }
+        }
+
+        return append(result, rule)
+    }
+
+    for _, existing := range rules {
+        if existing.Number != rule.Number || existing.Action != rule.Action {
+            continue
+        }
+
+        // Already allowed without conditions or the same rule was added before
+        if len(existing.Conditions) == 0 ||
+                equalConditions(existing.Conditions, rule.Conditions) {
+            return rules
+        }
+    }
+
+    return append(rules, rule)
+}
+
+func equalConditions(a, b []policy.Condition) bool {
+    if len(a) != len(b) {
+        return false
+    }
+
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+
+    return true
+}
+
+/*
+    Returns an action that a filter built from the rules would take for
+    a syscall with given arguments. Like in libseccomp, an unconditional
+    rule takes precedence over conditional ones.
+ */
+func EvaluateRules(rules []ResolvedRule, defaultAction policy.Action, number int, args []uint64) policy.Action {
+    for _, rule := range rules {
+        if rule.Number == number && len(rule.Conditions) == 0 {
+            return rule.Action
+        }
+    }
+
+    for _, rule := range rules {
+        if rule.Number != number {
+            continue
+        }
+
+        matches := true
+        for _, condition := range rule.Conditions {
+            matches = matches && condition.Matches(args)
+        }
+
+        if matches {
+            return rule.Action
+        }
+    }
+
+    return defaultAction
+}
+
+/*
+    Returns true if resolved rules allow given syscall or one of its
+    equivalents on this arch, possibly with conditions
+ */
+func IsSyscallAllowed(rules []ResolvedRule, name string) bool {
+    natives, _ := NormalizeSyscallNames([]string{name})
+    for _, native := range natives {
+        for _, rule := range rules {
+            if rule.Syscall == native && rule.Action.Kind == policy.ACTION_ALLOW {
+                return true
+            }
+        }
+    }
+
+    return false
+}
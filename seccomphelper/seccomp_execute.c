@@ -4,39 +4,61 @@
 #include <seccomp.h>
 #include <errno.h>
 #include <unistd.h>
+#include <sys/resource.h>
+#include "seccomp_execute.h"
 
-extern char **environ;
+/*
+ * Kills all threads instead of the calling one, otherwise a program that
+ * is not allowed to call execve() leaves the Go runtime of guarddog
+ * running. Supported since libseccomp 2.4 and Linux 4.14.
+ */
+#ifndef SCMP_ACT_KILL_PROCESS
+#define SCMP_ACT_KILL_PROCESS 0x80000000U
+#endif
 
 /**
- * Creates and loads a BPF seccomp filter
- * allowing only specific system calls
+ * Converts RULE_ACTION_* constant into libseccomp action
+ */
+static uint32_t getSeccompAction(int action, int errnoValue) {
+    switch (action) {
+        case RULE_ACTION_TRAP:
+            return SCMP_ACT_TRAP;
+        case RULE_ACTION_ERRNO:
+            return SCMP_ACT_ERRNO(errnoValue);
+        case RULE_ACTION_ALLOW:
+            return SCMP_ACT_ALLOW;
+        default:
+            return SCMP_ACT_KILL_PROCESS;
+    }
+}
+
+/**
+ * Creates a seccomp filter applying given rules to system calls,
+ * the same filter is loaded by executeProgramWithFilter
  *
- * Returns 0 on success, 1 on error
+ * Returns NULL on error
  */
-int createAndLoadFilter(
-    int const allowedCallNumbers[],
-    int useTrap,
+scmp_filter_ctx createFilter(
+    struct syscallRule const rules[],
+    int ruleCount,
+    int defaultAction,
+    int defaultErrno,
     char* errorBuffer,
-    int errorBufferLength    
+    int errorBufferLength
 ) {
     scmp_filter_ctx filterContext = NULL;
     int result = 0;
-    int isError = 0;
-    const int *currentCall;
-
-    int actionOnBreakingPolicy = SCMP_ACT_KILL;
-    if (useTrap) {
-        actionOnBreakingPolicy = SCMP_ACT_TRAP;
-    }
+    int i;
+    struct syscallRule const *rule;
 
-    filterContext = seccomp_init(actionOnBreakingPolicy);
+    filterContext = seccomp_init(getSeccompAction(defaultAction, defaultErrno));
     if (!filterContext) {
         snprintf(
             errorBuffer, 
             errorBufferLength, 
             "seccomp_init() failed"
         );
-        return 1;
+        return NULL;
     }
 
     // Set NO_NEW_PRIVS bit
@@ -49,12 +71,11 @@ int createAndLoadFilter(
             result, 
             strerror(-result)
         );
-        isError = 1;
         goto release;
     }
     
     // Set bad architecture action
-    result = seccomp_attr_set(filterContext, SCMP_FLTATR_ACT_BADARCH, SCMP_ACT_KILL);
+    result = seccomp_attr_set(filterContext, SCMP_FLTATR_ACT_BADARCH, SCMP_ACT_KILL_PROCESS);
     if (result != 0) {
         snprintf(
             errorBuffer, 
@@ -63,29 +84,83 @@ int createAndLoadFilter(
             result, 
             strerror(-result)
         );
-        isError = 1;
         goto release;
     }
 
-    // Iterate through a list of allowed system call numbers
-    for (currentCall = allowedCallNumbers; *currentCall; currentCall++) {
-        result = seccomp_rule_add(filterContext, SCMP_ACT_ALLOW, *currentCall, 0);
+    // Iterate through a list of rules
+    for (i = 0; i < ruleCount; i++) {
+        rule = &rules[i];
+
+        // seccomp_rule_add_array() is not available in libseccomp 2.1 
+        // so we always pass RULE_MAX_ARGS conditions and let the 
+        // function read only argCount of them
+        result = seccomp_rule_add(
+            filterContext, 
+            getSeccompAction(rule->action, rule->errnoValue), 
+            rule->syscall, 
+            rule->argCount,
+            rule->args[0],
+            rule->args[1],
+            rule->args[2],
+            rule->args[3],
+            rule->args[4],
+            rule->args[5]
+        );
+
         if (result != 0) {
             snprintf(
                 errorBuffer,
                 errorBufferLength,
                 "seccomp_rule_add() failed for call %d with code %d: %s",
-                *currentCall,
+                rule->syscall,
                 result,
                 strerror(-result)
             );
 
-            isError = 1;
             goto release;
         }
     }
 
+    return filterContext;
+
+    release:
+    seccomp_release(filterContext);
+    return NULL;
+}
+
+/**
+ * Creates and loads a BPF seccomp filter
+ * applying given rules to system calls
+ *
+ * Returns 0 on success, 1 on error
+ */
+static int createAndLoadFilter(
+    struct syscallRule const rules[],
+    int ruleCount,
+    int defaultAction,
+    int defaultErrno,
+    char* errorBuffer,
+    int errorBufferLength    
+) {
+    scmp_filter_ctx filterContext = NULL;
+    int result = 0;
+
+    filterContext = createFilter(
+        rules,
+        ruleCount,
+        defaultAction,
+        defaultErrno,
+        errorBuffer,
+        errorBufferLength
+    );
+
+    if (!filterContext) {
+        return 1;
+    }
+
     result = seccomp_load(filterContext);
+    seccomp_release(filterContext);
+
     if (result != 0) {
         snprintf(
             errorBuffer,
@@ -95,14 +170,10 @@ int createAndLoadFilter(
             strerror(-result)
         );
 
-        isError = 1;
-        goto release;
+        return 1;
     }
 
-    
-    release: 
-    seccomp_release(filterContext);
-    return isError;
+    return 0;
 };
 
 /*
@@ -110,6 +181,12 @@ int createAndLoadFilter(
     the given program. Written in C to avoid side effects
     of applying seccomp filter on Go runtime.
 
+    Resource limits are set before the filter is loaded, as late
+    as possible so they do not restrict the preparation of guarddog.
+
+    Messages are written to loggerFd, nothing is written
+    if it is negative.
+
     This function is not supposed to return if everything 
     is OK.
 
@@ -120,22 +197,32 @@ int executeProgramWithFilter(
         int loggerFd, 
         char const *loggerTag,
         int allowAnySyscalls,
-        int const allowedCallNumbers[], 
-        int useTrap, 
+        struct syscallRule const rules[],
+        int ruleCount,
+        int defaultAction,
+        int defaultErrno,
+        struct resourceLimit const limits[],
+        int limitCount,
+        char const *path,
         char* const argv[],
+        char* const envp[],
         char* errorBuffer,
         int errorBufferLength) {
 
     int result;
-    FILE *loggerFile;
+    int i;
+    struct rlimit limit;
+    FILE *loggerFile = NULL;
 
     // Clear buffer
     errorBuffer[0] = '\0';
 
     // We are never going to close this FILE* object so 
     // underlying file descriptor will not be closed too
-    loggerFile = fdopen(loggerFd, "a");
-    if (!loggerFile) {
+    if (loggerFd >= 0) {
+        loggerFile = fdopen(loggerFd, "a");
+    }
+    if (loggerFd >= 0 && !loggerFile) {
         snprintf(
             errorBuffer,
             errorBufferLength,
@@ -147,10 +234,28 @@ int executeProgramWithFilter(
         return 0;
     }
 
+    for (i = 0; i < limitCount; i++) {
+        limit.rlim_cur = limits[i].value;
+        limit.rlim_max = limits[i].value;
+        if (setrlimit(limits[i].resource, &limit) != 0) {
+            snprintf(
+                errorBuffer,
+                errorBufferLength,
+                "setrlimit() for resource %d failed: %s",
+                limits[i].resource,
+                strerror(errno)
+            );
+
+            return 1;
+        }
+    }
+
     if (!allowAnySyscalls) {
         result = createAndLoadFilter(
-            allowedCallNumbers,
-            useTrap,
+            rules,
+            ruleCount,
+            defaultAction,
+            defaultErrno,
             errorBuffer,
             errorBufferLength
         );
@@ -160,10 +265,10 @@ int executeProgramWithFilter(
         }
     }
 
-    if (verbose) {
+    if (verbose && loggerFile) {
         char* const *currentArg;
         fprintf(loggerFile, "%s: Applied seccomp policy\n", loggerTag);
-        fprintf(loggerFile, "%s: Executing command [", loggerTag);
+        fprintf(loggerFile, "%s: Executing %s [", loggerTag, path);
         for (currentArg = argv; *currentArg; currentArg++) {
             if (currentArg != argv) {
                 // Add space except first argument
@@ -172,10 +277,12 @@ int executeProgramWithFilter(
             fprintf(loggerFile, "%s", *currentArg);
         }
         fprintf(loggerFile, "]\n");
+        // The buffer would be lost after execve()
+        fflush(loggerFile);
     }
 
     // Now call execve
-    result = execve(argv[0], argv, environ);
+    result = execve(path, argv, envp);
 
     // We should not get here
     snprintf(
@@ -186,13 +293,15 @@ int executeProgramWithFilter(
         strerror(errno)
     );
 
-    fprintf(
-        loggerFile, 
-        "%s: execve() failed with code %d: %s", 
-        loggerTag,
-        errno,
-        strerror(errno)
-    );
+    if (loggerFile) {
+        fprintf(
+            loggerFile, 
+            "%s: execve() failed with code %d: %s\n", 
+            loggerTag,
+            errno,
+            strerror(errno)
+        );
+    }
 
     return 1;
 };
@@ -3,7 +3,8 @@ package seccomphelper
 import (
     "errors"
     "fmt"
-    "guarddog/external/github.com/seccomp/libseccomp-golang" 
+    "guarddog/policy"
+    "os"
     "syscall"
     "unsafe"
 )
@@ -15,53 +16,66 @@ import (
 #cgo pkg-config: libseccomp
 
 #include <stdlib.h>
+#include "seccomp_execute.h"
+ */
+import "C"
+
+/* Program to execute with a seccomp filter */
+type ExecuteOptions struct {
+    Verbose         bool
+    /* file descriptor for debug messages, -1 to disable them */
+    LoggerFd        int
+    LoggerTag       string
+    /* do not load a filter, rules are ignored */
+    AllowAnySyscalls bool
+    Rules           []ResolvedRule
+    DefaultAction   policy.Action
+    /* set right before the filter is loaded, hard limits cannot be raised by non-root */
+    Limits          []ResourceLimit
+    /* absolute path to the program */
+    Path            string
+    /* arguments including argv[0] */
+    Command         []string
+    /* environment of the program as NAME=value strings */
+    Env             []string
+}
 
-int executeProgramWithFilter(
-        int verbose, 
-        int loggerFd, 
-        char const *loggerTag,
-        int allowAnySyscalls,
-        int const allowedCallNumbers[], 
-        int useTrap, 
-        char const* const argv[],
-        char* errorBuffer,
-        int errorBufferLength
-);
+/* Limit of a resource, both soft and hard limits are set to the value */
+type ResourceLimit struct {
+    /* RLIMIT_* constant */
+    Resource        int
+    Value           uint64
+}
 
+/* 
+    Loads a seccomp filter into the current thread and replaces
+    the process with a program, returns only on error
  */
-import "C"
+func ExecuteWithSeccomp(options *ExecuteOptions) error {
+    rules := options.Rules
+    command := options.Command
+    defaultAction := options.DefaultAction
 
-func ExecuteWithSeccomp(
-    verbose bool, 
-    loggerFd int, 
-    loggerTag string,
-    allowAnySyscalls bool,
-    allowedCalls []string,
-    useTrap bool,
-    command []string) error {
+    // Go memory cannot contain pointers to Go memory when 
+    // passed to C so the arguments are copied to C heap
+    argv := newCStringArray(command)
+    defer freeCStringArray(argv, len(command))
 
-    argv, err := SlicePtrFromStrings(command)
+    envp := newCStringArray(options.Env)
+    defer freeCStringArray(envp, len(options.Env))
+
+    rulesC, err := newCRules(rules)
     if err != nil {
         return err
     }
 
-    // Create a slice of system call numbers
-    var allowedCallNumbers = make([]C.int, len(allowedCalls) + 1)
-    var i = 0
-    for _, syscallName := range allowedCalls {
-        syscallId, err := seccomp.GetSyscallFromName(syscallName)
-        if err != nil {
-            return fmt.Errorf("Failed to find a number for syscall name '%s': %s", 
-                syscallName, err)
-        }
-
-        allowedCallNumbers[i] = C.int(syscallId)
-        i++
+    // One more item so an address of the first one can be taken
+    limitsC := make([]C.struct_resourceLimit, len(options.Limits) + 1)
+    for i, limit := range options.Limits {
+        limitsC[i].resource = C.int(limit.Resource)
+        limitsC[i].value = C.ulonglong(limit.Value)
     }
 
-    // Make last item empty
-    allowedCallNumbers[i] = 0;
-
     // Buffer to write an error message
     const ERROR_BUFFER_LEN = 2048
     var errorBufferC = (*C.char)(C.malloc(ERROR_BUFFER_LEN + 1))
@@ -71,17 +85,26 @@ func ExecuteWithSeccomp(
         return errors.New("Failed to allocate memory for error message")
     }
 
-    var loggerTagC = C.CString(loggerTag)
+    var loggerTagC = C.CString(options.LoggerTag)
     defer C.free(unsafe.Pointer(loggerTagC))
+
+    var pathC = C.CString(options.Path)
+    defer C.free(unsafe.Pointer(pathC))
     
     _ = C.executeProgramWithFilter(
-        C.int(bool2int(verbose)),
-        C.int(loggerFd),
+        C.int(bool2int(options.Verbose)),
+        C.int(options.LoggerFd),
         loggerTagC,
-        C.int(bool2int(allowAnySyscalls)),
-        &allowedCallNumbers[0],
-        C.int(bool2int(useTrap)),
-        (**C.char)(unsafe.Pointer(&argv[0])),
+        C.int(bool2int(options.AllowAnySyscalls)),
+        &rulesC[0],
+        C.int(len(rules)),
+        C.int(defaultAction.Kind),
+        C.int(defaultAction.Errno),
+        &limitsC[0],
+        C.int(len(options.Limits)),
+        pathC,
+        argv,
+        envp,
         errorBufferC,
         C.int(ERROR_BUFFER_LEN))
 
@@ -89,6 +112,140 @@ func ExecuteWithSeccomp(
     return errors.New(errorText)
 }
 
+/*
+    Seccomp filter with the same actions as the filter loaded by
+    ExecuteWithSeccomp: the kill action kills the whole process.
+    It can be exported, but it is not loaded into the current process
+    because the filter would apply to the Go runtime. Use sandbox.Run
+    to execute a program with a policy.
+ */
+type Filter struct {
+    context     C.scmp_filter_ctx
+}
+
+/* Creates a filter from rules resolved for the native arch */
+func newFilter(rules []ResolvedRule, defaultAction policy.Action) (*Filter, error) {
+    rulesC, err := newCRules(rules)
+    if err != nil {
+        return nil, err
+    }
+
+    const ERROR_BUFFER_LEN = 2048
+    var errorBufferC = (*C.char)(C.malloc(ERROR_BUFFER_LEN + 1))
+    if errorBufferC == nil {
+        return nil, errors.New("Failed to allocate memory for error message")
+    }
+    defer C.free(unsafe.Pointer(errorBufferC))
+
+    context := C.createFilter(
+        &rulesC[0],
+        C.int(len(rules)),
+        C.int(defaultAction.Kind),
+        C.int(defaultAction.Errno),
+        errorBufferC,
+        C.int(ERROR_BUFFER_LEN))
+
+    if context == nil {
+        return nil, errors.New(C.GoString(errorBufferC))
+    }
+
+    return &Filter{context}, nil
+}
+
+/* Writes the filter as human readable pseudo code */
+func (f *Filter) ExportPFC(file *os.File) error {
+    if result := C.seccomp_export_pfc(f.context, C.int(file.Fd())); result != 0 {
+        return fmt.Errorf("seccomp_export_pfc() failed: %s", syscall.Errno(-result))
+    }
+    return nil
+}
+
+/* Writes the filter as BPF program that can be loaded with seccomp(2) */
+func (f *Filter) ExportBPF(file *os.File) error {
+    if result := C.seccomp_export_bpf(f.context, C.int(file.Fd())); result != 0 {
+        return fmt.Errorf("seccomp_export_bpf() failed: %s", syscall.Errno(-result))
+    }
+    return nil
+}
+
+/* Frees memory of the filter */
+func (f *Filter) Release() {
+    if f.context != nil {
+        C.seccomp_release(f.context)
+        f.context = nil
+    }
+}
+
+/*
+    Converts rules to C structures, with one more item
+    so an address of the first one can be taken
+ */
+func newCRules(rules []ResolvedRule) ([]C.struct_syscallRule, error) {
+    var rulesC = make([]C.struct_syscallRule, len(rules) + 1)
+    for i, rule := range rules {
+        if len(rule.Conditions) > C.RULE_MAX_ARGS {
+            return nil, fmt.Errorf("too many conditions in a rule for syscall %s", rule.Syscall)
+        }
+
+        rulesC[i].syscall = C.int(rule.Number)
+        rulesC[i].action = C.int(rule.Action.Kind)
+        rulesC[i].errnoValue = C.int(rule.Action.Errno)
+        rulesC[i].argCount = C.uint(len(rule.Conditions))
+        for j, condition := range rule.Conditions {
+            rulesC[i].args[j] = newArgCompare(condition)
+        }
+    }
+
+    return rulesC, nil
+}
+
+func newArgCompare(condition policy.Condition) C.struct_scmp_arg_cmp {
+    var result C.struct_scmp_arg_cmp
+    result.arg = C.uint(condition.Arg)
+    result.datum_a = C.scmp_datum_t(condition.Value)
+
+    switch condition.Op {
+    case policy.OP_EQ:
+        result.op = C.SCMP_CMP_EQ
+    case policy.OP_NE:
+        result.op = C.SCMP_CMP_NE
+    case policy.OP_LT:
+        result.op = C.SCMP_CMP_LT
+    case policy.OP_LE:
+        result.op = C.SCMP_CMP_LE
+    case policy.OP_GT:
+        result.op = C.SCMP_CMP_GT
+    case policy.OP_GE:
+        result.op = C.SCMP_CMP_GE
+    case policy.OP_MASKED_EQ:
+        // libseccomp compares (arg & datum_a) == datum_b
+        result.op = C.SCMP_CMP_MASKED_EQ
+        result.datum_a = C.scmp_datum_t(condition.Mask)
+        result.datum_b = C.scmp_datum_t(condition.Value)
+    }
+
+    return result
+}
+
+/* Returns a NULL-terminated array of C strings allocated with malloc() */
+func newCStringArray(ss []string) **C.char {
+    size := C.size_t(unsafe.Sizeof((*C.char)(nil))) * C.size_t(len(ss) + 1)
+    array := (*[1 << 20]*C.char)(C.malloc(size))[:len(ss) + 1:len(ss) + 1]
+    for i, s := range ss {
+        array[i] = C.CString(s)
+    }
+    array[len(ss)] = nil
+    return &array[0]
+}
+
+func freeCStringArray(array **C.char, length int) {
+    items := (*[1 << 20]*C.char)(unsafe.Pointer(array))[:length:length]
+    for _, item := range items {
+        C.free(unsafe.Pointer(item))
+    }
+    C.free(unsafe.Pointer(array))
+}
+
 func bool2int(b bool) int {
     if b {
         return 1
@@ -96,19 +253,3 @@ func bool2int(b bool) int {
         return 0
     }
 }
-
-// SlicePtrFromStrings converts a slice of strings to a slice of
-// pointers to NUL-terminated byte arrays. If any string contains
-// a NUL byte, it returns (nil, EINVAL).
-func SlicePtrFromStrings(ss []string) ([]*byte, error) {
-    var err error
-    bb := make([]*byte, len(ss)+1)
-    for i := 0; i < len(ss); i++ {
-        bb[i], err = syscall.BytePtrFromString(ss[i])
-        if err != nil {
-            return nil, err
-        }
-    }
-    bb[len(ss)] = nil
-    return bb, nil
-}
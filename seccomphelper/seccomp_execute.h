@@ -0,0 +1,57 @@
+#ifndef GUARDDOG_SECCOMP_EXECUTE_H
+#define GUARDDOG_SECCOMP_EXECUTE_H
+
+#include <seccomp.h>
+
+/* Must match policy.ActionKind values */
+#define RULE_ACTION_KILL 0
+#define RULE_ACTION_TRAP 1
+#define RULE_ACTION_ERRNO 2
+#define RULE_ACTION_ALLOW 3
+
+/* Must match policy.MAX_ARGS */
+#define RULE_MAX_ARGS 6
+
+/* A rule for one syscall, conditions are joined with AND */
+struct syscallRule {
+    int syscall;
+    int action;
+    int errnoValue;
+    unsigned int argCount;
+    struct scmp_arg_cmp args[RULE_MAX_ARGS];
+};
+
+/* Soft and hard limit of a resource set right before exec */
+struct resourceLimit {
+    int resource;
+    unsigned long long value;
+};
+
+scmp_filter_ctx createFilter(
+        struct syscallRule const rules[],
+        int ruleCount,
+        int defaultAction,
+        int defaultErrno,
+        char* errorBuffer,
+        int errorBufferLength
+);
+
+int executeProgramWithFilter(
+        int verbose,
+        int loggerFd,
+        char const *loggerTag,
+        int allowAnySyscalls,
+        struct syscallRule const rules[],
+        int ruleCount,
+        int defaultAction,
+        int defaultErrno,
+        struct resourceLimit const limits[],
+        int limitCount,
+        char const *path,
+        char* const argv[],
+        char* const envp[],
+        char* errorBuffer,
+        int errorBufferLength
+);
+
+#endif
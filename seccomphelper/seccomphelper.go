@@ -3,7 +3,6 @@ package seccomphelper
 import (
     "guarddog/external/github.com/seccomp/libseccomp-golang" 
     "fmt"
-    "os"
 )
 
 type SeccompInfo struct {
@@ -55,51 +54,3 @@ func GetSyscallNames() <-chan SyscallInfo {
 
     return ch
 }
-
-/*
-    Creates a libseccomp filter that allows only given
-    syscalls. The whiteList is a list of syscall names.
- */
-func PrepareSeccompFilter(whiteList []string, useTrap bool) (*seccomp.ScmpFilter, error) {
-    var actionOnBreakingPolicy = seccomp.ActKill
-    if useTrap {
-        actionOnBreakingPolicy = seccomp.ActTrap
-    }
-
-    filter, err := seccomp.NewFilter(actionOnBreakingPolicy)
-    if err != nil {
-        return nil, err
-    }
-
-    err = filter.SetNoNewPrivsBit(true)
-    if err != nil {
-        return nil, err
-    }
-
-    err = filter.SetBadArchAction(seccomp.ActKill)
-    if err != nil {
-        return nil, err
-    }
-
-    for _, syscallName := range whiteList {
-        syscallId, err := seccomp.GetSyscallFromName(syscallName)
-        if err != nil {
-            return nil, fmt.Errorf("Failed to find a number for syscall name '%s': %s", 
-                syscallName, err)
-        }
-        filter.AddRule(syscallId, seccomp.ActAllow)
-    }
-
-    return filter, nil
-}
-
-func DebugDumpFilter(filter *seccomp.ScmpFilter) {
-    err := filter.ExportPFC(os.Stderr)
-    if err != nil {
-        panic("Failed to export filter contents")
-    }
-}
-
-func ApplySeccompFilter(filter *seccomp.ScmpFilter) error {
-    return filter.Load()
-}
@@ -1,6 +1,12 @@
 package seccomphelper
 
 import (
+    "guarddog/policy"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+    "syscall"
     "testing"
 )
 
@@ -20,10 +26,325 @@ func TestGetSyscalls(t *testing.T) {
     }
 }
 
-func TestPrepareFilter(t *testing.T) {
-    whitelist := []string{"write", "read", "exit"}
-    _, err := PrepareSeccompFilter(whitelist, true)
+func TestNormalizeSyscallNames(t *testing.T) {
+    // Variants are added where they exist, replacements only for missing names
+    for _, test := range []struct {
+        arch        string
+        name        string
+        expect      string
+    }{
+        {"amd64", "open", "open"},
+        {"amd64", "mmap2", "mmap"},
+        {"x86", "mmap", "mmap mmap2"},
+        {"x86", "mmap2", "mmap2 mmap"},
+        {"x86", "getuid", "getuid getuid32"},
+        {"arm64", "open", "openat"},
+    } {
+        arch, _ := ParseArch(test.arch)
+        natives, unknown := normalizeSyscallNames([]string{test.name}, arch)
+        if strings.Join(natives, " ") != test.expect || len(unknown) != 0 {
+            t.Errorf("Expected %s for %s on %s, got %v, unknown %v",
+                test.expect, test.name, test.arch, natives, unknown)
+        }
+    }
+
+    mmap, unknown := NormalizeSyscallNames([]string{"mmap"})
+    if len(mmap) == 0 || len(unknown) != 0 {
+        t.Fatalf("Failed to normalize mmap: %v, unknown %v", mmap, unknown)
+    }
+
+    _, unknown = NormalizeSyscallNames([]string{"read", "no_such_call", "no_such_call"})
+    if len(unknown) != 1 || unknown[0] != "no_such_call" {
+        t.Fatalf("Expected to get one unknown syscall, got %v", unknown)
+    }
+}
+
+func TestResolvePolicy(t *testing.T) {
+    p := policy.New(policy.Kill)
+    p.Allow("@memory", "no_such_call")
+    p.AddRule(policy.Rule{
+        Syscall: "ioctl", 
+        Action: policy.Allow,
+        Conditions: []policy.Condition{{Arg: 1, Op: policy.OP_EQ, Value: 1}},
+    })
+    // Overrides previous rule 
+    p.AddRule(policy.Rule{Syscall: "ioctl", Action: policy.Errno(1)})
+    // Has default action and must be dropped
+    p.AddRule(policy.Rule{Syscall: "brk", Action: policy.Kill})
+
+    rules, unknown, err := ResolvePolicy(p)
+    if err != nil {
+        t.Fatalf("Failed to resolve policy: %s", err)
+    }
+
+    // Names from groups that do not exist on this arch are not reported
+    if len(unknown) != 1 || unknown[0] != "no_such_call" {
+        t.Fatalf("Expected to get one unknown syscall, got %v", unknown)
+    }
+
+    if !IsSyscallAllowed(rules, "mmap") {
+        t.Fatalf("Expected mmap to be allowed")
+    }
+
+    if IsSyscallAllowed(rules, "brk") {
+        t.Fatalf("Expected brk to be removed by a rule with default action")
+    }
+
+    ioctlRules := 0
+    for _, rule := range rules {
+        if rule.Syscall == "ioctl" {
+            ioctlRules++
+            if rule.Action != policy.Errno(1) {
+                t.Fatalf("Expected ioctl rule to be overridden, got %v", rule)
+            }
+        }
+    }
+
+    if ioctlRules != 1 {
+        t.Fatalf("Expected to get one rule for ioctl, got %d", ioctlRules)
+    }
+}
+
+func TestEvaluateRules(t *testing.T) {
+    rules := []ResolvedRule{
+        {Syscall: "socket", Number: 41, Action: policy.Allow,
+            Conditions: []policy.Condition{{Arg: 0, Op: policy.OP_EQ, Value: 1}}},
+        {Syscall: "socket", Number: 41, Action: policy.Errno(13),
+            Conditions: []policy.Condition{{Arg: 0, Op: policy.OP_NE, Value: 1}}},
+        {Syscall: "read", Number: 0, Action: policy.Allow},
+    }
+
+    testEvaluateRules(t, rules, 41, []uint64{1, 1}, policy.Allow)
+    testEvaluateRules(t, rules, 41, []uint64{2}, policy.Errno(13))
+    testEvaluateRules(t, rules, 0, nil, policy.Allow)
+    testEvaluateRules(t, rules, 1, nil, policy.Kill)
+
+    // An unconditional rule wins like in libseccomp
+    rules = append(rules, ResolvedRule{Syscall: "socket", Number: 41, Action: policy.Trap})
+    testEvaluateRules(t, rules, 41, []uint64{1}, policy.Trap)
+}
+
+func testEvaluateRules(t *testing.T, rules []ResolvedRule, number int, args []uint64, expect policy.Action) {
+    action := EvaluateRules(rules, policy.Kill, number, args)
+    if action != expect {
+        t.Errorf("Expected %s for syscall %d%v, got %s", expect, number, args, action)
+    }
+}
+
+func TestResolvePolicyForArch(t *testing.T) {
+    p := policy.New(policy.Kill)
+    p.Allow("open", "mmap")
+
+    // aarch64 has neither open nor mmap2
+    rules, unknown, err := ResolvePolicyForArch(p, "arm64")
+    if err != nil {
+        t.Fatalf("Failed to resolve policy: %s", err)
+    }
+
+    if len(unknown) != 0 || len(rules) != 2 || rules[0].Syscall != "openat" || rules[1].Syscall != "mmap" {
+        t.Fatalf("Unexpected rules %v, unknown %v", rules, unknown)
+    }
+
+    // One list for x86_64 and i686, where glibc calls the 64-bit variants
+    amd64 := policy.New(policy.Kill)
+    amd64.Allow("mmap", "fstat", "stat", "newfstatat", "fcntl", "lseek", "getuid")
+    rules, unknown, err = ResolvePolicyForArch(amd64, "x86")
+    if err != nil || len(unknown) != 0 {
+        t.Fatalf("Failed to resolve policy for i686: %v, unknown %v", err, unknown)
+    }
+
+    for _, name := range []string{"mmap", "mmap2", "fstat64", "stat64", "fstatat64", "fcntl64", "_llseek", "getuid32"} {
+        if !hasResolvedRule(rules, name) {
+            t.Errorf("Expected %s to be allowed on i686, got %v", name, rules)
+        }
+    }
+
+    if _, _, err := ResolvePolicyForArch(p, "no-such-arch"); err == nil {
+        t.Fatalf("Expected an error for unknown arch")
+    }
+
+    // Flags of open are the third argument of openat
+    readOnly := policy.New(policy.Kill)
+    readOnly.AddRule(policy.Rule{
+        Syscall: "open",
+        Action: policy.Allow,
+        Conditions: []policy.Condition{{Arg: 1, Op: policy.OP_EQ, Value: 0}},
+    })
+
+    rules, _, err = ResolvePolicyForArch(readOnly, "arm64")
+    if err != nil || len(rules) != 1 || rules[0].Conditions[0].Arg != 2 {
+        t.Fatalf("Unexpected rules %v, error %v", rules, err)
+    }
+
+    rules, _, err = ResolvePolicyForArch(readOnly, "amd64")
+    if err != nil || len(rules) != 1 || rules[0].Syscall != "open" || rules[0].Conditions[0].Arg != 1 {
+        t.Fatalf("Expected only open on amd64, got %v, error %v", rules, err)
+    }
+
+    // The offset of mmap2 is in pages
+    offset := policy.New(policy.Kill)
+    offset.AddRule(policy.Rule{
+        Syscall: "mmap2",
+        Action: policy.Allow,
+        Conditions: []policy.Condition{{Arg: 5, Op: policy.OP_EQ, Value: 0}},
+    })
+
+    if _, _, err := ResolvePolicyForArch(offset, "amd64"); err == nil {
+        t.Fatalf("Expected an error for an argument without equivalent")
+    }
+
+    // mmap2 exists on i686, so its variant without the argument is skipped
+    rules, _, err = ResolvePolicyForArch(offset, "x86")
+    if err != nil || len(rules) != 1 || rules[0].Syscall != "mmap2" {
+        t.Fatalf("Expected only mmap2 on i686, got %v, error %v", rules, err)
+    }
+}
+
+func hasResolvedRule(rules []ResolvedRule, name string) bool {
+    for _, rule := range rules {
+        if rule.Syscall == name {
+            return true
+        }
+    }
+    return false
+}
+
+func TestDiffRules(t *testing.T) {
+    unixSocket := []policy.Condition{{Arg: 0, Op: policy.OP_EQ, Value: 1}}
+    oldRules := []ResolvedRule{
+        {Syscall: "read", Number: 0, Action: policy.Allow},
+        {Syscall: "write", Number: 1, Action: policy.Allow},
+        {Syscall: "socket", Number: 41, Action: policy.Allow, Conditions: unixSocket},
+    }
+    newRules := []ResolvedRule{
+        {Syscall: "socket", Number: 41, Action: policy.Errno(1)},
+        {Syscall: "read", Number: 0, Action: policy.Allow},
+        {Syscall: "brk", Number: 12, Action: policy.Allow},
+    }
+
+    diff := DiffRules(oldRules, policy.Kill, newRules, policy.Kill)
+    if len(diff.Added) != 1 || diff.Added[0].Syscall != "brk" || diff.Added[0].New[0] != "allow" {
+        t.Errorf("Unexpected added syscalls: %v", diff.Added)
+    }
+
+    if len(diff.Removed) != 1 || diff.Removed[0].Syscall != "write" {
+        t.Errorf("Unexpected removed syscalls: %v", diff.Removed)
+    }
+
+    if len(diff.Changed) != 1 || diff.Changed[0].Old[0] != "allow if arg0 == 0x1" ||
+            diff.Changed[0].New[0] != "errno:1" {
+        t.Errorf("Unexpected changed syscalls: %v", diff.Changed)
+    }
+
+    // Order of rules does not matter
+    reversed := []ResolvedRule{newRules[2], newRules[1], newRules[0]}
+    if !DiffRules(newRules, policy.Kill, reversed, policy.Kill).IsEmpty() {
+        t.Errorf("Expected no difference for reordered rules")
+    }
+
+    if DiffRules(newRules, policy.Kill, newRules, policy.Trap).IsEmpty() {
+        t.Errorf("Expected a difference for another default action")
+    }
+}
+
+func TestPolicyBuilder(t *testing.T) {
+    builder := NewPolicy().
+        Default(policy.Kill).
+        Group("@memory").
+        Allow("read", "write", "exit_group").
+        AllowIf("socket", Arg(0).Eq(syscall.AF_UNIX)).
+        Rule("clone", policy.Allow, Arg(0).MaskedEq(syscall.CLONE_THREAD, syscall.CLONE_THREAD)).
+        Errno("ptrace", policy.EPERM).
+        Rlimit("nofile", 64)
+
+    p, err := builder.Build()
     if err != nil {
-        t.Fatalf("Failed to prepare a filter: %s", err)
+        t.Fatalf("Failed to build policy: %s", err)
+    }
+
+    if len(p.Rules) != 7 || p.Rules[6].Action != policy.Errno(policy.EPERM) {
+        t.Fatalf("Unexpected rules %v", p.Rules)
+    }
+
+    filter, err := builder.Filter()
+    if err != nil {
+        t.Fatalf("Failed to build filter: %s", err)
+    }
+    defer filter.Release()
+
+    // The filter kills the process like the one loaded by sandbox.Run
+    pfc, err := ioutil.TempFile("", "guarddog-filter")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.Remove(pfc.Name())
+    defer pfc.Close()
+
+    if err := filter.ExportPFC(pfc); err != nil {
+        t.Fatalf("Failed to export filter: %s", err)
+    }
+
+    if exported, _ := ioutil.ReadFile(pfc.Name()); !strings.Contains(string(exported), "KILL_PROCESS") {
+        t.Errorf("Expected the filter to kill the process:\n%s", exported)
+    }
+
+    // The document must be read back into the same policy
+    document, err := builder.Document()
+    if err != nil {
+        t.Fatalf("Failed to build document: %s", err)
+    }
+
+    dir, err := ioutil.TempDir("", "guarddog-builder")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    fileName := filepath.Join(dir, "policy.json")
+    if err := ioutil.WriteFile(fileName, document, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    loaded, err := policy.LoadFile(fileName, "")
+    if err != nil {
+        t.Fatalf("Failed to load document %s: %s", document, err)
+    }
+
+    if loaded.DefaultAction != p.DefaultAction || len(loaded.Rules) != len(p.Rules) ||
+            len(loaded.Rlimits) != 1 || loaded.Rlimits[0].Value != 64 {
+        t.Fatalf("Loaded policy differs: %v", loaded)
+    }
+
+    for i := range p.Rules {
+        if loaded.Rules[i].String() != p.Rules[i].String() {
+            t.Errorf("Expected rule '%s', got '%s'", p.Rules[i], loaded.Rules[i])
+        }
+    }
+}
+
+func TestPolicyBuilderErrors(t *testing.T) {
+    _, err := NewPolicy().
+        Arch("arm64", "no-such-arch").
+        Allow("read", "open", "no_such_call").
+        Group("memory").
+        Group("@no-such-group").
+        AllowIf("ioctl", Arg(7).Eq(1)).
+        Errno("ptrace", 0).
+        Build()
+
+    if err == nil {
+        t.Fatalf("Expected errors")
+    }
+
+    // open exists on arm64 as openat, so it is not reported
+    for _, expect := range []string{"no-such-arch", "no_such_call", "'memory'",
+            "@no-such-group", "argument index 7", "errno 0"} {
+        if !strings.Contains(err.Error(), expect) {
+            t.Errorf("Expected error to mention %s, got: %s", expect, err)
+        }
+    }
+
+    if strings.Contains(err.Error(), "open,") || strings.Contains(err.Error(), "open;") {
+        t.Errorf("Unexpected error for open: %s", err)
     }
 }
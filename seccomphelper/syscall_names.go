@@ -0,0 +1,246 @@
+package seccomphelper
+
+import (
+    "fmt"
+    "guarddog/external/github.com/seccomp/libseccomp-golang" 
+    "guarddog/policy"
+)
+
+/*
+    Some system calls have different names on different
+    architectures, for example i686 has mmap2 and fstat64 
+    while x86_64 has only mmap and fstat, and aarch64 has 
+    no open at all, only openat.
+
+    Names in the same group are variants of one syscall and every
+    variant that exists on the native architecture is used for any
+    of them. i686 has both the old mmap and fstat and mmap2 and
+    fstat64 that glibc calls, so allowing mmap allows both there.
+    This allows to use one config file on different hosts.
+ */
+var syscallEquivalents = [][]string{
+    {"mmap", "mmap2"},
+    {"stat", "stat64"},
+    {"fstat", "fstat64"},
+    {"lstat", "lstat64"},
+    {"newfstatat", "fstatat64"},
+    {"statfs", "statfs64"},
+    {"fstatfs", "fstatfs64"},
+    {"fcntl", "fcntl64"},
+    {"lseek", "_llseek"},
+    {"truncate", "truncate64"},
+    {"ftruncate", "ftruncate64"},
+    {"sendfile", "sendfile64"},
+    {"getuid", "getuid32"},
+    {"geteuid", "geteuid32"},
+    {"getgid", "getgid32"},
+    {"getegid", "getegid32"},
+    {"setuid", "setuid32"},
+    {"setgid", "setgid32"},
+    {"getresuid", "getresuid32"},
+    {"getresgid", "getresgid32"},
+    {"setresuid", "setresuid32"},
+    {"setresgid", "setresgid32"},
+    {"getgroups", "getgroups32"},
+    {"setgroups", "setgroups32"},
+    {"chown", "chown32"},
+    {"fchown", "fchown32"},
+    {"lchown", "lchown32"},
+}
+
+/*
+    Syscalls that differ in meaning, a name is replaced with the
+    others only on archs where it does not exist. openat can open
+    files relative to any directory, so allowing open does not
+    allow openat on x86_64.
+ */
+var syscallReplacements = [][]string{
+    {"open", "openat"},
+}
+
+/*
+    Positions of arguments of a syscall in its equivalent for pairs
+    with different argument layouts, e.g. openat has dirfd before the
+    arguments of open. Arguments that are not listed or are -1 have no
+    equivalent: the offset of mmap2 is in pages instead of bytes and
+    64-bit values are split into two registers on 32-bit archs. Pairs
+    that are not listed have the same arguments.
+ */
+var argumentPositions = map[[2]string][]int{
+    {"open", "openat"}: {1, 2, 3},
+    {"openat", "open"}: {-1, 0, 1, 2},
+    {"mmap", "mmap2"}: {0, 1, 2, 3, 4},
+    {"mmap2", "mmap"}: {0, 1, 2, 3, 4},
+    {"lseek", "_llseek"}: {0, -1, 4},
+    {"_llseek", "lseek"}: {0, -1, -1, -1, 2},
+    {"truncate", "truncate64"}: {0},
+    {"truncate64", "truncate"}: {0},
+    {"ftruncate", "ftruncate64"}: {0},
+    {"ftruncate64", "ftruncate"}: {0},
+}
+
+/* 
+    Returns true if a syscall with given name exists on the native arch.
+    Newer libseccomp versions return negative pseudo numbers for 
+    syscalls that exist only on other archs.
+ */
+func IsKnownSyscall(name string) bool {
+    return isKnownSyscallOnArch(name, seccomp.ArchNative)
+}
+
+func isKnownSyscallOnArch(name string, arch seccomp.ScmpArch) bool {
+    syscallId, err := seccomp.GetSyscallFromNameByArch(name, arch)
+    return err == nil && syscallId >= 0
+}
+
+/* Parses an arch name like "amd64" or "arm64", empty name means the native arch */
+func ParseArch(name string) (seccomp.ScmpArch, error) {
+    if name == "" {
+        return seccomp.ArchNative, nil
+    }
+
+    arch, err := seccomp.GetArchFromString(name)
+    if err != nil {
+        return seccomp.ArchInvalid, fmt.Errorf("unknown arch '%s'", name)
+    }
+
+    return arch, nil
+}
+
+/* Returns a number of a syscall on the native arch */
+func GetSyscallNumber(name string) (int, error) {
+    syscallId, err := seccomp.GetSyscallFromName(name)
+    if err != nil || syscallId < 0 {
+        return 0, fmt.Errorf("syscall %s does not exist on this arch", name)
+    }
+
+    return int(syscallId), nil
+}
+
+/* Returns a list of names equivalent to given one, including the name itself */
+func GetSyscallEquivalents(name string) []string {
+    if group := findGroup(syscallEquivalents, name); group != nil {
+        return group
+    }
+
+    if group := findGroup(syscallReplacements, name); group != nil {
+        return group
+    }
+
+    return []string{name}
+}
+
+func findGroup(groups [][]string, name string) []string {
+    for _, group := range groups {
+        for _, candidate := range group {
+            if candidate == name {
+                return group
+            }
+        }
+    }
+
+    return nil
+}
+
+/*
+    Returns the position of an argument of a syscall in its equivalent,
+    false if the argument has no equivalent
+ */
+func EquivalentArgument(from string, to string, arg uint) (uint, bool) {
+    if from == to {
+        return arg, true
+    }
+
+    positions, differ := argumentPositions[[2]string{from, to}]
+    if !differ {
+        return arg, true
+    }
+
+    if int(arg) >= len(positions) || positions[arg] < 0 {
+        return 0, false
+    }
+
+    return uint(positions[arg]), true
+}
+
+/*
+    Converts conditions of a rule for a syscall into conditions
+    for its equivalent, fails if an argument has no equivalent
+ */
+func equivalentConditions(from string, to string, conditions []policy.Condition) ([]policy.Condition, error) {
+    if from == to || len(conditions) == 0 {
+        return conditions, nil
+    }
+
+    result := make([]policy.Condition, len(conditions))
+    for i, condition := range conditions {
+        arg, ok := EquivalentArgument(from, to, condition.Arg)
+        if !ok {
+            return nil, fmt.Errorf("argument %d of %s has no equivalent in %s", condition.Arg, from, to)
+        }
+
+        result[i] = condition
+        result[i].Arg = arg
+    }
+
+    return result, nil
+}
+
+/*
+    Converts a list of syscall names into a list of names 
+    that exist on the native arch. A name is replaced with its
+    variants known on this arch, a name that does not exist is
+    also replaced with its replacements.
+
+    Names that neither exist on this arch nor have known 
+    equivalents are returned in unknown list. Resulting 
+    lists do not contain duplicates.
+ */
+func NormalizeSyscallNames(names []string) (native []string, unknown []string) {
+    return normalizeSyscallNames(names, seccomp.ArchNative)
+}
+
+func normalizeSyscallNames(names []string, arch seccomp.ScmpArch) (native []string, unknown []string) {
+    seen := make(map[string]bool)
+
+    for _, name := range names {
+        candidates := equivalentsOnArch(name, arch)
+        for _, candidate := range candidates {
+            if !seen[candidate] {
+                seen[candidate] = true
+                native = append(native, candidate)
+            }
+        }
+
+        if len(candidates) == 0 && !seen[name] {
+            seen[name] = true
+            unknown = append(unknown, name)
+        }
+    }
+
+    return native, unknown
+}
+
+/*
+    Returns names that exist on an arch for a name: the name itself if
+    it exists and its variants, or its replacements if it does not
+ */
+func equivalentsOnArch(name string, arch seccomp.ScmpArch) []string {
+    exists := isKnownSyscallOnArch(name, arch)
+    if exists && findGroup(syscallReplacements, name) != nil {
+        return []string{name}
+    }
+
+    var result []string
+    if exists {
+        result = append(result, name)
+    }
+
+    for _, candidate := range GetSyscallEquivalents(name) {
+        if candidate != name && isKnownSyscallOnArch(candidate, arch) {
+            result = append(result, candidate)
+        }
+    }
+
+    return result
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+    "context"
+    "os/signal"
+    "syscall"
+    "guarddog/config"
+    "guarddog/sandbox"
+    "guarddog/server"
+    "guarddog/util"
+)
+
+/* Implements "guarddog serve" command */
+func serveCommand(args []string) int {
+    options := config.NewServeOptions()
+    if ok, code := parseCommandOptions("serve -socket=PATH [options]", options, args); !ok {
+        return code
+    }
+
+    logger, err := util.NewLogger(2, options.Verbose, config.PROGRAM_NAME + ": ")
+    if err != nil {
+        return printError(err)
+    }
+
+    s := server.New(sandbox.NewSpec(), int(options.MaxJobs), logger)
+    applySandboxOptions(&s.Sandbox, &options.SandboxOptions)
+    s.UidPool = newUidPool(&options.SandboxOptions)
+    for _, uid := range options.ClientUid {
+        s.ClientUids = append(s.ClientUids, int(uid))
+    }
+
+    // Stopping the server kills running jobs
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    if err := s.Serve(ctx, options.Socket); err != nil {
+        logger.Error("%s", err)
+        return 1
+    }
+
+    return 0
+}
@@ -0,0 +1,307 @@
+package server
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "guarddog/policy"
+    "guarddog/sandbox"
+    "guarddog/seccomphelper"
+)
+
+/* Params of a run request */
+type JobParams struct {
+    /* absolute path to a program and its arguments */
+    Command     []string            `json:"command"`
+    /* environment as NAME=value strings, empty by default */
+    Env         []string            `json:"env"`
+    /* working directory inside the chroot */
+    Dir         string              `json:"dir"`
+    /* policy file content in JSON, see policy.LoadDocument */
+    Policy      json.RawMessage     `json:"policy"`
+    /* run without a seccomp filter, then policy must not be given */
+    AllowAnySyscalls bool           `json:"allow-any-syscalls"`
+    /* resource limits like in policy files, they override limits of the policy */
+    Limits      map[string]uint64   `json:"limits"`
+    /* wall time limit like "2s", the program is killed after it */
+    Timeout     string              `json:"timeout"`
+    /*
+        paths of files for stdio, empty means /dev/null. Only clients
+        with the uid of the server can use paths.
+     */
+    Stdin       string              `json:"stdin"`
+    Stdout      string              `json:"stdout"`
+    Stderr      string              `json:"stderr"`
+    /*
+        names of stdio streams like ["stdin", "stdout"] in the order of
+        file descriptors sent with SCM_RIGHTS in the message of the request
+     */
+    Fds         []string            `json:"fds"`
+}
+
+var stdioNames = []string{"stdin", "stdout", "stderr"}
+
+/* Values of jobStatus.State */
+const (
+    JOB_QUEUED = "queued"
+    JOB_RUNNING = "running"
+    JOB_FINISHED = "finished"
+)
+
+/* Params of a status notification */
+type jobStatus struct {
+    Id          json.RawMessage     `json:"id"`
+    State       string              `json:"state"`
+    Pid         int                 `json:"pid,omitempty"`
+    /* uid and gid of the job from the pool */
+    Uid         int                 `json:"uid,omitempty"`
+    Result      *jobResult          `json:"result,omitempty"`
+}
+
+/* Result of a run request, times are in seconds */
+type jobResult struct {
+    ExitCode    int                 `json:"exit-code"`
+    /* number of a signal that killed the program, 0 if it exited */
+    Signal      int                 `json:"signal"`
+    /* killed for making a forbidden syscall */
+    Violation   bool                `json:"violation"`
+    /* killed after the timeout or on cancel */
+    Killed      bool                `json:"killed"`
+    WallTime    float64             `json:"wall-time"`
+    UserTime    float64             `json:"user-time"`
+    SystemTime  float64             `json:"system-time"`
+    /* peak resident set size in bytes */
+    MaxRss      int64               `json:"max-rss"`
+}
+
+/*
+    Waits for a free slot, runs a job and sends its result. The job is
+    killed when the context is done, cancel is called after the timeout.
+    Fds are files sent with the request, they are closed by the caller.
+ */
+func (c *connection) runJob(ctx context.Context, cancel context.CancelFunc, id json.RawMessage, params *JobParams, fds []*os.File) {
+    s := c.server
+
+    cmd, files, err := c.newCommand(ctx, id, params, fds)
+    defer closeFiles(files)
+    if err != nil {
+        c.sendError(id, ERROR_INVALID_PARAMS, err.Error())
+        return
+    }
+
+    c.sendStatus(&jobStatus{Id: id, State: JOB_QUEUED})
+
+    select {
+    case s.slots <- struct{}{}:
+        defer func() { <-s.slots }()
+    case <-ctx.Done():
+        c.sendError(id, ERROR_JOB_FAILED, "job was cancelled before it started")
+        return
+    }
+
+    uid := 0
+    if s.UidPool != nil {
+        lease, err := s.UidPool.Acquire()
+        if err != nil {
+            c.sendError(id, ERROR_JOB_FAILED, err.Error())
+            return
+        }
+
+        // Processes left by the job are killed after it
+        defer func() {
+            if err := lease.Release(); err != nil {
+                s.Logger.Error("job %s: %s", id, err)
+            }
+        }()
+
+        uid = lease.Id
+        cmd.Spec.Uid = uid
+        cmd.Spec.Gid = uid
+    }
+
+    if err := cmd.Start(); err != nil {
+        c.sendError(id, ERROR_JOB_FAILED, err.Error())
+        return
+    }
+
+    // The timeout does not include time in the queue
+    if timeout := params.timeout(); timeout > 0 {
+        timer := time.AfterFunc(timeout, cancel)
+        defer timer.Stop()
+    }
+
+    s.Logger.Info("job %s of uid %d started with pid %d: %s", id, c.uid, cmd.Process.Pid,
+        strings.Join(params.Command, " "))
+    c.sendStatus(&jobStatus{Id: id, State: JOB_RUNNING, Pid: cmd.Process.Pid, Uid: uid})
+
+    err = cmd.Wait()
+    if cmd.Result == nil {
+        c.sendError(id, ERROR_JOB_FAILED, err.Error())
+        return
+    }
+
+    result := newJobResult(cmd.Result)
+    result.Killed = ctx.Err() != nil
+    s.Logger.Info("job %s finished with exit status %d", id, cmd.Result.ExitStatus())
+
+    c.sendStatus(&jobStatus{Id: id, State: JOB_FINISHED, Result: result})
+    c.sendResult(id, result)
+}
+
+/*
+    Checks params and returns a command with restrictions of the server
+    and opened stdio files that must be closed after the job
+ */
+func (c *connection) newCommand(ctx context.Context, id json.RawMessage, params *JobParams, fds []*os.File) (*sandbox.Cmd, []*os.File, error) {
+    s := c.server
+    if len(params.Command) == 0 {
+        return nil, nil, errors.New("command is not specified")
+    }
+
+    if !filepath.IsAbs(params.Command[0]) {
+        return nil, nil, fmt.Errorf("command must be an absolute path, got '%s'", params.Command[0])
+    }
+
+    if _, err := time.ParseDuration(params.Timeout); params.Timeout != "" && err != nil {
+        return nil, nil, fmt.Errorf("invalid timeout: %s", err)
+    }
+
+    p, err := params.policy(fmt.Sprintf("<job %s policy>", id))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    spec := s.Sandbox
+    spec.Policy = p
+    limits := policy.New(policy.Kill)
+    if p != nil {
+        limits.Rlimits = p.Rlimits
+    }
+
+    for resource, value := range params.Limits {
+        if !containsString(policy.RlimitNames, resource) {
+            return nil, nil, fmt.Errorf("unknown limit '%s', expected one of: %s",
+                resource, strings.Join(policy.RlimitNames, ", "))
+        }
+        limits.SetRlimit(resource, value)
+    }
+    spec.Limits = limits.Rlimits
+
+    // The spec replaces the one made by CommandContext, so it has the policy set above
+    cmd := sandbox.CommandContext(ctx, p, params.Command[0], params.Command[1:]...)
+    cmd.Spec = &spec
+    cmd.Env = append([]string{}, params.Env...)
+    cmd.Dir = params.Dir
+
+    streams := make(map[string]*os.File)
+    for i, name := range params.Fds {
+        if !containsString(stdioNames, name) {
+            return nil, nil, fmt.Errorf("unknown stream '%s' in fds, expected one of: %s",
+                name, strings.Join(stdioNames, ", "))
+        }
+        if streams[name] != nil {
+            return nil, nil, fmt.Errorf("%s is given twice in fds", name)
+        }
+        streams[name] = fds[i]
+    }
+
+    var files []*os.File
+    paths := map[string]string{"stdin": params.Stdin, "stdout": params.Stdout, "stderr": params.Stderr}
+    for _, name := range stdioNames {
+        path := paths[name]
+        if path == "" {
+            continue
+        }
+
+        if streams[name] != nil {
+            return nil, files, fmt.Errorf("%s is given both as a path and in fds", name)
+        }
+
+        // The server may be able to open files the client cannot
+        if c.uid != os.Getuid() {
+            return nil, files, fmt.Errorf("%s: only clients with uid %d can send paths, send the file in fds",
+                name, os.Getuid())
+        }
+
+        flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+        if name == "stdin" {
+            flags = os.O_RDONLY
+        }
+
+        file, err := os.OpenFile(path, flags, 0644)
+        if err != nil {
+            return nil, files, err
+        }
+        files = append(files, file)
+        streams[name] = file
+    }
+
+    // Nil files must not be assigned, a nil *os.File in io.Reader is not nil
+    if file := streams["stdin"]; file != nil {
+        cmd.Stdin = file
+    }
+    if file := streams["stdout"]; file != nil {
+        cmd.Stdout = file
+    }
+    if file := streams["stderr"]; file != nil {
+        cmd.Stderr = file
+    }
+
+    return cmd, files, nil
+}
+
+/* Resolves the policy of a job, nil if syscalls are not filtered */
+func (params *JobParams) policy(name string) (*policy.Policy, error) {
+    hasPolicy := len(params.Policy) > 0 && string(params.Policy) != "null"
+
+    if params.AllowAnySyscalls {
+        if hasPolicy {
+            return nil, errors.New("policy cannot be given with allow-any-syscalls")
+        }
+        return nil, nil
+    }
+
+    if !hasPolicy {
+        return nil, errors.New("policy is not specified, use allow-any-syscalls to run without a filter")
+    }
+
+    return policy.LoadDocument(name, params.Policy, seccomphelper.GetLibraryInfo().Arch)
+}
+
+func (params *JobParams) timeout() time.Duration {
+    timeout, _ := time.ParseDuration(params.Timeout)
+    return timeout
+}
+
+func newJobResult(result *sandbox.Result) *jobResult {
+    return &jobResult{
+        ExitCode: result.ExitCode,
+        Signal: int(result.Signal),
+        Violation: result.IsViolation(),
+        WallTime: result.WallTime.Seconds(),
+        UserTime: result.UserTime.Seconds(),
+        SystemTime: result.SystemTime.Seconds(),
+        MaxRss: result.MaxRss,
+    }
+}
+
+func closeFiles(files []*os.File) {
+    for _, file := range files {
+        file.Close()
+    }
+}
+
+func containsString(haystack []string, needle string) bool {
+    for _, value := range haystack {
+        if value == needle {
+            return true
+        }
+    }
+    return false
+}
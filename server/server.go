@@ -0,0 +1,587 @@
+/*
+    Package server runs sandbox jobs sent over a Unix socket, so a
+    program running many small jobs does not pay for starting guarddog
+    and parsing its config every time.
+
+    Clients send JSON-RPC 2.0 requests, one JSON value per request:
+
+        {"jsonrpc": "2.0", "id": 1, "method": "run", "params": {
+            "command": ["/usr/bin/python3", "main.py"],
+            "policy": {"extends": "profile:python3"},
+            "limits": {"nofile": 64},
+            "timeout": "5s",
+            "stdin": "/jobs/1/input.txt",
+            "stdout": "/jobs/1/output.txt"
+        }}
+
+    The server sends "status" notifications as the job goes through
+    states queued, running and finished, and then the response with
+    the result:
+
+        {"jsonrpc": "2.0", "method": "status", "params": {"id": 1, "state": "running", "pid": 4242}}
+        {"jsonrpc": "2.0", "id": 1, "result": {"exit-code": 0, "wall-time": 0.051, ...}}
+
+    A running or queued job is killed by {"method": "cancel", "params": {"id": 1}}
+    or when the client disconnects. Several jobs can be sent over one
+    connection without waiting for results.
+
+    Clients are identified with SO_PEERCRED. Only clients with the uid
+    of the server or with uids from ClientUids may connect. Paths of
+    stdio files are opened by the server, so only clients with its uid
+    can use them. Other clients send opened files with SCM_RIGHTS in
+    the message of the request and list them in "fds":
+
+        {"jsonrpc": "2.0", "id": 2, "method": "run", "params": {
+            "command": ["/bin/cat"], "allow-any-syscalls": true,
+            "fds": ["stdin", "stdout"]
+        }}
+
+    Policies cannot refer to files, "extends" can only name a profile.
+ */
+package server
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "net"
+    "os"
+    "sync"
+    "syscall"
+
+    "guarddog/sandbox"
+    "guarddog/util"
+)
+
+/* Error codes defined by JSON-RPC 2.0 */
+const (
+    ERROR_PARSE = -32700
+    ERROR_INVALID_REQUEST = -32600
+    ERROR_METHOD_NOT_FOUND = -32601
+    ERROR_INVALID_PARAMS = -32602
+)
+
+/* Error codes of the server */
+const (
+    /* job cannot be started or was cancelled before it started */
+    ERROR_JOB_FAILED = -32000
+    /* uid of the client is not allowed */
+    ERROR_ACCESS_DENIED = -32001
+)
+
+type Server struct {
+    /*
+        Restrictions applied to every job like chroot and ids. Command,
+        environment, policy, limits and stdio are taken from jobs.
+     */
+    Sandbox     sandbox.Spec
+    /* maximum number of jobs running at the same time, others are queued */
+    MaxJobs     int
+    /* uids of clients allowed to connect besides the uid of the server */
+    ClientUids  []int
+    /* gives every job its own uid and gid, nil means ids from Sandbox */
+    UidPool     *sandbox.UidPool
+    Logger      *util.Logger
+
+    slots       chan struct{}
+    /* running connections and jobs, Serve returns after they end */
+    active      sync.WaitGroup
+}
+
+/* Returns a server with restrictions from a template spec */
+func New(template *sandbox.Spec, maxJobs int, logger *util.Logger) *Server {
+    return &Server{Sandbox: *template, MaxJobs: maxJobs, Logger: logger}
+}
+
+/*
+    Listens on a socket and runs jobs until the context is done.
+    Then running jobs are killed and the socket is removed.
+ */
+func (s *Server) Serve(ctx context.Context, socketPath string) error {
+    if s.MaxJobs < 1 {
+        return fmt.Errorf("maximum number of jobs must be at least 1, got %d", s.MaxJobs)
+    }
+    s.slots = make(chan struct{}, s.MaxJobs)
+
+    listener, err := listenUnix(socketPath, len(s.ClientUids) > 0)
+    if err != nil {
+        return err
+    }
+    defer os.Remove(socketPath)
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    go func() {
+        <-ctx.Done()
+        listener.Close()
+    }()
+
+    s.Logger.Info("listening on %s, at most %d jobs at a time", socketPath, s.MaxJobs)
+
+    for {
+        conn, err := listener.AcceptUnix()
+        if err != nil {
+            if ctx.Err() != nil {
+                break
+            }
+            s.Logger.Error("cannot accept a connection: %s", err)
+            continue
+        }
+
+        s.active.Add(1)
+        go func() {
+            defer s.active.Done()
+            s.serveConnection(ctx, conn)
+        }()
+    }
+
+    s.active.Wait()
+    return nil
+}
+
+/*
+    Creates a socket, removing a stale socket file left by a server
+    that was killed. Other clients need write access to the socket
+    so it is made accessible to anyone if they are allowed.
+ */
+func listenUnix(socketPath string, allowOthers bool) (*net.UnixListener, error) {
+    if info, err := os.Lstat(socketPath); err == nil && info.Mode() & os.ModeSocket != 0 {
+        if conn, err := net.Dial("unix", socketPath); err == nil {
+            conn.Close()
+            return nil, fmt.Errorf("another server is listening on %s", socketPath)
+        }
+        os.Remove(socketPath)
+    }
+
+    listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+    if err != nil {
+        return nil, err
+    }
+
+    // The file is removed by Serve
+    listener.SetUnlinkOnClose(false)
+
+    if allowOthers {
+        if err := os.Chmod(socketPath, 0666); err != nil {
+            listener.Close()
+            return nil, err
+        }
+    }
+
+    return listener, nil
+}
+
+/* Returns uid of the process on the other end of a connection */
+func peerUid(conn *net.UnixConn) (int, error) {
+    raw, err := conn.SyscallConn()
+    if err != nil {
+        return 0, err
+    }
+
+    var cred *syscall.Ucred
+    var credErr error
+    err = raw.Control(func(fd uintptr) {
+        cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+    })
+    if err != nil {
+        return 0, err
+    }
+    if credErr != nil {
+        return 0, credErr
+    }
+
+    return int(cred.Uid), nil
+}
+
+/* Maximum number of descriptors sent with one message */
+const maxMessageFds = 16
+
+/* Maximum number of descriptors received, but not claimed by requests yet */
+const maxPendingFds = 64
+
+/*
+    Reads the socket and queues file descriptors sent with SCM_RIGHTS.
+    The kernel delivers descriptors together with the first byte of the
+    message they were sent with, so descriptors of a request are queued
+    by the time the request is decoded.
+ */
+type rightsReader struct {
+    conn        *net.UnixConn
+    files       []receivedFile
+    /* number of bytes read so far */
+    offset      int64
+    /* returned by all reads after too many descriptors were sent */
+    err         error
+}
+
+/* Descriptor with the stream offset of the message it was sent with */
+type receivedFile struct {
+    file        *os.File
+    offset      int64
+}
+
+func (r *rightsReader) Read(buffer []byte) (int, error) {
+    if r.err != nil {
+        return 0, r.err
+    }
+
+    oob := make([]byte, syscall.CmsgSpace(maxMessageFds * 4))
+    n, oobn, flags, _, err := r.conn.ReadMsgUnix(buffer, oob)
+    offset := r.offset
+    r.offset += int64(n)
+
+    messages, parseErr := syscall.ParseSocketControlMessage(oob[:oobn])
+    if parseErr != nil {
+        return n, parseErr
+    }
+
+    for i := range messages {
+        // Other messages like credentials are ignored
+        fds, rightsErr := syscall.ParseUnixRights(&messages[i])
+        if rightsErr != nil {
+            continue
+        }
+
+        for _, fd := range fds {
+            if len(r.files) >= maxPendingFds {
+                syscall.Close(fd)
+                r.err = fmt.Errorf("more than %d file descriptors were sent without requests claiming them",
+                    maxPendingFds)
+                continue
+            }
+
+            syscall.CloseOnExec(fd)
+            file := os.NewFile(uintptr(fd), fmt.Sprintf("<client fd %d>", fd))
+            r.files = append(r.files, receivedFile{file, offset})
+        }
+    }
+
+    if err == nil && flags & syscall.MSG_CTRUNC != 0 {
+        r.err = fmt.Errorf("more than %d file descriptors in one message", maxMessageFds)
+    }
+    if err == nil {
+        err = r.err
+    }
+
+    return n, err
+}
+
+/*
+    Removes count descriptors from the front of the queue. Only descriptors
+    sent before the end offset of a request can be taken for it, the queue
+    may already have descriptors of the next requests.
+ */
+func (r *rightsReader) take(count int, end int64) ([]*os.File, error) {
+    available := r.countBefore(end)
+    if count > available {
+        return nil, fmt.Errorf("fds has %d names, but %d file descriptors were received",
+            count, available)
+    }
+
+    var files []*os.File
+    for _, received := range r.files[:count] {
+        files = append(files, received.file)
+    }
+    r.files = r.files[count:]
+    return files, nil
+}
+
+/* Closes descriptors sent before the end offset of a handled request */
+func (r *rightsReader) closeBefore(end int64) {
+    count := r.countBefore(end)
+    for _, received := range r.files[:count] {
+        received.file.Close()
+    }
+    r.files = r.files[count:]
+}
+
+func (r *rightsReader) countBefore(end int64) int {
+    count := 0
+    for count < len(r.files) && r.files[count].offset < end {
+        count++
+    }
+    return count
+}
+
+func (r *rightsReader) close() {
+    for _, received := range r.files {
+        received.file.Close()
+    }
+    r.files = nil
+}
+
+func (s *Server) isClientAllowed(uid int) bool {
+    if uid == os.Getuid() {
+        return true
+    }
+
+    for _, allowed := range s.ClientUids {
+        if uid == allowed {
+            return true
+        }
+    }
+
+    return false
+}
+
+type request struct {
+    Version     string          `json:"jsonrpc"`
+    Id          json.RawMessage `json:"id,omitempty"`
+    Method      string          `json:"method"`
+    Params      json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+    Version     string          `json:"jsonrpc"`
+    Id          json.RawMessage `json:"id"`
+    Result      interface{}     `json:"result,omitempty"`
+    Error       *rpcError       `json:"error,omitempty"`
+}
+
+type notification struct {
+    Version     string          `json:"jsonrpc"`
+    Method      string          `json:"method"`
+    Params      interface{}     `json:"params"`
+}
+
+type rpcError struct {
+    Code        int             `json:"code"`
+    Message     string          `json:"message"`
+}
+
+/* Id of a request, null if it has no id */
+var nullId = json.RawMessage("null")
+
+/* Connection of a client, jobs sent over it are killed when it is closed */
+type connection struct {
+    server      *Server
+    conn        *net.UnixConn
+    uid         int
+    reader      *rightsReader
+
+    /* protects writes to the socket and jobs */
+    mutex       sync.Mutex
+    encoder     *json.Encoder
+    /* cancel functions of jobs by keys of request ids, see jobKey */
+    jobs        map[string]context.CancelFunc
+}
+
+func (s *Server) serveConnection(ctx context.Context, conn *net.UnixConn) {
+    defer conn.Close()
+
+    c := &connection{
+        server: s,
+        conn: conn,
+        reader: &rightsReader{conn: conn},
+        encoder: json.NewEncoder(conn),
+        jobs: make(map[string]context.CancelFunc),
+    }
+
+    uid, err := peerUid(conn)
+    if err != nil {
+        s.Logger.Error("cannot get credentials of a client: %s", err)
+        return
+    }
+    c.uid = uid
+
+    if !s.isClientAllowed(uid) {
+        s.Logger.Warning("rejected a client with uid %d", uid)
+        c.sendError(nullId, ERROR_ACCESS_DENIED, fmt.Sprintf("uid %d is not allowed to connect", uid))
+        return
+    }
+
+    s.Logger.Info("client with uid %d connected", uid)
+
+    // Descriptors that no request claimed
+    defer c.reader.close()
+
+    // Jobs are killed when the client disconnects or the server stops
+    ctx, cancel := context.WithCancel(ctx)
+    var jobs sync.WaitGroup
+    defer jobs.Wait()
+    defer cancel()
+
+    go func() {
+        // Unblocks reading below when the server stops
+        <-ctx.Done()
+        conn.CloseRead()
+    }()
+
+    decoder := json.NewDecoder(c.reader)
+    for {
+        var req request
+        if err := decoder.Decode(&req); err != nil {
+            if err != io.EOF && ctx.Err() == nil {
+                if _, isSyntaxError := err.(*json.SyntaxError); isSyntaxError {
+                    c.sendError(nullId, ERROR_PARSE, err.Error())
+                } else if !errors.Is(err, net.ErrClosed) {
+                    c.sendError(nullId, ERROR_INVALID_REQUEST, err.Error())
+                }
+            }
+            break
+        }
+
+        // Descriptors sent with the request and not claimed by it are closed
+        end := decoder.InputOffset()
+        c.handleRequest(ctx, &req, end, &jobs)
+        c.reader.closeBefore(end)
+    }
+}
+
+/* Handles a request that ends at the given offset of the stream */
+func (c *connection) handleRequest(ctx context.Context, req *request, end int64, jobs *sync.WaitGroup) {
+    id := req.Id
+    if len(id) == 0 {
+        id = nullId
+    }
+
+    if req.Version != "2.0" {
+        c.sendError(id, ERROR_INVALID_REQUEST, "jsonrpc must be \"2.0\"")
+        return
+    }
+
+    switch req.Method {
+    case "run":
+        if len(req.Id) == 0 || string(req.Id) == "null" {
+            c.sendError(id, ERROR_INVALID_REQUEST, "run request must have an id")
+            return
+        }
+
+        var params JobParams
+        if err := decodeParams(req.Params, &params); err != nil {
+            c.sendError(id, ERROR_INVALID_PARAMS, err.Error())
+            return
+        }
+
+        fds, err := c.reader.take(len(params.Fds), end)
+        if err != nil {
+            c.sendError(id, ERROR_INVALID_PARAMS, err.Error())
+            return
+        }
+
+        jobCtx, cancel := context.WithCancel(ctx)
+        if !c.addJob(id, cancel) {
+            cancel()
+            closeFiles(fds)
+            c.sendError(id, ERROR_INVALID_REQUEST, fmt.Sprintf("job %s is already running", id))
+            return
+        }
+
+        jobs.Add(1)
+        go func() {
+            defer jobs.Done()
+            defer c.removeJob(id)
+            defer cancel()
+            defer closeFiles(fds)
+            c.runJob(jobCtx, cancel, id, &params, fds)
+        }()
+
+    case "cancel":
+        var params struct {
+            Id  json.RawMessage `json:"id"`
+        }
+        if err := decodeParams(req.Params, &params); err != nil || len(params.Id) == 0 {
+            c.sendError(id, ERROR_INVALID_PARAMS, "cancel needs an id of a run request")
+            return
+        }
+
+        if !c.cancelJob(params.Id) {
+            c.sendError(id, ERROR_INVALID_PARAMS, fmt.Sprintf("job %s is not running", params.Id))
+            return
+        }
+        c.sendResult(id, true)
+
+    default:
+        c.sendError(id, ERROR_METHOD_NOT_FOUND, fmt.Sprintf("unknown method '%s'", req.Method))
+    }
+}
+
+/* Decodes params rejecting unknown keys, so typos are not ignored */
+func decodeParams(params json.RawMessage, value interface{}) error {
+    if len(params) == 0 {
+        return errors.New("params are missing")
+    }
+
+    decoder := json.NewDecoder(bytes.NewReader(params))
+    decoder.DisallowUnknownFields()
+    return decoder.Decode(value)
+}
+
+/*
+    Returns a key that is the same for equal ids written differently,
+    like 1 and 1.0 or "a" and "\u0061"
+ */
+func jobKey(id json.RawMessage) string {
+    decoder := json.NewDecoder(bytes.NewReader(id))
+    decoder.UseNumber()
+
+    var value interface{}
+    if err := decoder.Decode(&value); err != nil {
+        return string(id)
+    }
+
+    switch value := value.(type) {
+    case json.Number:
+        // Exact, unlike float64, and cannot be confused with a string
+        if number, ok := new(big.Rat).SetString(string(value)); ok {
+            return number.String()
+        }
+    case string:
+        key, _ := json.Marshal(value)
+        return string(key)
+    }
+
+    return string(id)
+}
+
+func (c *connection) addJob(id json.RawMessage, cancel context.CancelFunc) bool {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    if _, exists := c.jobs[jobKey(id)]; exists {
+        return false
+    }
+    c.jobs[jobKey(id)] = cancel
+    return true
+}
+
+func (c *connection) removeJob(id json.RawMessage) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    delete(c.jobs, jobKey(id))
+}
+
+func (c *connection) cancelJob(id json.RawMessage) bool {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+
+    cancel, exists := c.jobs[jobKey(id)]
+    if exists {
+        cancel()
+    }
+    return exists
+}
+
+/* Writes a message, errors are ignored because the client may be gone */
+func (c *connection) send(message interface{}) {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+    c.encoder.Encode(message)
+}
+
+func (c *connection) sendResult(id json.RawMessage, result interface{}) {
+    c.send(&response{Version: "2.0", Id: id, Result: result})
+}
+
+func (c *connection) sendError(id json.RawMessage, code int, message string) {
+    c.send(&response{Version: "2.0", Id: id, Error: &rpcError{code, message}})
+}
+
+func (c *connection) sendStatus(status *jobStatus) {
+    c.send(&notification{Version: "2.0", Method: "status", Params: status})
+}
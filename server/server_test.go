@@ -0,0 +1,449 @@
+package server
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net"
+    "os"
+    "path/filepath"
+    "strings"
+    "syscall"
+    "testing"
+    "time"
+
+    "guarddog/sandbox"
+    "guarddog/util"
+)
+
+func TestMain(m *testing.M) {
+    sandbox.Init()
+    os.Exit(m.Run())
+}
+
+/* Message from the server, either a notification or a response */
+type message struct {
+    Id          json.RawMessage     `json:"id"`
+    Method      string              `json:"method"`
+    Params      jobStatus           `json:"params"`
+    Result      *jobResult          `json:"result"`
+    Error       *rpcError           `json:"error"`
+}
+
+type testClient struct {
+    t           *testing.T
+    conn        net.Conn
+    decoder     *json.Decoder
+}
+
+/* Starts a server in a temporary directory, returns the directory and a function stopping it */
+func startServer(t *testing.T, maxJobs int) (string, func()) {
+    dir, err := ioutil.TempDir("", "guarddog-server")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    logger, _ := util.NewLogger(2, false, "server: ")
+    spec := sandbox.NewSpec()
+    spec.AllowRoot = true
+    s := New(spec, maxJobs, logger)
+
+    socketPath := filepath.Join(dir, "guarddog.sock")
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() {
+        done <- s.Serve(ctx, socketPath)
+    }()
+
+    for i := 0; i < 100; i++ {
+        if _, err := os.Stat(socketPath); err == nil {
+            break
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+
+    return dir, func() {
+        cancel()
+        if err := <-done; err != nil {
+            t.Errorf("Serve failed: %s", err)
+        }
+        os.RemoveAll(dir)
+    }
+}
+
+func connect(t *testing.T, dir string) *testClient {
+    conn, err := net.Dial("unix", filepath.Join(dir, "guarddog.sock"))
+    if err != nil {
+        t.Fatalf("Failed to connect: %s", err)
+    }
+
+    return &testClient{t, conn, json.NewDecoder(conn)}
+}
+
+func (c *testClient) send(id int, method string, params interface{}) {
+    err := json.NewEncoder(c.conn).Encode(map[string]interface{}{
+        "jsonrpc": "2.0", "id": id, "method": method, "params": params,
+    })
+    if err != nil {
+        c.t.Fatalf("Failed to send request: %s", err)
+    }
+}
+
+/* Sends a request with files attached with SCM_RIGHTS */
+func (c *testClient) sendFiles(id int, method string, params interface{}, files ...*os.File) {
+    content, err := json.Marshal(map[string]interface{}{
+        "jsonrpc": "2.0", "id": id, "method": method, "params": params,
+    })
+    if err != nil {
+        c.t.Fatal(err)
+    }
+
+    var fds []int
+    for _, file := range files {
+        fds = append(fds, int(file.Fd()))
+    }
+
+    if _, _, err := c.conn.(*net.UnixConn).WriteMsgUnix(content, syscall.UnixRights(fds...), nil); err != nil {
+        c.t.Fatalf("Failed to send request: %s", err)
+    }
+}
+
+/* Reads messages until the response, returns states from status notifications */
+func (c *testClient) wait() ([]string, *message) {
+    var states []string
+    for {
+        var msg message
+        if err := c.decoder.Decode(&msg); err != nil {
+            c.t.Fatalf("Failed to read a message: %s", err)
+        }
+
+        if msg.Method != "status" {
+            return states, &msg
+        }
+        states = append(states, msg.Params.State)
+    }
+}
+
+func TestRunJobs(t *testing.T) {
+    dir, stop := startServer(t, 2)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    output := filepath.Join(dir, "output.txt")
+    client.send(1, "run", map[string]interface{}{
+        "command": []string{"/bin/echo", "hello"},
+        "allow-any-syscalls": true,
+        "stdout": output,
+    })
+
+    states, response := client.wait()
+    if response.Result == nil || response.Result.ExitCode != 0 || len(states) != 3 ||
+            states[0] != JOB_QUEUED || states[1] != JOB_RUNNING || states[2] != JOB_FINISHED {
+        t.Fatalf("Unexpected states %v and response %+v", states, response)
+    }
+
+    if content, _ := ioutil.ReadFile(output); string(content) != "hello\n" {
+        t.Errorf("Unexpected output %q", content)
+    }
+
+    client.send(2, "run", map[string]interface{}{
+        "command": []string{"/bin/uname"},
+        "policy": map[string]interface{}{
+            "default-action": "allow",
+            "rules": []interface{}{map[string]string{"syscall": "uname", "action": "kill"}},
+        },
+    })
+
+    if _, response := client.wait(); response.Result == nil || !response.Result.Violation {
+        t.Errorf("Expected a violation, got %+v", response.Result)
+    }
+
+    client.send(3, "run", map[string]interface{}{
+        "command": []string{"/bin/sleep", "10"},
+        "allow-any-syscalls": true,
+        "timeout": "100ms",
+    })
+
+    if _, response := client.wait(); response.Result == nil || !response.Result.Killed {
+        t.Errorf("Expected the job to be killed, got %+v", response)
+    }
+
+    client.send(4, "run", map[string]interface{}{"command": []string{"echo"}, "allow-any-syscalls": true})
+    if _, response := client.wait(); response.Error == nil || response.Error.Code != ERROR_INVALID_PARAMS {
+        t.Errorf("Expected an error for a relative path, got %+v", response)
+    }
+
+    client.send(5, "no-such-method", map[string]interface{}{})
+    if _, response := client.wait(); response.Error == nil || response.Error.Code != ERROR_METHOD_NOT_FOUND {
+        t.Errorf("Expected an error for unknown method, got %+v", response)
+    }
+}
+
+func TestRunJobWithFds(t *testing.T) {
+    dir, stop := startServer(t, 2)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    input := filepath.Join(dir, "input.txt")
+    ioutil.WriteFile(input, []byte("hello\n"), 0644)
+    stdin, err := os.Open(input)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer stdin.Close()
+
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer r.Close()
+
+    client.sendFiles(1, "run", map[string]interface{}{
+        "command": []string{"/bin/cat"},
+        "allow-any-syscalls": true,
+        "fds": []string{"stdin", "stdout"},
+    }, stdin, w)
+    w.Close()
+
+    if _, response := client.wait(); response.Result == nil || response.Result.ExitCode != 0 {
+        t.Fatalf("Unexpected response %+v", response)
+    }
+
+    // The server has closed its copy of the pipe after the job
+    if content, _ := ioutil.ReadAll(r); string(content) != "hello\n" {
+        t.Errorf("Unexpected output %q", content)
+    }
+
+    client.send(2, "run", map[string]interface{}{
+        "command": []string{"/bin/true"},
+        "allow-any-syscalls": true,
+        "fds": []string{"stdout"},
+    })
+    if _, response := client.wait(); response.Error == nil || response.Error.Code != ERROR_INVALID_PARAMS {
+        t.Errorf("Expected an error for missing file descriptors, got %+v", response)
+    }
+}
+
+func TestUnclaimedFdsAreClosed(t *testing.T) {
+    dir, stop := startServer(t, 2)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer r.Close()
+
+    client.sendFiles(1, "run", map[string]interface{}{
+        "command": []string{"/bin/true"},
+        "allow-any-syscalls": true,
+    }, w)
+    w.Close()
+
+    if _, response := client.wait(); response.Result == nil {
+        t.Fatalf("Unexpected response %+v", response)
+    }
+
+    // Reading ends only when the server has closed its copy of the pipe
+    r.SetReadDeadline(time.Now().Add(5 * time.Second))
+    if _, err := ioutil.ReadAll(r); err != nil {
+        t.Errorf("Expected the server to close a file descriptor not named in fds, got %s", err)
+    }
+}
+
+func TestTooManyPendingFds(t *testing.T) {
+    dir, stop := startServer(t, 2)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    file, err := os.Open(os.DevNull)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+
+    fds := make([]int, maxMessageFds)
+    for i := range fds {
+        fds[i] = int(file.Fd())
+    }
+
+    // Whitespace does not end a request, so the descriptors stay pending
+    for i := 0; i <= maxPendingFds / maxMessageFds; i++ {
+        _, _, err := client.conn.(*net.UnixConn).WriteMsgUnix([]byte(" "), syscall.UnixRights(fds...), nil)
+        if err != nil {
+            t.Fatalf("Failed to send file descriptors: %s", err)
+        }
+    }
+
+    _, response := client.wait()
+    if response.Error == nil || !strings.Contains(response.Error.Message, "file descriptors") {
+        t.Errorf("Expected an error for too many file descriptors, got %+v", response)
+    }
+}
+
+func TestJobIdsAreComparedByValue(t *testing.T) {
+    dir, stop := startServer(t, 2)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    client.send(1, "run", map[string]interface{}{
+        "command": []string{"/bin/sleep", "10"},
+        "allow-any-syscalls": true,
+    })
+
+    for _, request := range []string{
+            `{"jsonrpc": "2.0", "id": 1.0, "method": "run", ` +
+                `"params": {"command": ["/bin/true"], "allow-any-syscalls": true}}`,
+            `{"jsonrpc": "2.0", "id": 3, "method": "cancel", "params": {"id": 1e0}}`} {
+        if _, err := client.conn.Write([]byte(request + "\n")); err != nil {
+            t.Fatalf("Failed to send request: %s", err)
+        }
+    }
+
+    // Result of cancel is true, not a job result, so responses are decoded here
+    var responses []string
+    for len(responses) < 3 {
+        var msg struct {
+            Id          json.RawMessage     `json:"id"`
+            Method      string              `json:"method"`
+            Result      json.RawMessage     `json:"result"`
+            Error       *rpcError           `json:"error"`
+        }
+        if err := client.decoder.Decode(&msg); err != nil {
+            t.Fatalf("Failed to read a message: %s", err)
+        }
+
+        if msg.Method == "" {
+            responses = append(responses, string(msg.Id) + " " + string(msg.Result))
+            if msg.Error != nil {
+                responses[len(responses) - 1] += fmt.Sprintf("error %d", msg.Error.Code)
+            }
+        }
+    }
+
+    // Job 1 is killed or fails to start depending on when it is canceled
+    if responses[0] != fmt.Sprintf("1.0 error %d", ERROR_INVALID_REQUEST) || responses[1] != "3 true" ||
+            !strings.HasPrefix(responses[2], "1 ") {
+        t.Errorf("Expected job 1.0 to be rejected and job 1 to be canceled with id 1e0, got %q", responses)
+    }
+}
+
+func TestJobKey(t *testing.T) {
+    for _, ids := range [][]string{{"1", "1.0", "1e0", "10e-1"}, {`"a"`, `"\u0061"`}} {
+        for _, id := range ids[1:] {
+            if jobKey(json.RawMessage(id)) != jobKey(json.RawMessage(ids[0])) {
+                t.Errorf("Expected ids %s and %s to be equal", id, ids[0])
+            }
+        }
+    }
+
+    for _, ids := range [][]string{{"1", `"1"`}, {"9007199254740993", "9007199254740992"}} {
+        if jobKey(json.RawMessage(ids[0])) == jobKey(json.RawMessage(ids[1])) {
+            t.Errorf("Expected ids %s and %s to differ", ids[0], ids[1])
+        }
+    }
+}
+
+func TestNewCommandChecksFiles(t *testing.T) {
+    dir, err := ioutil.TempDir("", "guarddog-server")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+
+    base := filepath.Join(dir, "base.json")
+    ioutil.WriteFile(base, []byte(`{"default-action": "allow"}`), 0644)
+    output := filepath.Join(dir, "output.txt")
+
+    tests := []struct {
+        uid         int
+        params      JobParams
+        expect      string
+    }{
+        {os.Getuid() + 1, JobParams{AllowAnySyscalls: true, Stdout: output}, "only clients with uid"},
+        {os.Getuid(), JobParams{AllowAnySyscalls: true, Fds: []string{"stdout", "stdout"}}, "twice"},
+        {os.Getuid(), JobParams{AllowAnySyscalls: true, Fds: []string{"tty"}}, "unknown stream"},
+        {os.Getuid(), JobParams{Policy: json.RawMessage(`{"extends": "` + base + `"}`)}, "only extend profiles"},
+        {os.Getuid(), JobParams{Policy: json.RawMessage(`{"include": "` + base + `"}`)}, "only extend profiles"},
+    }
+
+    for _, test := range tests {
+        c := &connection{server: New(sandbox.NewSpec(), 1, nil), uid: test.uid}
+        test.params.Command = []string{"/bin/true"}
+
+        fds := make([]*os.File, len(test.params.Fds))
+        for i := range fds {
+            fds[i] = os.Stdout
+        }
+
+        _, files, err := c.newCommand(context.Background(), nullId, &test.params, fds)
+        closeFiles(files)
+        if err == nil || !strings.Contains(err.Error(), test.expect) {
+            t.Errorf("Expected error %q for %+v, got %v", test.expect, test.params, err)
+        }
+    }
+
+    if _, err := os.Stat(output); err == nil {
+        t.Errorf("Output of a client with another uid was created")
+    }
+}
+
+func TestMaxJobs(t *testing.T) {
+    dir, stop := startServer(t, 1)
+    defer stop()
+
+    client := connect(t, dir)
+    defer client.conn.Close()
+
+    job := map[string]interface{}{
+        "command": []string{"/bin/sleep", "0.2"},
+        "allow-any-syscalls": true,
+    }
+    client.send(1, "run", job)
+    client.send(2, "run", job)
+
+    // The second job starts only after the first one finishes
+    var events []string
+    var ids []string
+    for len(events) < 6 {
+        var msg message
+        if err := client.decoder.Decode(&msg); err != nil {
+            t.Fatalf("Failed to read a message: %s", err)
+        }
+
+        if msg.Method == "status" && msg.Params.State != JOB_QUEUED {
+            ids = append(ids, string(msg.Params.Id))
+            events = append(events, msg.Params.State)
+        } else if msg.Method == "" {
+            ids = append(ids, string(msg.Id))
+            events = append(events, "done")
+        }
+    }
+
+    expect := []string{JOB_RUNNING, JOB_FINISHED, "done", JOB_RUNNING, JOB_FINISHED, "done"}
+    for i := range expect {
+        if events[i] != expect[i] || ids[i] != ids[i / 3 * 3] || ids[0] == ids[3] {
+            t.Fatalf("Expected events %v, got %v for jobs %v", expect, events, ids)
+        }
+    }
+}
+
+func TestIsClientAllowed(t *testing.T) {
+    s := &Server{ClientUids: []int{20000}}
+
+    if !s.isClientAllowed(os.Getuid()) || !s.isClientAllowed(20000) || s.isClientAllowed(20001) {
+        t.Errorf("Unexpected result for allowed uids %v", s.ClientUids)
+    }
+}
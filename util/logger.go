@@ -31,6 +31,15 @@ func (l *Logger) Error(format string, args ...interface{}) {
     }
 }
 
+func (l *Logger) Warning(format string, args ...interface{}) {
+    l.Error("warning: " + format, args...)
+}
+
+/* Printed without verbose too, for information like ids chosen for the program */
+func (l *Logger) Notice(format string, args ...interface{}) {
+    l.Error(format, args...)
+}
+
 func (l* Logger) Info(format string, args ...interface{}) {
     if l.stream != nil && l.Verbose {
         _, err := fmt.Fprintf(l.stream, l.Prefix + format + "\n", args...) 
@@ -0,0 +1,59 @@
+package util
+
+import (
+    "fmt"
+    "guarddog/policy"
+    "syscall"
+)
+
+/* Not defined in syscall package, the value is the same for x86 and arm */
+const RLIMIT_NPROC = 6
+
+var rlimitResources = map[string]int{
+    "as": syscall.RLIMIT_AS,
+    "core": syscall.RLIMIT_CORE,
+    "cpu": syscall.RLIMIT_CPU,
+    "data": syscall.RLIMIT_DATA,
+    "fsize": syscall.RLIMIT_FSIZE,
+    "nofile": syscall.RLIMIT_NOFILE,
+    "nproc": RLIMIT_NPROC,
+    "stack": syscall.RLIMIT_STACK,
+}
+
+/* Returns RLIMIT_* constant for a resource name used in policies */
+func RlimitResource(name string) (int, error) {
+    resource, ok := rlimitResources[name]
+    if !ok {
+        return 0, fmt.Errorf("unknown resource limit '%s'", name)
+    }
+    return resource, nil
+}
+
+/*
+    Raises hard limits that are lower than the given values, soft limits
+    are kept. Must be called before changing uids, because only root can
+    raise hard limits, while the limits themselves are set right before exec.
+ */
+func RaiseHardRlimits(limits []policy.Rlimit) error {
+    for _, limit := range limits {
+        resource, err := RlimitResource(limit.Resource)
+        if err != nil {
+            return err
+        }
+
+        var value syscall.Rlimit
+        if err := syscall.Getrlimit(resource, &value); err != nil {
+            return fmt.Errorf("failed to get %s limit: %s", limit.Resource, err)
+        }
+        if value.Max >= limit.Value {
+            continue
+        }
+
+        value.Max = limit.Value
+        if err := syscall.Setrlimit(resource, &value); err != nil {
+            return fmt.Errorf("failed to set %s limit to %d: %s", limit.Resource, limit.Value, err)
+        }
+    }
+
+    return nil
+}